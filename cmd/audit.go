@@ -0,0 +1,101 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bocheninc/msg-net/config"
+	"github.com/bocheninc/msg-net/router/audit"
+	"github.com/spf13/cobra"
+)
+
+var auditKey string
+var auditAnchor string
+var auditHead string
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "audit log of routers",
+	Long:  `inspect the hash-chained audit log of routing decisions recorded by a router.`,
+}
+
+// auditVerifyCmd represents the audit verify command
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify [path]",
+	Short: "verify audit log",
+	Long: `verify the hash chain of the audit file and its rotated files, path defaults to router.audit.path of the config.
+A chain starting after removed files fails unless its anchor is given, and records removed from the end are only
+detected against a head recorded before, e.g. the output of a previous verification.`,
+	Run: runAuditVerify,
+}
+
+func init() {
+	RootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditVerifyCmd)
+	auditVerifyCmd.Flags().StringVar(&auditKey, "key", "", "HMAC key of the chain (default is router.audit.key of the config)")
+	auditVerifyCmd.Flags().StringVar(&auditAnchor, "anchor", "", "expected prev hash of the first record if older files are removed")
+	auditVerifyCmd.Flags().StringVar(&auditHead, "head", "", "expected head recorded before as seq:hash, the chain must reach it")
+}
+
+func runAuditVerify(cmd *cobra.Command, args []string) {
+	path := config.GetString("router.audit.path")
+	if len(args) > 0 {
+		path = args[0]
+	}
+	if path == "" {
+		fmt.Println("audit file path is required")
+		os.Exit(2)
+	}
+	key := auditKey
+	if !cmd.Flags().Changed("key") {
+		key = config.GetString("router.audit.key")
+	}
+	expect := audit.Expect{Anchor: auditAnchor}
+	if auditHead != "" {
+		parts := strings.SplitN(auditHead, ":", 2)
+		seq, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil || len(parts) != 2 || parts[1] == "" {
+			fmt.Println("invalid head, seq:hash is expected")
+			os.Exit(2)
+		}
+		expect.HeadSeq, expect.Head = seq, parts[1]
+	}
+	result, err := audit.Verify(path, []byte(key), expect)
+	if err != nil {
+		if result != nil && result.Records > 0 {
+			fmt.Printf("%d records verified from sequence %d\n", result.Records, result.First)
+		}
+		fmt.Println("audit log verification failed:", err)
+		os.Exit(1)
+	}
+	if result.Records == 0 {
+		fmt.Printf("audit log ok: no records in %d files\n", result.Files)
+		return
+	}
+	fmt.Printf("audit log ok: %d records in %d files, sequence %d to %d, head %d:%s\n",
+		result.Records, result.Files, result.First, result.First+result.Records-1, result.First+result.Records-1, result.Head)
+	if result.First > 1 {
+		fmt.Printf("chain starts after removed records, anchor %s\n", result.Anchor)
+	}
+}
@@ -19,7 +19,10 @@
 package cmd
 
 import (
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/bocheninc/msg-net/config"
 	"github.com/bocheninc/msg-net/logger"
@@ -75,6 +78,18 @@ func runRouter(cmd *cobra.Command, args []string) {
 			r.Stop()
 		}
 	}()
-	//go util.SysSignal(func() { r.Stop() })
+	//drain on first SIGINT or SIGTERM, stop immediately on second one
+	go func() {
+		c := make(chan os.Signal, 2)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+		for range c {
+			go r.Drain()
+		}
+	}()
+	config.OnReload(func() {
+		logger.Reload()
+		r.Reload()
+	})
+	config.WatchConfig()
 	r.Start()
 }
@@ -0,0 +1,107 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bocheninc/msg-net/config"
+	"github.com/bocheninc/msg-net/router"
+	"github.com/spf13/cobra"
+)
+
+var topologyAdmin string
+var topologyFormat string
+
+// topologyCmd represents the topology command
+var topologyCmd = &cobra.Command{
+	Use:   "topology",
+	Short: "print router mesh",
+	Long:  `print routers, links, attached peers, next hops and partitions seen by a router through its admin api.`,
+	Run:   runTopology,
+}
+
+func init() {
+	RootCmd.AddCommand(topologyCmd)
+	topologyCmd.Flags().StringVar(&topologyAdmin, "admin", "", "admin api address of the router (default is router.admin.address of the config)")
+	topologyCmd.Flags().StringVarP(&topologyFormat, "format", "o", "table", "output format, table, json or dot")
+}
+
+func runTopology(cmd *cobra.Command, args []string) {
+	address := topologyAdmin
+	if address == "" {
+		address = config.GetString("router.admin.address")
+	}
+	if address == "" {
+		fmt.Println("admin api address is required")
+		os.Exit(2)
+	}
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		address = "http://" + address
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(address, "/")+"/topology", nil)
+	if err != nil {
+		fmt.Println("failed to get topology:", err)
+		os.Exit(1)
+	}
+	if token := config.GetString("router.admin.token"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("failed to get topology:", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Println("failed to get topology:", err)
+		os.Exit(1)
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("failed to get topology: %s %s\n", resp.Status, strings.TrimSpace(string(body)))
+		os.Exit(1)
+	}
+	t := &router.Topology{}
+	if err := json.Unmarshal(body, t); err != nil {
+		fmt.Println("invalid topology:", err)
+		os.Exit(1)
+	}
+
+	switch topologyFormat {
+	case "json":
+		bytes, _ := json.MarshalIndent(t, "", "  ")
+		fmt.Println(string(bytes))
+	case "dot":
+		t.WriteDOT(os.Stdout)
+	case "table":
+		t.WriteTable(os.Stdout)
+	default:
+		fmt.Printf("unknown format %s, table, json or dot\n", topologyFormat)
+		os.Exit(2)
+	}
+}
@@ -22,11 +22,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/bocheninc/msg-net/util"
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
@@ -105,8 +109,40 @@ func defaultLoadConfig() {
 	SetDefault("router.timeout.routers", time.Second*15)
 	SetDefault("router.timeout.network.routers", time.Second*15)
 	SetDefault("router.timeout.network.peers", time.Second*15)
+	SetDefault("router.timeout.drain", time.Second*30)
 	SetDefault("router.reconnect.interval", time.Second*10)
 	SetDefault("router.reconnect.max", 5)
+	SetDefault("router.store.path", "")
+	SetDefault("router.store.expire", time.Hour*24)
+	SetDefault("router.duplicate", "reject")
+	SetDefault("router.dedup.size", 65536)
+	SetDefault("router.dedup.window", time.Second*5)
+	SetDefault("router.area", "")
+	SetDefault("router.border", false)
+	SetDefault("router.policy.path", "")
+	SetDefault("router.deadletter.path", "")
+	SetDefault("router.deadletter.maxSize", 10*1024*1024)
+	SetDefault("router.deadletter.maxFiles", 5)
+	SetDefault("router.admin.address", "")
+	SetDefault("router.admin.token", "")
+	SetDefault("router.trace.exporter", "")
+	SetDefault("router.trace.path", "./logs/spans.json")
+	SetDefault("router.trace.endpoint", "http://localhost:4318/v1/traces")
+	SetDefault("router.trace.sample", 0)
+	SetDefault("router.trace.batch", 512)
+	SetDefault("router.trace.interval", time.Second*5)
+	SetDefault("router.partition.retryMax", time.Minute)
+	SetDefault("router.audit.path", "")
+	SetDefault("router.audit.maxSize", 100*1024*1024)
+	SetDefault("router.audit.key", "")
+	SetDefault("router.membership.enabled", false)
+	SetDefault("router.membership.probe", time.Second)
+	SetDefault("router.membership.timeout", 300*time.Millisecond)
+	SetDefault("router.membership.indirect", 3)
+	SetDefault("router.membership.suspicion", time.Second*5)
+	SetDefault("router.membership.retransmit", 3)
+
+	SetDefault("peer.sessions", 2)
 
 	SetDefault("report.on", false)
 	SetDefault("report.interval", time.Second*60)
@@ -120,6 +156,56 @@ func ReadConfigFile(in string) {
 	}
 }
 
+var reloadFuncs []func()
+var rwReload sync.RWMutex
+var watchOnce sync.Once
+
+//OnReload registers function called after configuration reloaded
+func OnReload(function func()) {
+	rwReload.Lock()
+	defer rwReload.Unlock()
+	reloadFuncs = append(reloadFuncs, function)
+}
+
+//Reload re-reads configuration file and calls functions registered by OnReload
+func Reload() error {
+	if config.ConfigFileUsed() != "" {
+		if err := config.ReadInConfig(); err != nil {
+			return err
+		}
+	}
+	notifyReload()
+	return nil
+}
+
+//WatchConfig reloads configuration when configuration file changed or SIGHUP received
+func WatchConfig() {
+	watchOnce.Do(func() {
+		if config.ConfigFileUsed() != "" {
+			//viper has re-read the file before calling
+			config.OnConfigChange(func(e fsnotify.Event) { notifyReload() })
+			config.WatchConfig()
+		}
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGHUP)
+		go func() {
+			for range c {
+				if err := Reload(); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to reload config --- %v\n", err)
+				}
+			}
+		}()
+	})
+}
+
+func notifyReload() {
+	rwReload.RLock()
+	defer rwReload.RUnlock()
+	for _, function := range reloadFuncs {
+		function()
+	}
+}
+
 //String returns summary
 func String() string {
 	m := make(map[string]interface{})
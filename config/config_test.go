@@ -20,6 +20,9 @@ package config
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -28,3 +31,27 @@ func TestConfig(t *testing.T) {
 	Set("ccc", "ddd")
 	fmt.Println("ccc", Get("ccc"))
 }
+
+func TestConfigReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msg-net-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "msg-net.yaml")
+	ioutil.WriteFile(file, []byte("router:\n  timeout:\n    keepalive: 15s\n"), 0644)
+	ReadConfigFile(file)
+
+	reloaded := 0
+	OnReload(func() { reloaded++ })
+	ioutil.WriteFile(file, []byte("router:\n  timeout:\n    keepalive: 3s\n"), 0644)
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded != 1 {
+		t.Fatalf("reload function called %d times", reloaded)
+	}
+	if d := GetDuration("router.timeout.keepalive"); d.String() != "3s" {
+		t.Fatalf("expect keepalive 3s, got %s", d)
+	}
+}
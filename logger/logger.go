@@ -23,9 +23,12 @@ package logger
 
 import (
 	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -33,8 +36,39 @@ import (
 	"github.com/bocheninc/msg-net/util"
 )
 
-var logger *logrus.Logger
+var std atomic.Value //*logrus.Logger, replaced as a whole since logrus reads level and formatter without lock
 var day string
+var out = &output{w: os.Stderr}
+var rwOut sync.Mutex //serializes SetOut and Reload
+
+//output out of logger, the file is swapped while other goroutines are logging
+type output struct {
+	w io.Writer
+	sync.Mutex
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+	return o.w.Write(p)
+}
+
+func (o *output) writer() io.Writer {
+	o.Lock()
+	defer o.Unlock()
+	return o.w
+}
+
+//swap replaces the writer, the old file is closed after the swap
+func (o *output) swap(w io.Writer) {
+	o.Lock()
+	old := o.w
+	o.w = w
+	o.Unlock()
+	if f, ok := old.(*os.File); ok && f != w && f != os.Stderr && f != os.Stdout {
+		f.Close()
+	}
+}
 
 func init() {
 	Init()
@@ -42,24 +76,60 @@ func init() {
 
 //Init Initialization
 func Init() {
-	logger = logrus.New()
+	l := logrus.New()
+	l.Out = out
+	std.Store(l)
+	setLevel()
+}
+
+func current() *logrus.Logger {
+	return std.Load().(*logrus.Logger)
+}
+
+//update applies change to a copy of the logger and replaces it, other goroutines keep logging with the old one
+func update(change func(l *logrus.Logger)) {
+	old := current()
+	l := &logrus.Logger{Out: out, Formatter: old.Formatter, Hooks: old.Hooks, Level: old.Level}
+	change(l)
+	std.Store(l)
+}
+
+//Reload applies reloaded level, formatter and out to the running logger
+func Reload() {
+	rwOut.Lock()
+	defer rwOut.Unlock()
+	setLevel()
+	if config.GetString("logger.out") == "" {
+		out.swap(os.Stderr)
+	}
+	//reopen file, out directory may be changed
+	day = ""
+	setOut()
+}
+
+func setLevel() {
 	if level := config.GetString("logger.level"); level != "" {
 		if lv, err := logrus.ParseLevel(level); err == nil {
-			logger.Level = lv
+			update(func(l *logrus.Logger) { l.Level = lv })
 		} else {
 			Errorf("unsupport logger.level %s --- %v\n", level, err)
 		}
 	}
-
 }
 
 //SetOut sets out log
 func SetOut() {
-	if out := config.GetString("logger.out"); out != "" {
+	rwOut.Lock()
+	defer rwOut.Unlock()
+	setOut()
+}
+
+func setOut() {
+	if dir := config.GetString("logger.out"); dir != "" {
 		if day == "" {
-			if !util.IsDirExist(out) {
-				if err := util.MkDir(out); err != nil {
-					Errorf("failed to open file %s for logger.Out --- %v", out, err)
+			if !util.IsDirExist(dir) {
+				if err := util.MkDir(dir); err != nil {
+					Errorf("failed to open file %s for logger.Out --- %v", dir, err)
 					return
 				}
 			}
@@ -67,23 +137,17 @@ func SetOut() {
 
 		day2 := time.Now().Format("2006-01-02")
 		if day == "" || day != day2 {
-			switch logger.Out.(type) {
-			case *os.File:
-				if logger.Out != os.Stderr && logger.Out != os.Stdout {
-					logger.Out.(*os.File).Close()
-				}
-			}
 			day = day2
 			var fileName string
 			if config.GetString("router.id") == "" {
-				fileName = filepath.Join(out, day+"_"+strings.Split(config.GetString("router.address"), ":")[1]+".log")
+				fileName = filepath.Join(dir, day+"_"+strings.Split(config.GetString("router.address"), ":")[1]+".log")
 			} else {
-				fileName = filepath.Join(out, day+"_"+config.GetString("router.id")+".log")
+				fileName = filepath.Join(dir, day+"_"+config.GetString("router.id")+".log")
 			}
 			if f, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666); err == nil {
-				logger.Out = f
+				out.swap(f)
 			} else {
-				logger.Out = os.Stderr
+				out.swap(os.Stderr)
 				Errorf("failed to open file %s for logger.Out --- %v", fileName, err)
 			}
 		}
@@ -92,14 +156,18 @@ func SetOut() {
 	if formatter := config.GetString("logger.formatter"); formatter != "" {
 		switch f := strings.ToLower(formatter); f {
 		case "json":
-			logger.Formatter = &logrus.JSONFormatter{
-				TimestampFormat: "2006-01-02 15:04:05",
-			}
+			update(func(l *logrus.Logger) {
+				l.Formatter = &logrus.JSONFormatter{
+					TimestampFormat: "2006-01-02 15:04:05",
+				}
+			})
 		case "text":
-			logger.Formatter = &logrus.TextFormatter{
-				TimestampFormat: "2006-01-02 15:04:05",
-				FullTimestamp:   true,
-			}
+			update(func(l *logrus.Logger) {
+				l.Formatter = &logrus.TextFormatter{
+					TimestampFormat: "2006-01-02 15:04:05",
+					FullTimestamp:   true,
+				}
+			})
 		default:
 			Errorf("unsupport logger.formatter %s\n", formatter)
 		}
@@ -108,6 +176,7 @@ func SetOut() {
 
 //String returns summary
 func String() string {
+	logger := current()
 	formatter := "unkown"
 	switch logger.Formatter.(type) {
 	case *logrus.JSONFormatter:
@@ -115,16 +184,16 @@ func String() string {
 	case *logrus.TextFormatter:
 		formatter = "text"
 	}
-	out := "unkown"
-	switch logger.Out.(type) {
+	name := "unkown"
+	switch w := out.writer().(type) {
 	case *os.File:
-		out = logger.Out.(*os.File).Name()
+		name = w.Name()
 	}
 
 	m := make(map[string]interface{})
 	m["formatter"] = formatter
 	m["level"] = logger.Level.String()
-	m["out"] = out
+	m["out"] = name
 
 	bytes, _ := json.Marshal(m)
 	return string(bytes)
@@ -132,126 +201,126 @@ func String() string {
 
 //Debug logs a message at level Debug on the standard logger
 func Debug(args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Debug(args...)
 }
 
 //Info logs a message at level Info on the standard logger
 func Info(args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Info(args...)
 }
 
 //Warn logs a message at level Warn on the standard logger
 func Warn(args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Warn(args...)
 }
 
 //Error logs a message at level Error on the standard logger
 func Error(args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Error(args...)
 }
 
 //Panic logs a message at level Panic on the standard logger
 func Panic(args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Panic(args...)
 }
 
 //Fatal logs a message at level Fatal on the standard logger
 func Fatal(args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Fatal(args...)
 }
 
 //Debugln logs a message at level Debug on the standard logger
 func Debugln(args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Debugln(args...)
 }
 
 //Infoln logs a message at level Info on the standard logger
 func Infoln(args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Infoln(args...)
 }
 
 //Warnln logs a message at level Warn on the standard logger
 func Warnln(args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Warnln(args...)
 }
 
 //Errorln logs a message at level Error on the standard logger
 func Errorln(args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Errorln(args...)
 }
 
 //Panicln logs a message at level Panic on the standard logger
 func Panicln(args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Panicln(args...)
 }
 
 //Fatalln logs a message at level Fatal on the standard logger
 func Fatalln(args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Fatalln(args...)
 }
 
 //Debugf logs a message at level Debug on the standard logger
 func Debugf(format string, args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Debugf(format, args...)
 }
 
 //Infof logs a message at level Info on the standard logger
 func Infof(format string, args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Infof(format, args...)
 }
 
 //Warnf logs a message at level Warn on the standard logger
 func Warnf(format string, args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Warnf(format, args...)
 }
 
 //Errorf logs a message at level Error on the standard logger
 func Errorf(format string, args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Errorf(format, args...)
 }
 
 //Panicf logs a message at level Panic on the standard logger
 func Panicf(format string, args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Panicf(format, args...)
 }
 
 //Fatalf logs a message at level Fatal on the standard logger
 func Fatalf(format string, args ...interface{}) {
-	logger.WithFields(logrus.Fields{
+	current().WithFields(logrus.Fields{
 		"location": util.CallerInfo(2),
 	}).Fatalf(format, args...)
 }
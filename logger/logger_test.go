@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/bocheninc/msg-net/config"
 )
 
@@ -64,3 +65,24 @@ func TestLogger(t *testing.T) {
 	//Panicf("%s", "panicf")
 	//Fatalf("%s", "fatalf")
 }
+
+func TestReload(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			Debugf("reload %d", i)
+		}
+	}()
+	for _, formatter := range []string{"json", "text"} {
+		config.Set("logger.level", "debug")
+		config.Set("logger.formatter", formatter)
+		Reload()
+		config.Set("logger.level", "info")
+		Reload()
+	}
+	<-done
+	if lv := current().Level; lv != logrus.InfoLevel {
+		t.Fatalf("expect level %v, got %v", logrus.InfoLevel, lv)
+	}
+}
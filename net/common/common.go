@@ -40,6 +40,11 @@ func init() {
 	channelCap = 100
 }
 
+//MaxMsgSize Maximum size of serialized message
+func MaxMsgSize() uint64 {
+	return maxMsgSize
+}
+
 //IMsg Message serialization interface
 type IMsg interface {
 	Serialize() ([]byte, error)
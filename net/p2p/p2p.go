@@ -38,15 +38,21 @@ func NewP2P(address string, newMsg func() common.IMsg, handleMsg func(net.Conn,
 
 //P2P Define p2p class, supply peer to peer network
 type P2P struct {
-	address   string
-	newMsg    func() common.IMsg
-	handleMsg func(net.Conn, chan<- common.IMsg, common.IMsg) error
+	address          string
+	newMsg           func() common.IMsg
+	handleMsg        func(net.Conn, chan<- common.IMsg, common.IMsg) error
+	handleDisconnect func(net.Conn, error)
 
 	server  *tcp.Server
 	clients map[net.Conn]*tcp.Client
 	sync.RWMutex
 }
 
+//SetDisconnectHandle Set function that is called when connection is broken by read or write error, must be called before Start
+func (p *P2P) SetDisconnectHandle(function func(net.Conn, error)) {
+	p.handleDisconnect = function
+}
+
 //IsRunning Running or not for supply services
 func (p *P2P) IsRunning() bool {
 	return p.server != nil && p.server.IsRunning()
@@ -63,6 +69,7 @@ func (p *P2P) Start() {
 	p.server = nil
 	p.clients = make(map[net.Conn]*tcp.Client)
 	p.server = tcp.NewServer(p.address, p.newMsg, p.handleMsg)
+	p.server.SetDisconnectHandle(p.handleDisconnect)
 	p.server.Start()
 }
 
@@ -84,6 +91,12 @@ func (p *P2P) Stop() {
 //Connect Connect to tcp server
 func (p *P2P) Connect(address string) net.Conn {
 	clinet := tcp.NewClient(address, p.newMsg, p.handleMsg)
+	clinet.SetDisconnectHandle(func(conn net.Conn, err error) {
+		p.remove(conn)
+		if p.handleDisconnect != nil {
+			p.handleDisconnect(conn, err)
+		}
+	})
 	if conn := clinet.Connect(); conn != nil {
 		p.add(conn, clinet)
 		return conn
@@ -114,6 +127,15 @@ func (p *P2P) BroadCastToClient(msg common.IMsg, function func(net.Conn, common.
 	p.server.BroadCast(msg, function)
 }
 
+//Pending Number of messages queued to send to all clients and servers
+func (p *P2P) Pending() int {
+	n := p.server.Pending()
+	p.iterFunc(func(conn net.Conn, tc *tcp.Client) {
+		n += len(tc.SendChannel())
+	})
+	return n
+}
+
 //String Get tcp server information
 func (p *P2P) String() string {
 	m := make(map[string]interface{})
@@ -23,6 +23,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"time"
 
 	"encoding/json"
 
@@ -38,9 +39,11 @@ func NewClient(address string, newMsg func() common.IMsg, handleMsg func(net.Con
 
 //Client  Define tcp client class and it can use connect to tcp server specify by address
 type Client struct {
-	address   string
-	newMsg    func() common.IMsg                                    //function that create an IMsg instance which is used to recv data
-	handleMsg func(net.Conn, chan<- common.IMsg, common.IMsg) error //function that how to handle IMsg instance and send data
+	address          string
+	newMsg           func() common.IMsg                                    //function that create an IMsg instance which is used to recv data
+	handleMsg        func(net.Conn, chan<- common.IMsg, common.IMsg) error //function that how to handle IMsg instance and send data
+	handleDisconnect func(net.Conn, error)                                 //function that is called when connection is broken by read or write error
+	dialTimeout      time.Duration                                         //no timeout if 0
 
 	conn   net.Conn
 	cancel context.CancelFunc
@@ -48,9 +51,19 @@ type Client struct {
 	common.Handler //supply send and recv function
 }
 
-//IsConnected Connected to server or not
+//SetDisconnectHandle Set function that is called when connection is broken by read or write error
+func (tc *Client) SetDisconnectHandle(function func(net.Conn, error)) {
+	tc.handleDisconnect = function
+}
+
+//SetDialTimeout Set timeout of connecting to server, no timeout if 0
+func (tc *Client) SetDialTimeout(timeout time.Duration) {
+	tc.dialTimeout = timeout
+}
+
+//IsConnected Connected to server or not, false once disconnecting
 func (tc *Client) IsConnected() bool {
-	return tc.conn != nil
+	return tc.conn != nil && tc.cancel != nil
 }
 
 //Connect Connect to tcp server and supply communication
@@ -65,7 +78,7 @@ func (tc *Client) Connect() net.Conn {
 		logger.Errorf("client %s failed to connect to server %s --- %v", tc.LocalAddr(), tc.RemoteAddr(), err)
 		return nil
 	}
-	conn, err := net.Dial("tcp", tc.RemoteAddr())
+	conn, err := net.DialTimeout("tcp", tc.RemoteAddr(), tc.dialTimeout)
 	if err != nil {
 		logger.Errorf("client %s failed to connect to server %s --- %v", tc.LocalAddr(), tc.RemoteAddr(), err)
 		return nil
@@ -127,8 +140,8 @@ func (tc *Client) handleConn() {
 		// defer tc.ws.Done()
 		ctx0, cancel0 := context.WithCancel(context.Background())
 		ws0 := &sync.WaitGroup{}
+		ws0.Add(1)
 		go func(ctx context.Context) {
-			ws0.Add(1)
 			defer ws0.Done()
 			for {
 				select {
@@ -141,6 +154,10 @@ func (tc *Client) handleConn() {
 				case msg := <-tc.SendChannel():
 					if _, err := tc.Send(tc.conn, msg); err != nil {
 						logger.Errorf("client %s failed to send msg to server %s --- %v", tc.LocalAddr(), tc.RemoteAddr(), err)
+						if isBroken(err) {
+							//wake up receiver to report link failure
+							tc.conn.Close()
+						}
 					} else {
 						logger.Debugf("client %s send msg to server %s --- %v", tc.LocalAddr(), tc.RemoteAddr(), msg)
 					}
@@ -163,19 +180,27 @@ func (tc *Client) handleConn() {
 			default:
 			}
 			msg := tc.newMsg()
-			switch err := tc.Recv(tc.conn, msg); err {
-			case io.EOF:
+			switch err := tc.Recv(tc.conn, msg); {
+			case err == nil:
+				tc.RecvChannel() <- msg
+				logger.Debugf("client %s received msg from server %s --- %v", tc.LocalAddr(), tc.RemoteAddr(), msg)
+			case isBroken(err):
+				if err == io.EOF {
+					logger.Infof("client %s received close from server %s.", tc.LocalAddr(), tc.RemoteAddr())
+				} else {
+					logger.Errorf("client %s lost connection to server %s --- %v.", tc.LocalAddr(), tc.RemoteAddr(), err)
+				}
 				cancel0()
 				ws0.Wait()
-				tc.conn.Close()
-				logger.Infof("client %s received close from server %s.", tc.LocalAddr(), tc.RemoteAddr())
+				conn := tc.conn
+				conn.Close()
 				tc.conn = nil
 				tc.cancel = nil
 				//tc.ws = nil
+				if tc.handleDisconnect != nil {
+					tc.handleDisconnect(conn, err)
+				}
 				return
-			case nil:
-				tc.RecvChannel() <- msg
-				logger.Debugf("client %s received msg from server %s --- %v", tc.LocalAddr(), tc.RemoteAddr(), msg)
 			default:
 				if opErr, ok := err.(*net.OpError); ok && (opErr.Timeout() || opErr.Temporary()) {
 					logger.Debugf("client %s failed to receive msg from server %s --- %v.", tc.LocalAddr(), tc.RemoteAddr(), err)
@@ -186,3 +211,14 @@ func (tc *Client) handleConn() {
 		}
 	}(ctx)
 }
+
+//isBroken determines whether the error means the connection is no longer usable
+func isBroken(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if opErr, ok := err.(*net.OpError); ok {
+		return !opErr.Timeout() && !opErr.Temporary()
+	}
+	return false
+}
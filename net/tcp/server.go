@@ -42,16 +42,23 @@ func NewServer(address string, newMsg func() common.IMsg, handleMsg func(net.Con
 
 //Server Define tcp server class and supply newwork services
 type Server struct {
-	address   string
-	newMsg    func() common.IMsg
-	handleMsg func(net.Conn, chan<- common.IMsg, common.IMsg) error
+	address          string
+	newMsg           func() common.IMsg
+	handleMsg        func(net.Conn, chan<- common.IMsg, common.IMsg) error
+	handleDisconnect func(net.Conn, error)
 
+	listener   *net.TCPListener
 	connMap    map[net.Conn]*clientConn
 	cancelFunc context.CancelFunc
 	//ws         *sync.WaitGroup
 	sync.RWMutex
 }
 
+//SetDisconnectHandle Set function that is called when client connection is broken by read or write error
+func (ts *Server) SetDisconnectHandle(function func(net.Conn, error)) {
+	ts.handleDisconnect = function
+}
+
 //IsRunning Running or not for supply services
 func (ts *Server) IsRunning() bool {
 	return ts.cancelFunc != nil
@@ -79,6 +86,7 @@ func (ts *Server) Start() {
 	}
 	defer listener.Close()
 
+	ts.listener = listener
 	ts.connMap = make(map[net.Conn]*clientConn)
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	ts.cancelFunc = cancelFunc
@@ -98,13 +106,18 @@ func (ts *Server) Start() {
 		if conn, err := listener.AcceptTCP(); err != nil {
 			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
 				//timeout
+			} else if ctx.Err() != nil {
+				//listener closed by stop
 			} else {
 				logger.Errorf("server %s failed to accept --- %v", ts.address, err)
 			}
 		} else {
 			logger.Debugf("server %s accept a client %s ...", ts.address, conn.RemoteAddr().String())
 			cc := &clientConn{ts: ts, conn: conn}
-			ts.add(conn, cc)
+			if !ts.add(conn, cc) {
+				conn.Close()
+				continue
+			}
 			cc.handleConn(ctx)
 			logger.Infof("server %s information : %s", ts.address, ts.String())
 		}
@@ -124,7 +137,11 @@ func (ts *Server) Stop() {
 	//ts.ws.Wait()
 	ts.cancelFunc = nil
 	//ts.ws = nil
+	//stop accepting immediately, port is released for restart
+	ts.listener.Close()
+	ts.Lock()
 	ts.connMap = nil
+	ts.Unlock()
 	logger.Infof("server %s stop successfully", ts.address)
 }
 
@@ -145,6 +162,15 @@ func (ts *Server) BroadCast(msg common.IMsg, function func(net.Conn, common.IMsg
 	})
 }
 
+//Pending Number of messages queued to send to all clients
+func (ts *Server) Pending() int {
+	n := 0
+	ts.iterFunc(func(conn net.Conn, cc *clientConn) {
+		n += len(cc.SendChannel())
+	})
+	return n
+}
+
 //String Get tcp server information
 func (ts *Server) String() string {
 	m := make(map[string]interface{})
@@ -164,10 +190,14 @@ func (ts *Server) String() string {
 	return string(bytes)
 }
 
-func (ts *Server) add(conn net.Conn, cc *clientConn) {
+func (ts *Server) add(conn net.Conn, cc *clientConn) bool {
 	ts.Lock()
 	defer ts.Unlock()
+	if ts.connMap == nil {
+		return false
+	}
 	ts.connMap[conn] = cc
+	return true
 }
 
 func (ts *Server) remove(conn net.Conn) *clientConn {
@@ -208,8 +238,8 @@ func (cc *clientConn) handleConn(c context.Context) {
 		// defer cc.ws.Done()
 		ctx0, cancel0 := context.WithCancel(context.Background())
 		ws0 := &sync.WaitGroup{}
+		ws0.Add(1)
 		go func(ctx context.Context) {
-			ws0.Add(1)
 			defer ws0.Done()
 			for {
 				select {
@@ -222,6 +252,10 @@ func (cc *clientConn) handleConn(c context.Context) {
 				case msg := <-cc.SendChannel():
 					if _, err := cc.Send(cc.conn, msg); err != nil {
 						logger.Errorf("server %s failed to send msg to client %s --- %v", cc.conn.LocalAddr().String(), cc.conn.RemoteAddr().String(), err)
+						if isBroken(err) {
+							//wake up receiver to report link failure
+							cc.conn.Close()
+						}
 					} else {
 						logger.Debugf("server %s send msg to client %s --- %v", cc.conn.LocalAddr().String(), cc.conn.RemoteAddr().String(), msg)
 					}
@@ -244,20 +278,28 @@ func (cc *clientConn) handleConn(c context.Context) {
 			default:
 			}
 			msg := cc.ts.newMsg()
-			switch err := cc.Recv(cc.conn, msg); err {
-			case io.EOF:
+			switch err := cc.Recv(cc.conn, msg); {
+			case err == nil:
+				cc.RecvChannel() <- msg
+				logger.Debugf("server %s received msg from client %s --- %v", cc.conn.LocalAddr().String(), cc.conn.RemoteAddr().String(), msg)
+			case isBroken(err):
+				if err == io.EOF {
+					logger.Infof("server %s received close from client %s.", cc.conn.LocalAddr().String(), cc.conn.RemoteAddr().String())
+				} else {
+					logger.Errorf("server %s lost connection to client %s --- %v.", cc.conn.LocalAddr().String(), cc.conn.RemoteAddr().String(), err)
+				}
 				cc.ts.remove(cc.conn)
 				cancel0()
 				ws0.Wait()
-				cc.conn.Close()
-				logger.Infof("server %s received close from client %s.", cc.conn.LocalAddr().String(), cc.conn.RemoteAddr().String())
+				conn := cc.conn
+				conn.Close()
 				cc.conn = nil
 				cc.cancel = nil
 				//cc.ws = nil
+				if cc.ts.handleDisconnect != nil {
+					cc.ts.handleDisconnect(conn, err)
+				}
 				return
-			case nil:
-				cc.RecvChannel() <- msg
-				logger.Debugf("server %s received msg from client %s --- %v", cc.conn.LocalAddr().String(), cc.conn.RemoteAddr().String(), msg)
 			default:
 				if opErr, ok := err.(*net.OpError); ok && (opErr.Timeout() || opErr.Temporary()) {
 					logger.Debugf("server %s failed to receive msg from client %s --- %v.", cc.conn.LocalAddr().String(), cc.conn.RemoteAddr().String(), err)
@@ -126,3 +126,59 @@ func TestTcpStartAndStop5(t *testing.T) {
 	time.Sleep(time.Second)
 	s.Stop()
 }
+
+//测试TCP连接断开通知
+func TestTcpDisconnectHandle(t *testing.T) {
+	s := NewServer("127.0.0.1:8005", newMsg, handleMsgServer)
+	serverNotify := make(chan net.Conn, 1)
+	s.SetDisconnectHandle(func(conn net.Conn, err error) {
+		logger.Infoln("server link failure ", err)
+		serverNotify <- conn
+	})
+	go s.Start()
+	time.Sleep(time.Second)
+
+	c := NewClient("127.0.0.1:8005", newMsg, handleMsgClient)
+	clientNotify := make(chan net.Conn, 1)
+	c.SetDisconnectHandle(func(conn net.Conn, err error) {
+		logger.Infoln("client link failure ", err)
+		clientNotify <- conn
+	})
+	conn := c.Connect()
+	if conn == nil {
+		t.Fatal("failed to connect")
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	//break the link under the client without Disconnect
+	conn.Close()
+	select {
+	case <-clientNotify:
+	case <-time.After(3 * time.Second):
+		t.Fatal("client link failure not reported")
+	}
+	select {
+	case <-serverNotify:
+	case <-time.After(3 * time.Second):
+		t.Fatal("server link failure not reported")
+	}
+	if c.IsConnected() {
+		t.Fatal("client still connected after link failure")
+	}
+
+	//intentional disconnect is not a link failure
+	c2 := NewClient("127.0.0.1:8005", newMsg, handleMsgClient)
+	c2.SetDisconnectHandle(func(conn net.Conn, err error) {
+		clientNotify <- conn
+	})
+	c2.Connect()
+	time.Sleep(100 * time.Millisecond)
+	c2.Disconnect()
+	select {
+	case <-clientNotify:
+		t.Fatal("intentional disconnect reported as link failure")
+	case <-time.After(time.Second):
+	}
+
+	s.Stop()
+}
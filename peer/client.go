@@ -0,0 +1,131 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package peer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+//Client peer connected to routers, errors are reported instead of logged
+type Client struct {
+	peer   *Peer
+	closed int32
+}
+
+//Dial creates peer by options and connects to routers, it blocks until a session to router is established or ctx is done,
+//it fails with ErrNotConnected if all sessions give up reconnecting
+func Dial(ctx context.Context, opts ...Option) (*Client, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.id == "" {
+		return nil, errors.New("peer: id is not specified")
+	}
+	if len(o.addresses) == 0 {
+		return nil, errors.New("peer: routers are not specified")
+	}
+	if o.handler == nil {
+		o.handler = func(srcID, dstID string, payload []byte, signature []byte) error { return nil }
+	}
+
+	p := &Peer{id: o.id, addresses: o.addresses, chainMessageHandle: o.handler, opts: o}
+	if err := p.start(); err != nil && err != ErrNotConnected {
+		p.Stop()
+		return nil, err
+	}
+	for !p.IsRunning() {
+		select {
+		case <-ctx.Done():
+			p.Stop()
+			return nil, ctx.Err()
+		case <-p.dialing:
+			if !p.IsRunning() {
+				p.Stop()
+				return nil, ErrNotConnected
+			}
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return &Client{peer: p}, nil
+}
+
+//ID returns peer id
+func (c *Client) ID() string {
+	return c.peer.id
+}
+
+//Send sends payload to peer dstID, or to all peers of the chain if dstID is a chain id
+func (c *Client) Send(ctx context.Context, dstID string, payload []byte, signature []byte, opts ...SendOption) (MsgID, error) {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return "", ErrClosed
+	}
+	return c.peer.send(ctx, dstID, "", payload, signature, opts...)
+}
+
+//Multicast sends payload to all peers matching dstID and label selector, e.g. dstID "A" with selector "role=validator"
+//reaches all validators of chain A, see protos.Selector for the syntax
+func (c *Client) Multicast(ctx context.Context, dstID, selector string, payload []byte, signature []byte, opts ...SendOption) (MsgID, error) {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return "", ErrClosed
+	}
+	return c.peer.send(ctx, dstID, selector, payload, signature, opts...)
+}
+
+//Lookup lists online peers matching pattern and routers they are attached to,
+//pattern is a peer id, or a chain id ending with ":" for all peers of the chain
+func (c *Client) Lookup(ctx context.Context, pattern string) ([]PeerInfo, error) {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return nil, ErrClosed
+	}
+	return c.peer.Lookup(ctx, pattern)
+}
+
+//Close closes sessions to routers
+func (c *Client) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return ErrClosed
+	}
+	c.peer.Stop()
+	return nil
+}
+
+//Subscribe returns channel of peer events and function that cancels the subscription,
+//events are dropped when the channel is full
+func (c *Client) Subscribe(size int) (<-chan Event, func()) {
+	return c.peer.Subscribe(size)
+}
+
+//ReplayStats returns counters of replay protection
+func (c *Client) ReplayStats() ReplayStats {
+	return c.peer.ReplayStats()
+}
+
+//Pending returns number of reliable messages not acknowledged yet
+func (c *Client) Pending() int {
+	return c.peer.Pending()
+}
+
+//String returns summary
+func (c *Client) String() string {
+	return c.peer.String()
+}
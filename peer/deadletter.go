@@ -0,0 +1,77 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package peer
+
+import (
+	"time"
+
+	"github.com/bocheninc/msg-net/logger"
+	pb "github.com/bocheninc/msg-net/protos"
+)
+
+//reasonErrors errors of dead letter reasons, DELIVERY_FAILED router fails to write to the connection of destination
+var reasonErrors = map[pb.DeadLetter_Reason]error{
+	pb.DeadLetter_NO_ROUTE:        ErrNoRoute,
+	pb.DeadLetter_ACL_DENIED:      ErrUnauthorized,
+	pb.DeadLetter_TTL_EXPIRED:     ErrExpired,
+	pb.DeadLetter_TOO_LARGE:       ErrTooLarge,
+	pb.DeadLetter_DELIVERY_FAILED: ErrUndeliverable,
+}
+
+//UndeliverableError sent message is dropped by router, errors.Is matches the error of its reason, e.g. ErrNoRoute or ErrUnauthorized
+type UndeliverableError struct {
+	Router string
+	Detail string
+	Err    error
+}
+
+func (e *UndeliverableError) Error() string {
+	return e.Err.Error() + " at router " + e.Router + " --- " + e.Detail
+}
+
+//Unwrap returns the error of reason
+func (e *UndeliverableError) Unwrap() error {
+	return e.Err
+}
+
+//undeliverable reports dead letter notice of sent message to the error handler,
+//reliable message keeps being retransmitted if the reason may be transient
+func (p *Peer) undeliverable(notice *pb.DeadLetter) {
+	//notice arrives from every router the peer is connected to
+	if _, ok := p.msgUniqueAdd("deadletter:"+notice.Id+":"+notice.Router+":"+notice.Reason.String(), time.Now().Add(uniqueWindow), nil); !ok {
+		return
+	}
+	err, ok := reasonErrors[notice.Reason]
+	if !ok {
+		err = ErrUndeliverable
+	}
+	if p.isPending(notice.Id) {
+		if notice.Reason == pb.DeadLetter_NO_ROUTE || notice.Reason == pb.DeadLetter_DELIVERY_FAILED {
+			logger.Debugf("peer %s reliable msg %s to %s is undeliverable at router %s, retransmit later --- %v", p.id, notice.Id, notice.DstId, notice.Router, err)
+			return
+		}
+		p.untrack(notice.Id)
+	}
+	e := &UndeliverableError{Router: notice.Router, Detail: notice.Detail, Err: err}
+	if p.opts.errorHandler == nil {
+		logger.Warnf("peer %s msg %s to %s is undeliverable --- %v", p.id, notice.Id, notice.DstId, e)
+		return
+	}
+	p.opts.errorHandler(MsgID(notice.Id), e)
+}
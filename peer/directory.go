@@ -0,0 +1,254 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package peer
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bocheninc/msg-net/logger"
+	pb "github.com/bocheninc/msg-net/protos"
+)
+
+//resyncInterval full resync of a router peer table is requested at most once within the interval
+var resyncInterval = time.Second
+
+//directory remote peers learned from PEER_SYNC, routers unreachable from the attached routers are pruned by ROUTER_SYNC
+type directory struct {
+	peers    map[string][]string //router address -> attached peer ids
+	links    map[string][]string //router address -> linked router addresses
+	versions map[string]tableVersion
+	resyncs  map[string]time.Time
+	keys     map[string][]byte //peer id -> public key announced
+	changed  map[string]bool   //peer id -> another public key announced while online
+	sync.Mutex
+}
+
+//tableVersion version of peer table of a router, epoch changes when the router restarts
+type tableVersion struct {
+	epoch   int64
+	version uint64
+}
+
+func newDirectory() *directory {
+	return &directory{peers: make(map[string][]string), links: make(map[string][]string), versions: make(map[string]tableVersion), resyncs: make(map[string]time.Time), keys: make(map[string][]byte), changed: make(map[string]bool)}
+}
+
+//applyPeers applies full snapshot or delta of router peer table, returns peers joined and left,
+//ok is false if the delta does not follow the local copy and a full resync is needed
+func (d *directory) applyPeers(update *pb.Peers) (joined, left []string, ok bool) {
+	d.Lock()
+	defer d.Unlock()
+	known, exists := d.versions[update.Id]
+	if !exists && update.Delta && update.Base == 0 {
+		known, exists = tableVersion{epoch: update.Epoch}, true
+	}
+	sameEpoch := exists && known.epoch == update.Epoch
+	before := d.online()
+	ids := []string{}
+	if !update.Delta {
+		if sameEpoch && update.Version < known.version {
+			return nil, nil, true
+		}
+		for _, peer := range update.Peers {
+			ids = append(ids, peer.Id)
+			d.setKey(peer)
+		}
+	} else {
+		if !sameEpoch || update.Base > known.version {
+			return nil, nil, false
+		}
+		if update.Base < known.version {
+			return nil, nil, true
+		}
+		removed := make(map[string]bool)
+		for _, id := range update.Removed {
+			removed[id] = true
+		}
+		for _, peer := range update.Peers {
+			removed[peer.Id] = true
+			ids = append(ids, peer.Id)
+			d.setKey(peer)
+		}
+		for _, id := range d.peers[update.Id] {
+			if !removed[id] {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		delete(d.peers, update.Id)
+	} else {
+		d.peers[update.Id] = ids
+	}
+	d.versions[update.Id] = tableVersion{epoch: update.Epoch, version: update.Version}
+	joined, left = diff(before, d.online())
+	d.forget(left)
+	return joined, left, true
+}
+
+//setKey keeps the first public key of online peer, another key may come from a forged peer table,
+//the peer is not sealed to until it goes offline
+func (d *directory) setKey(peer *pb.Peer) {
+	if len(peer.PublicKey) == 0 {
+		return
+	}
+	key, ok := d.keys[peer.Id]
+	if !ok {
+		d.keys[peer.Id] = peer.PublicKey
+		return
+	}
+	if !bytes.Equal(key, peer.PublicKey) && !d.changed[peer.Id] {
+		logger.Errorf("peer %s announced another public key while online, it is refused", peer.Id)
+		d.changed[peer.Id] = true
+	}
+}
+
+//forget drops public keys of peers left
+func (d *directory) forget(left []string) {
+	for _, id := range left {
+		delete(d.keys, id)
+		delete(d.changed, id)
+	}
+}
+
+//publicKey gets public key announced by online peer
+func (d *directory) publicKey(id string) ([]byte, error) {
+	d.Lock()
+	defer d.Unlock()
+	if d.changed[id] {
+		return nil, ErrKeyChanged
+	}
+	key, ok := d.keys[id]
+	if !ok {
+		return nil, ErrNoKey
+	}
+	return key, nil
+}
+
+//checkDigest compares digest of router peer table, returns false if the local copy is behind or differs
+func (d *directory) checkDigest(digest *pb.PeerDigest) bool {
+	d.Lock()
+	defer d.Unlock()
+	known, ok := d.versions[digest.Id]
+	if !ok {
+		return digest.Count == 0
+	}
+	if known.epoch != digest.Epoch || known.version < digest.Version {
+		return false
+	}
+	return known.version > digest.Version || uint32(len(d.peers[digest.Id])) == digest.Count
+}
+
+//requestResync returns true if resync of router peer table is not requested recently
+func (d *directory) requestResync(router string) bool {
+	d.Lock()
+	defer d.Unlock()
+	if t, ok := d.resyncs[router]; ok && time.Since(t) < resyncInterval {
+		return false
+	}
+	d.resyncs[router] = time.Now()
+	return true
+}
+
+//updateLinks replaces routers linked to router and prunes routers unreachable from roots, returns peers left
+func (d *directory) updateLinks(router string, linked []string, roots []string) (left []string) {
+	d.Lock()
+	defer d.Unlock()
+	before := d.online()
+	d.links[router] = linked
+
+	//links of attached routers are needed to tell unreachable ones
+	known := false
+	for _, root := range roots {
+		if _, ok := d.links[root]; ok {
+			known = true
+		}
+	}
+	if !known {
+		return nil
+	}
+	reachable := make(map[string]bool)
+	queue := append([]string{}, roots...)
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		if reachable[r] {
+			continue
+		}
+		reachable[r] = true
+		queue = append(queue, d.links[r]...)
+	}
+	for r := range d.peers {
+		if !reachable[r] {
+			delete(d.peers, r)
+			delete(d.versions, r)
+		}
+	}
+	for r := range d.links {
+		if !reachable[r] {
+			delete(d.links, r)
+		}
+	}
+	_, left = diff(before, d.online())
+	d.forget(left)
+	return left
+}
+
+//removeRouter removes closed router, returns peers left
+func (d *directory) removeRouter(router string) (left []string) {
+	d.Lock()
+	defer d.Unlock()
+	before := d.online()
+	delete(d.peers, router)
+	delete(d.links, router)
+	delete(d.versions, router)
+	_, left = diff(before, d.online())
+	d.forget(left)
+	return left
+}
+
+//online peer id -> attached routers
+func (d *directory) online() map[string][]string {
+	m := make(map[string][]string)
+	for router, ids := range d.peers {
+		for _, id := range ids {
+			m[id] = append(m[id], router)
+		}
+	}
+	return m
+}
+
+func diff(before, after map[string][]string) (joined, left []string) {
+	for id := range after {
+		if _, ok := before[id]; !ok {
+			joined = append(joined, id)
+		}
+	}
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			left = append(left, id)
+		}
+	}
+	sort.Strings(joined)
+	sort.Strings(left)
+	return joined, left
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package peer
+
+import "errors"
+
+var (
+	//ErrNotConnected no session to router is connected
+	ErrNotConnected = errors.New("peer: not connected")
+	//ErrClosed peer is closed
+	ErrClosed = errors.New("peer: closed")
+	//ErrTooLarge message exceeds maximum message size
+	ErrTooLarge = errors.New("peer: message too large")
+	//ErrNoRoute router has no route to destination
+	ErrNoRoute = errors.New("peer: no route to destination")
+	//ErrUnauthorized message is denied by router
+	ErrUnauthorized = errors.New("peer: unauthorized")
+	//ErrRouterClosed router is stopped
+	ErrRouterClosed = errors.New("peer: router closed")
+	//ErrKeepAliveTimeout no msg is received from router in 2 keepalive intervals
+	ErrKeepAliveTimeout = errors.New("peer: keepalive timeout")
+	//ErrDuplicateID peer id is in use by another process
+	ErrDuplicateID = errors.New("peer: duplicate id")
+	//ErrNoKey public key of destination or private key of sealing is unknown
+	ErrNoKey = errors.New("peer: no key for sealed payload")
+	//ErrKeyChanged destination announced a public key different from the one known while it is online
+	ErrKeyChanged = errors.New("peer: public key of destination changed")
+	//ErrSealBroken sealed payload fails to open
+	ErrSealBroken = errors.New("peer: sealed payload broken")
+	//ErrReplay id is received again through the same router, or sequence of source is received before or older than the replay window
+	ErrReplay = errors.New("peer: replayed message")
+	//ErrStale timestamp of message is outside clock skew tolerance
+	ErrStale = errors.New("peer: stale message")
+	//ErrGap ordered messages are missing after timeout and skipped
+	ErrGap = errors.New("peer: ordered messages lost")
+	//ErrExpired reliable message is not acked before it expires
+	ErrExpired = errors.New("peer: reliable message expired")
+	//ErrNotUnicast reliable message is not sent to a peer id
+	ErrNotUnicast = errors.New("peer: reliable message needs a peer id destination")
+	//ErrUndeliverable message is dropped by router failing to deliver it, or for unknown reason
+	ErrUndeliverable = errors.New("peer: message undeliverable")
+)
+
+//MsgID identifies message sent by peer
+type MsgID string
@@ -0,0 +1,105 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package peer
+
+import (
+	"sync"
+	"time"
+)
+
+//EventType type of peer event
+type EventType int
+
+//Peer events
+const (
+	EventConnected      EventType = iota //session connected to router
+	EventDisconnected                    //session disconnected from router
+	EventReconnecting                    //session is reconnecting, Attempt counts from 1
+	EventRouterSwitched                  //session moved from OldRouter to Router
+	EventPeerJoined                      //remote peer appears in directory
+	EventPeerLeft                        //remote peer disappears from directory
+	EventConflict                        //peer id is in use by another process, peer is stopped
+)
+
+var eventNames = map[EventType]string{
+	EventConnected:      "connected",
+	EventDisconnected:   "disconnected",
+	EventReconnecting:   "reconnecting",
+	EventRouterSwitched: "router_switched",
+	EventPeerJoined:     "peer_joined",
+	EventPeerLeft:       "peer_left",
+	EventConflict:       "conflict",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+//Event connection lifecycle or topology event of peer
+type Event struct {
+	Type      EventType
+	Time      time.Time
+	Router    string //router address of session
+	OldRouter string //previous router address of session, only for EventRouterSwitched
+	Attempt   int    //reconnect attempt, only for EventReconnecting
+	PeerID    string //remote peer id, only for EventPeerJoined, EventPeerLeft and EventConflict
+	Err       error  //cause of EventDisconnected, nil if closed by peer, ErrDuplicateID of EventConflict
+}
+
+//subscribers event fan-out, slow subscribers lose events instead of blocking network
+type subscribers struct {
+	chans map[chan Event]struct{}
+	sync.RWMutex
+}
+
+func (s *subscribers) subscribe(size int) (<-chan Event, func()) {
+	s.Lock()
+	defer s.Unlock()
+	if s.chans == nil {
+		s.chans = make(map[chan Event]struct{})
+	}
+	c := make(chan Event, size)
+	s.chans[c] = struct{}{}
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			s.Lock()
+			defer s.Unlock()
+			delete(s.chans, c)
+			close(c)
+		})
+	}
+}
+
+func (s *subscribers) publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s.RLock()
+	defer s.RUnlock()
+	for c := range s.chans {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
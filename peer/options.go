@@ -0,0 +1,276 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package peer
+
+import (
+	"crypto/ecdh"
+	"time"
+
+	"github.com/bocheninc/msg-net/config"
+	"github.com/bocheninc/msg-net/logger"
+	"github.com/bocheninc/msg-net/net/common"
+	pb "github.com/bocheninc/msg-net/protos"
+)
+
+//roles of peer in its chain
+const (
+	RoleValidator = pb.Peer_VALIDATOR
+	RoleObserver  = pb.Peer_OBSERVER
+)
+
+//Option configures peer created by Dial
+type Option func(*options)
+
+type options struct {
+	id                string
+	addresses         []string
+	handler           func(srcID, dstID string, payload []byte, signature []byte) error
+	errorHandler      func(MsgID, error)
+	keepAlive         time.Duration
+	dialTimeout       time.Duration
+	reconnectInterval time.Duration
+	reconnectMax      int //-1 retries forever
+	sessions          int
+	maxMsgSize        int
+	role              pb.Peer_Role
+	capabilities      []string
+	labels            map[string]string
+	sealKey           *ecdh.PrivateKey
+	keys              KeyRegistry
+	replay            bool
+	replayWindow      int
+	replaySkew        time.Duration
+	rejectHandler     func(srcID string, id MsgID, err error)
+	orderTimeout      time.Duration
+	outbox            Outbox
+	retransmit        time.Duration
+	retransmitMax     time.Duration
+	traceSample       float64
+}
+
+//SendOption configures a message sent
+type SendOption func(*sendOptions)
+
+type sendOptions struct {
+	ordered  bool
+	reliable bool
+	ttl      time.Duration
+	traced   bool
+}
+
+//Ordered delivers the message after the ordered messages sent before to the same destination,
+//missing ones are redelivered on request of the destination or skipped after its order timeout
+func Ordered() SendOption {
+	return func(o *sendOptions) { o.ordered = true }
+}
+
+//Reliable keeps the message in outbox and retransmits it until the destination acks it or ttl expires, default 10m if not positive.
+//Only messages to a peer id can be reliable, expiry is reported to the error handler with ErrExpired
+func Reliable(ttl time.Duration) SendOption {
+	return func(o *sendOptions) {
+		o.reliable = true
+		o.ttl = ttl
+		if ttl <= 0 {
+			o.ttl = defaultReliableTTL
+		}
+	}
+}
+
+//Traced samples the message for tracing, routers export spans of it if tracing is enabled, the trace id is the message id
+func Traced() SendOption {
+	return func(o *sendOptions) { o.traced = true }
+}
+
+//WithID sets peer id, chain id and node id joined by ":"
+func WithID(id string) Option {
+	return func(o *options) { o.id = id }
+}
+
+//WithRouters sets addresses of routers to connect
+func WithRouters(addresses ...string) Option {
+	return func(o *options) { o.addresses = append(o.addresses, addresses...) }
+}
+
+//WithHandler sets function that handles received chain messages
+func WithHandler(function func(srcID, dstID string, payload []byte, signature []byte) error) Option {
+	return func(o *options) { o.handler = function }
+}
+
+//WithErrorHandler sets function that is called when routers report sent message undeliverable with *UndeliverableError,
+//or when reliable message expires with ErrExpired or fails to be retransmitted, e.g. with ErrNoKey
+func WithErrorHandler(function func(MsgID, error)) Option {
+	return func(o *options) { o.errorHandler = function }
+}
+
+//WithKeepAlive sets keepalive interval, session without msg received in 2 intervals is reconnected
+func WithKeepAlive(d time.Duration) Option {
+	return func(o *options) { o.keepAlive = d }
+}
+
+//WithDialTimeout sets timeout of connecting to router
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) { o.dialTimeout = d }
+}
+
+//WithReconnect sets reconnect policy, max attempts every interval, retries forever if max is not positive
+func WithReconnect(interval time.Duration, max int) Option {
+	return func(o *options) {
+		o.reconnectInterval = interval
+		o.reconnectMax = max
+		if max <= 0 {
+			o.reconnectMax = -1
+		}
+	}
+}
+
+//WithSessions sets number of routers connected at once
+func WithSessions(n int) Option {
+	return func(o *options) { o.sessions = n }
+}
+
+//WithMaxMsgSize sets maximum size of chain message sent
+func WithMaxMsgSize(n int) Option {
+	return func(o *options) { o.maxMsgSize = n }
+}
+
+//WithRole sets role announced to routers
+func WithRole(role pb.Peer_Role) Option {
+	return func(o *options) { o.role = role }
+}
+
+//WithCapabilities adds capabilities announced to routers
+func WithCapabilities(capabilities ...string) Option {
+	return func(o *options) { o.capabilities = append(o.capabilities, capabilities...) }
+}
+
+//WithLabels adds labels announced to routers, used by label selectors
+func WithLabels(labels map[string]string) Option {
+	return func(o *options) {
+		if o.labels == nil {
+			o.labels = make(map[string]string)
+		}
+		for k, v := range labels {
+			o.labels[k] = v
+		}
+	}
+}
+
+//WithSealing seals payloads of unicast messages to the public key of destination, and opens sealed payloads by key.
+//The public key of key is announced to routers, payloads to a chain or selector are not sealed.
+//The first key announced by a peer is used until it goes offline, sending to it fails with ErrKeyChanged if it announces another.
+//Peers of other areas are summarized by routers without their keys, sending sealed to them fails with ErrNoKey unless WithKeyRegistry is set
+func WithSealing(key *ecdh.PrivateKey) Option {
+	return func(o *options) { o.sealKey = key }
+}
+
+//WithKeyRegistry sets registry of public keys of peers, keys announced through routers are not used then
+func WithKeyRegistry(keys KeyRegistry) Option {
+	return func(o *options) { o.keys = keys }
+}
+
+//WithReplayProtection rejects messages whose id is received again through the same router, whose sequence of source to
+//the destination is received before or older than window sequences,
+//or whose timestamp differs from local clock more than skew, defaults are 1024 sequences and 30s if not positive
+func WithReplayProtection(window int, skew time.Duration) Option {
+	return func(o *options) {
+		o.replay = true
+		o.replayWindow = window
+		o.replaySkew = skew
+	}
+}
+
+//WithOrderTimeout sets time ordered messages wait for missing ones before they are skipped, default 2s
+func WithOrderTimeout(d time.Duration) Option {
+	return func(o *options) { o.orderTimeout = d }
+}
+
+//WithOutbox sets outbox of reliable messages, e.g. NewFileOutbox to retransmit them after restart, default in memory
+func WithOutbox(outbox Outbox) Option {
+	return func(o *options) { o.outbox = outbox }
+}
+
+//WithRetransmit sets backoff of reliable messages, the interval doubles after each attempt up to max, defaults are 1s and 30s
+func WithRetransmit(interval, max time.Duration) Option {
+	return func(o *options) {
+		o.retransmit = interval
+		o.retransmitMax = max
+	}
+}
+
+//WithTraceSampling samples ratio of messages sent for tracing, see Traced
+func WithTraceSampling(ratio float64) Option {
+	return func(o *options) { o.traceSample = ratio }
+}
+
+//WithRejectHandler sets function that is called when received message is rejected, e.g. ErrReplay, ErrStale or ErrSealBroken,
+//or when ordered messages are lost with ErrGap
+func WithRejectHandler(function func(srcID string, id MsgID, err error)) Option {
+	return func(o *options) { o.rejectHandler = function }
+}
+
+//load fills options not set from configuration
+func (o *options) load() {
+	if o.keepAlive == 0 {
+		o.keepAlive = time.Second * 15
+		if d, err := time.ParseDuration(config.GetString("router.timeout.keepalive")); err == nil {
+			o.keepAlive = d
+		} else {
+			logger.Warnf("failed to parse router.timeout.keepalive, set default timeout 15s --- %v", err)
+		}
+	}
+	if o.dialTimeout == 0 {
+		o.dialTimeout = common.Deadline
+	}
+	if o.reconnectInterval == 0 {
+		o.reconnectInterval = time.Second * 5
+		if d, err := time.ParseDuration(config.GetString("router.reconnect.interval")); err == nil {
+			o.reconnectInterval = d
+		}
+	}
+	if o.reconnectMax == 0 {
+		o.reconnectMax = 5
+		if n := config.GetInt("router.reconnect.max"); n != 0 {
+			o.reconnectMax = n
+		}
+	}
+	if o.sessions <= 0 {
+		o.sessions = config.GetInt("peer.sessions")
+		if o.sessions <= 0 {
+			o.sessions = 1
+		}
+	}
+	if o.orderTimeout <= 0 {
+		o.orderTimeout = defaultOrderTimeout
+	}
+	if o.outbox == nil {
+		o.outbox = NewMemoryOutbox()
+	}
+	if o.retransmit <= 0 {
+		o.retransmit = defaultRetransmit
+	}
+	if o.retransmitMax < o.retransmit {
+		o.retransmitMax = defaultRetransmitMax
+		if o.retransmitMax < o.retransmit {
+			o.retransmitMax = o.retransmit
+		}
+	}
+	if o.maxMsgSize <= 0 || uint64(o.maxMsgSize) > common.MaxMsgSize() {
+		o.maxMsgSize = int(common.MaxMsgSize())
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package peer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bocheninc/msg-net/logger"
+	pb "github.com/bocheninc/msg-net/protos"
+)
+
+//defaultOrderTimeout missing ordered messages are skipped after the timeout, redelivery is requested 3 times within it
+const defaultOrderTimeout = 2 * time.Second
+
+//orderHistory ordered messages kept for redelivery per destination
+var orderHistory = 1024
+
+//orderBuffer out of order messages buffered per source, the gap is skipped when it is full
+var orderBuffer = 1024
+
+//orderKey ordered messages are numbered per source and destination
+func orderKey(src, dst string) string {
+	return src + "\x00" + dst
+}
+
+//sentPair ordered messages sent to a destination
+type sentPair struct {
+	last    uint64
+	history []sentMsg
+	sync.Mutex
+}
+
+type sentMsg struct {
+	order uint64
+	bytes []byte
+}
+
+//recvPair ordered messages received from a source
+type recvPair struct {
+	src      string
+	dst      string
+	epoch    int64
+	expected uint64
+	buffer   map[uint64]*pb.ChainMessage
+	gapSince time.Time
+	timer    *time.Timer
+	sync.Mutex
+}
+
+//orderer ordered delivery state of peer
+type orderer struct {
+	sent map[string]*sentPair
+	recv map[string]*recvPair
+	sync.Mutex
+}
+
+func newOrderer() *orderer {
+	return &orderer{sent: make(map[string]*sentPair), recv: make(map[string]*recvPair)}
+}
+
+func (o *orderer) sentPair(dst string) *sentPair {
+	o.Lock()
+	defer o.Unlock()
+	sp, ok := o.sent[dst]
+	if !ok {
+		sp = &sentPair{}
+		o.sent[dst] = sp
+	}
+	return sp
+}
+
+func (o *orderer) recvPair(src, dst string) *recvPair {
+	o.Lock()
+	defer o.Unlock()
+	key := orderKey(src, dst)
+	rp, ok := o.recv[key]
+	if !ok {
+		rp = &recvPair{src: src, dst: dst, buffer: make(map[uint64]*pb.ChainMessage)}
+		o.recv[key] = rp
+	}
+	return rp
+}
+
+//sendOrdered numbers chain message after the previous ordered one to the same destination and keeps it for redelivery
+func (p *Peer) sendOrdered(ctx context.Context, chainMsg *pb.ChainMessage) error {
+	sp := p.orders.sentPair(chainMsg.DstId)
+	sp.Lock()
+	defer sp.Unlock()
+	chainMsg.Order = sp.last + 1
+	chainMsg.OrderEpoch = p.started
+	var bytes []byte
+	var err error
+	if chainMsg.Reliable {
+		bytes, err = p.sendReliable(ctx, chainMsg)
+	} else {
+		bytes, err = p.post(ctx, chainMsg)
+	}
+	if err != nil {
+		return err
+	}
+	sp.last = chainMsg.Order
+	if bytes == nil {
+		//reliable msg not sent yet is retransmitted from outbox
+		return nil
+	}
+	sp.history = append(sp.history, sentMsg{order: chainMsg.Order, bytes: bytes})
+	if len(sp.history) > orderHistory {
+		sp.history = sp.history[len(sp.history)-orderHistory:]
+	}
+	return nil
+}
+
+//redeliver resends ordered messages to the destination requested from the order on
+func (p *Peer) redeliver(request *pb.ChainMessage) {
+	if request.OrderEpoch != p.started {
+		return
+	}
+	dst := string(request.Payload)
+	sp := p.orders.sentPair(dst)
+	sp.Lock()
+	defer sp.Unlock()
+	n := 0
+	for _, m := range sp.history {
+		if m.order >= request.Order {
+			if err := p.postRaw(context.Background(), m.bytes); err != nil {
+				logger.Warnf("peer %s failed to redeliver ordered msg %d to %s --- %v", p.id, m.order, dst, err)
+				return
+			}
+			n++
+		}
+	}
+	logger.Infof("peer %s redelivered %d ordered msgs to %s from %d on request of %s", p.id, n, dst, request.Order, request.SrcId)
+}
+
+//receiveOrdered delivers ordered message after the earlier ones of the same source and destination,
+//out of order ones are buffered and redelivery of the missing ones is requested
+func (p *Peer) receiveOrdered(chainMsg *pb.ChainMessage) {
+	rp := p.orders.recvPair(chainMsg.SrcId, chainMsg.DstId)
+	rp.Lock()
+	defer rp.Unlock()
+	if chainMsg.OrderEpoch > rp.epoch {
+		//source restarted
+		rp.epoch = chainMsg.OrderEpoch
+		rp.expected = 1
+		rp.buffer = make(map[uint64]*pb.ChainMessage)
+	} else if chainMsg.OrderEpoch < rp.epoch || chainMsg.Order < rp.expected {
+		logger.Debugf("peer %s drop late ordered msg %d from %s", p.id, chainMsg.Order, chainMsg.SrcId)
+		return
+	}
+	rp.buffer[chainMsg.Order] = chainMsg
+	if len(rp.buffer) > orderBuffer {
+		p.skipGap(rp)
+	}
+	p.drain(rp)
+}
+
+//drain delivers buffered messages in order, it watches the gap if some are missing
+func (p *Peer) drain(rp *recvPair) {
+	for {
+		chainMsg, ok := rp.buffer[rp.expected]
+		if !ok {
+			break
+		}
+		delete(rp.buffer, rp.expected)
+		rp.expected++
+		p.deliver(chainMsg)
+	}
+	if len(rp.buffer) == 0 {
+		if rp.timer != nil {
+			rp.timer.Stop()
+			rp.timer = nil
+		}
+		return
+	}
+	if rp.timer == nil {
+		rp.gapSince = time.Now()
+		rp.timer = time.AfterFunc(p.opts.orderTimeout/4, func() { p.checkGap(rp) })
+	}
+}
+
+//checkGap requests redelivery of missing messages, or skips them after timeout
+func (p *Peer) checkGap(rp *recvPair) {
+	rp.Lock()
+	defer rp.Unlock()
+	rp.timer = nil
+	if len(rp.buffer) == 0 || p.ctx.Err() != nil {
+		return
+	}
+	if time.Since(rp.gapSince) >= p.opts.orderTimeout {
+		p.skipGap(rp)
+		p.drain(rp)
+		return
+	}
+	request := &pb.ChainMessage{Id: newMsgID(), SrcId: p.id, DstId: rp.src, Kind: pb.ChainMessage_REDELIVER,
+		Order: rp.expected, OrderEpoch: rp.epoch, Payload: []byte(rp.dst)}
+	if _, err := p.post(context.Background(), request); err != nil {
+		logger.Warnf("peer %s failed to request redelivery from %s --- %v", p.id, rp.src, err)
+	}
+	rp.timer = time.AfterFunc(p.opts.orderTimeout/4, func() { p.checkGap(rp) })
+}
+
+//skipGap gives up the missing messages before the first buffered one
+func (p *Peer) skipGap(rp *recvPair) {
+	orders := []uint64{}
+	for order := range rp.buffer {
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i] < orders[j] })
+	logger.Warnf("peer %s lost ordered msgs %d-%d from %s", p.id, rp.expected, orders[0]-1, rp.src)
+	if p.opts.rejectHandler != nil {
+		p.opts.rejectHandler(rp.src, "", ErrGap)
+	}
+	rp.expected = orders[0]
+	rp.gapSince = time.Now()
+}
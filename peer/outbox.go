@@ -0,0 +1,219 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package peer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bocheninc/msg-net/util"
+)
+
+//outboxCompactThreshold number of appended records before the outbox file is rewritten with pending entries only
+var outboxCompactThreshold = 1024
+
+var errOutboxClosed = errors.New("peer: outbox is closed")
+
+//OutboxEntry reliable message not acknowledged by destination
+type OutboxEntry struct {
+	ID      string    `json:"id"`
+	Dst     string    `json:"dst"`
+	Msg     []byte    `json:"msg"` //chain message before it is stamped and sealed
+	Expires time.Time `json:"expires"`
+}
+
+//Outbox keeps reliable messages until they are acknowledged or expire
+type Outbox interface {
+	Put(entry *OutboxEntry) error
+	Delete(id string) error
+	List() ([]*OutboxEntry, error)
+}
+
+//MemoryOutbox outbox in memory, pending messages are lost if the process exits
+type MemoryOutbox struct {
+	entries map[string]*OutboxEntry
+	sync.Mutex
+}
+
+//NewMemoryOutbox creates outbox in memory
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{entries: make(map[string]*OutboxEntry)}
+}
+
+//Put adds entry
+func (o *MemoryOutbox) Put(entry *OutboxEntry) error {
+	o.Lock()
+	defer o.Unlock()
+	o.entries[entry.ID] = entry
+	return nil
+}
+
+//Delete removes entry of id
+func (o *MemoryOutbox) Delete(id string) error {
+	o.Lock()
+	defer o.Unlock()
+	delete(o.entries, id)
+	return nil
+}
+
+//List returns pending entries
+func (o *MemoryOutbox) List() ([]*OutboxEntry, error) {
+	o.Lock()
+	defer o.Unlock()
+	entries := []*OutboxEntry{}
+	for _, entry := range o.entries {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+type outboxRecord struct {
+	Put    *OutboxEntry `json:"put,omitempty"`
+	Delete string       `json:"delete,omitempty"`
+}
+
+//FileOutbox append-only file outbox, pending messages are retransmitted after the process restarts.
+//Payloads are stored as sent by the application, before they are sealed
+type FileOutbox struct {
+	path     string
+	file     *os.File
+	entries  map[string]*OutboxEntry
+	appended int
+	sync.Mutex
+}
+
+//NewFileOutbox opens the outbox file, creates it if not exist, and loads pending entries
+func NewFileOutbox(path string) (*FileOutbox, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	o := &FileOutbox{path: path, entries: make(map[string]*OutboxEntry)}
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	if err := o.compact(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+//Put adds entry
+func (o *FileOutbox) Put(entry *OutboxEntry) error {
+	o.Lock()
+	defer o.Unlock()
+	o.entries[entry.ID] = entry
+	return o.append(&outboxRecord{Put: entry})
+}
+
+//Delete removes entry of id
+func (o *FileOutbox) Delete(id string) error {
+	o.Lock()
+	defer o.Unlock()
+	if _, ok := o.entries[id]; !ok {
+		return nil
+	}
+	delete(o.entries, id)
+	return o.append(&outboxRecord{Delete: id})
+}
+
+//List returns pending entries
+func (o *FileOutbox) List() ([]*OutboxEntry, error) {
+	o.Lock()
+	defer o.Unlock()
+	entries := []*OutboxEntry{}
+	for _, entry := range o.entries {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+//Close closes the outbox file
+func (o *FileOutbox) Close() error {
+	o.Lock()
+	defer o.Unlock()
+	if o.file == nil {
+		return nil
+	}
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
+
+func (o *FileOutbox) load() error {
+	file, err := os.Open(o.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		r := &outboxRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			//torn write at the tail, the rest is discarded
+			break
+		}
+		if r.Put != nil {
+			o.entries[r.Put.ID] = r.Put
+		} else if r.Delete != "" {
+			delete(o.entries, r.Delete)
+		}
+	}
+	return nil
+}
+
+func (o *FileOutbox) append(r *outboxRecord) error {
+	if o.file == nil {
+		return errOutboxClosed
+	}
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := o.file.Write(append(bytes, '\n')); err != nil {
+		return err
+	}
+	o.appended++
+	if o.appended >= outboxCompactThreshold {
+		return o.compact()
+	}
+	return nil
+}
+
+//compact rewrites the file with pending entries only
+func (o *FileOutbox) compact() error {
+	records := []interface{}{}
+	for _, entry := range o.entries {
+		records = append(records, &outboxRecord{Put: entry})
+	}
+	var err error
+	o.file, err = util.RewriteJSONLines(o.path, o.file, records)
+	o.appended = 0
+	return err
+}
@@ -20,8 +20,15 @@ package peer
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	mrand "math/rand"
 	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"strings"
@@ -33,28 +40,61 @@ import (
 	pb "github.com/bocheninc/msg-net/protos"
 )
 
+//uniqueWindow received msg id is remembered within the window for deduplication
+var uniqueWindow = time.Minute
+
 //NewPeer create Peer instance
 func NewPeer(id string, addresses []string, function func(srcID, dstID string, payload []byte, signature []byte) error) *Peer {
 	//params verify
 	return &Peer{id: id, addresses: addresses, chainMessageHandle: function}
 }
 
-//Peer Define Peer class connected to Router
+//Peer Define Peer class connected to Routers, it keeps sessions to several routers at once
 type Peer struct {
 	id                 string
 	addresses          []string
 	chainMessageHandle func(srcID, dstID string, payload []byte, signature []byte) error
 
-	client                *tcp.Client
-	durationKeepAlive     time.Duration
-	timerKeepAliveTimeout *time.Timer
-	cancel                context.CancelFunc
-	index                 int
+	opts      options
+	instance  string //identifies the process among peers of the same id
+	started   int64
+	sessions  []*session
+	directory *directory
+	events    subscribers
+	ctx       context.Context
+	cancel    context.CancelFunc
+	index     int
+	dialing   chan struct{} //closed when reconnecting of all sessions not connected at start ends
+	sync.Mutex
+
+	msgUnique map[string]uniqueMsg
+	rwMsg     sync.Mutex
+	sequence  uint64 //last sequence sent, it starts from the start time so it grows across restarts
+	replay    *replayGuard
+	orders    *orderer
+	reliables *reliables
+
+	lookups  map[string]chan *pb.PeerLookup
+	rwLookup sync.RWMutex
+
+	closing   map[string]chan struct{} //local address of connection -> PEER_CLOSE waiting for ack
+	rwClosing sync.Mutex
+}
+
+//PeerInfo online peer and routers it is attached to
+type PeerInfo struct {
+	ID      string
+	Routers []string
 }
 
 //IsRunning Running or not
 func (p *Peer) IsRunning() bool {
-	return p.client != nil && p.client.IsConnected()
+	for _, s := range p.sessions {
+		if s.isConnected() {
+			return true
+		}
+	}
+	return false
 }
 
 //Start Start peer service
@@ -63,112 +103,194 @@ func (p *Peer) Start() bool {
 		logger.Warnf("peer %s is alreay running", p.id)
 		return true
 	}
-
-	if len(p.addresses) == 0 {
-		logger.Errorf("peer %s not specify addresses", p.id)
+	if err := p.start(); err != nil {
+		logger.Errorf("peer %s failed to start --- %v", p.id, err)
+		if p.cancel != nil {
+			p.cancel()
+		}
 		return false
 	}
+	return true
+}
 
-	//keepalive
-	p.durationKeepAlive = time.Second * 15
-	if d, err := time.ParseDuration(config.GetString("router.timeout.keepalive")); err == nil {
-		p.durationKeepAlive = d
-	} else {
-		logger.Warnf("failed to parse router.timeout.keepalive, set default timeout 5s --- %v", err)
+//start connects sessions to routers, sessions failed to connect keep reconnecting in background
+func (p *Peer) start() error {
+	if len(p.addresses) == 0 {
+		return fmt.Errorf("peer %s not specify addresses", p.id)
 	}
 
-	var conn net.Conn
-	for index, address := range p.addresses {
-		p.index = index
-		p.client = tcp.NewClient(address, func() common.IMsg {
-			return &pb.Message{}
-		}, p.handleMsg)
+	p.opts.load()
+	n := p.opts.sessions
+	if n > len(p.addresses) {
+		n = len(p.addresses)
+	}
 
-		if conn = p.client.Connect(); conn != nil {
-			break
-		}
-		logger.Warnf("peer %s failed to start to server address %s", p.id, address)
+	if p.instance == "" {
+		p.instance = newMsgID()
+		p.started = time.Now().UnixNano()
+		p.sequence = uint64(p.started)
 	}
-	p.timerKeepAliveTimeout = time.NewTimer(2 * p.durationKeepAlive)
-	if conn == nil {
-		logger.Errorf("peer %s failed to start", p.id)
-		return false
+	if p.opts.replay {
+		p.replay = newReplayGuard(p.opts.replayWindow, p.opts.replaySkew)
 	}
-
-	peer := pb.Peer{Id: p.id}
-	bytes, _ := peer.Serialize()
-	p.client.SendChannel() <- &pb.Message{Type: pb.Message_PEER_HELLO, Payload: bytes}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	p.cancel = cancel
-	go func(ctx context.Context) {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-p.timerKeepAliveTimeout.C:
-				if p.client != nil {
-					p.client.Disconnect()
-				}
-				go func(ctx context.Context) {
-					ctx0, cancel0 := context.WithCancel(ctx)
-					_ = cancel0
-					duration := time.Second * 5
-					if d, err := time.ParseDuration(config.GetString("router.reconnect.interval")); err == nil {
-						duration = d
-					}
-					max := 5
-					if n := config.GetInt("router.reconnect.max"); n != 0 {
-						max = n
-					}
-					for {
-						select {
-						case <-ctx0.Done():
-							return
-						default:
-						}
-						p.index = p.index + 1
-						if p.index == len(p.addresses) {
-							p.index = 0
-						}
-						for i := max; i > 0; i-- {
-							logger.Warnf("peer %s connection timeout， reconnecting", p.id)
-							address := p.addresses[p.index]
-							p.client = tcp.NewClient(address, func() common.IMsg {
-								return &pb.Message{}
-							}, p.handleMsg)
-							if conn := p.client.Connect(); conn != nil {
-								peer := pb.Peer{Id: p.id}
-								bytes, _ := peer.Serialize()
-								p.client.SendChannel() <- &pb.Message{Type: pb.Message_PEER_HELLO, Payload: bytes}
-								return
-							}
-							time.Sleep(duration)
-						}
-					}
-				}(ctx)
-			}
+	p.orders = newOrderer()
+	p.reliables = newReliables()
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.msgUnique = make(map[string]uniqueMsg)
+	p.directory = newDirectory()
+	p.lookups = make(map[string]chan *pb.PeerLookup)
+	p.closing = make(map[string]chan struct{})
+	p.sessions = nil
+	p.index = 0
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		s := &session{}
+		p.sessions = append(p.sessions, s)
+		if !p.connect(s, nil) {
+			wg.Add(1)
+			go func(s *session) {
+				defer wg.Done()
+				p.reconnect(s, nil)
+			}(s)
 		}
-	}(ctx)
+	}
+	p.dialing = make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(p.dialing)
+	}()
+	go p.monitor(p.ctx)
+	p.resume()
 
-	return true
+	if !p.IsRunning() {
+		return ErrNotConnected
+	}
+	return nil
 }
 
-//Send Send msg to Router
+//Send Send msg to Router by the healthiest session
 func (p *Peer) Send(id string, payload []byte, signature []byte) bool {
-	if !p.IsRunning() {
-		logger.Warnf("peer %s is alreay stopped", p.id)
+	if _, err := p.send(context.Background(), id, "", payload, signature); err != nil {
+		logger.Warnf("peer %s failed to send msg to %s --- %v", p.id, id, err)
 		return false
 	}
+	return true
+}
+
+func (p *Peer) send(ctx context.Context, id, selector string, payload []byte, signature []byte, opts ...SendOption) (MsgID, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if _, err := pb.ParseSelector(selector); err != nil {
+		return "", err
+	}
 	if !strings.Contains(id, ":") {
 		logger.Infof("broadcast all chain %s peers\n", id)
 		id = id + ":"
 	}
-	chainMsg := pb.ChainMessage{SrcId: p.id, DstId: id, Payload: payload, Signature: signature}
-	bytes, _ := chainMsg.Serialize()
-	p.client.SendChannel() <- &pb.Message{Type: pb.Message_CHAIN_MESSAGE, Payload: bytes}
+	o := sendOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	msgID := newMsgID()
+	chainMsg := &pb.ChainMessage{Id: msgID, SrcId: p.id, DstId: id, Selector: selector, Payload: payload, Signature: signature}
+	if o.traced || (p.opts.traceSample > 0 && mrand.Float64() < p.opts.traceSample) {
+		chainMsg.TraceId = msgID
+		chainMsg.Sampled = true
+	}
+	if o.reliable {
+		if !isUnicast(chainMsg) {
+			return "", ErrNotUnicast
+		}
+		chainMsg.Reliable = true
+		chainMsg.Expires = time.Now().Add(o.ttl).UnixNano()
+	}
+	var err error
+	switch {
+	case o.ordered:
+		err = p.sendOrdered(ctx, chainMsg)
+	case o.reliable:
+		_, err = p.sendReliable(ctx, chainMsg)
+	default:
+		_, err = p.post(ctx, chainMsg)
+	}
+	if err != nil {
+		return "", err
+	}
+	return MsgID(msgID), nil
+}
 
-	return true
+//post stamps, seals and sends chain message by the healthiest session, it returns payload of the msg sent
+func (p *Peer) post(ctx context.Context, chainMsg *pb.ChainMessage) ([]byte, error) {
+	chainMsg.Timestamp = time.Now().UnixNano()
+	chainMsg.Sequence = atomic.AddUint64(&p.sequence, 1)
+	if err := p.sealMsg(chainMsg); err != nil {
+		return nil, err
+	}
+	bytes, err := chainMsg.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes) > p.opts.maxMsgSize {
+		return nil, ErrTooLarge
+	}
+	return bytes, p.postRaw(ctx, bytes)
+}
+
+//postRaw sends serialized chain message by the healthiest session
+func (p *Peer) postRaw(ctx context.Context, bytes []byte) error {
+	s := p.healthiest()
+	if s == nil {
+		return ErrNotConnected
+	}
+	client, _ := s.getClient()
+	select {
+	case client.SendChannel() <- &pb.Message{Type: pb.Message_CHAIN_MESSAGE, Payload: bytes}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//Lookup lists online peers matching pattern and routers they are attached to, it waits for the router until ctx is done.
+//pattern is a peer id, or a chain id ending with ":" for all peers of the chain
+func (p *Peer) Lookup(ctx context.Context, pattern string) ([]PeerInfo, error) {
+	s := p.healthiest()
+	if s == nil {
+		return nil, ErrNotConnected
+	}
+	id := newMsgID()
+	bytes, err := (&pb.PeerLookup{Id: id, Pattern: pattern}).Serialize()
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan *pb.PeerLookup, 1)
+	p.rwLookup.Lock()
+	p.lookups[id] = c
+	p.rwLookup.Unlock()
+	defer func() {
+		p.rwLookup.Lock()
+		delete(p.lookups, id)
+		p.rwLookup.Unlock()
+	}()
+
+	client, _ := s.getClient()
+	select {
+	case client.SendChannel() <- &pb.Message{Type: pb.Message_PEER_LOOKUP, Payload: bytes}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case lookup := <-c:
+		peers := []PeerInfo{}
+		for _, peer := range lookup.Peers {
+			peers = append(peers, PeerInfo{ID: peer.Id, Routers: peer.Routers})
+		}
+		sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+		return peers, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 //Stop Stop peer service
@@ -176,14 +298,41 @@ func (p *Peer) Stop() {
 	if !p.IsRunning() {
 		logger.Warnf("peer %s is alreay stopped", p.id)
 	}
-	p.cancel()
+	if p.cancel != nil {
+		p.cancel()
+	}
 
-	peer := pb.Peer{Id: p.id}
-	bytes, _ := peer.Serialize()
-	p.client.SendChannel() <- &pb.Message{Type: pb.Message_PEER_CLOSE, Payload: bytes}
+	//sessions are closed together, acks of routers are waited under the same deadline
+	deadline := time.Now().Add(p.opts.dialTimeout)
+	var wg sync.WaitGroup
+	for _, s := range p.sessions {
+		if client, address := s.getClient(); client != nil && client.IsConnected() {
+			wg.Add(1)
+			go func(client *tcp.Client, address string) {
+				defer wg.Done()
+				p.close(client, deadline)
+				p.events.publish(Event{Type: EventDisconnected, Router: address})
+			}(client, address)
+		}
+	}
+	wg.Wait()
+}
+
+//Subscribe returns channel of peer events and function that cancels the subscription,
+//events are dropped when the channel is full
+func (p *Peer) Subscribe(size int) (<-chan Event, func()) {
+	return p.events.subscribe(size)
+}
 
-	p.client.Disconnect()
-	p.client = nil
+//info identity and metadata announced to routers in PEER_HELLO and PEER_CLOSE
+func (p *Peer) info() *pb.Peer {
+	peer := &pb.Peer{Id: p.id, Role: p.opts.role, Capabilities: p.opts.capabilities, Labels: p.opts.labels, Instance: p.instance, Started: p.started}
+	peer.ChainId = peer.Chain()
+	peer.NodeId = peer.Node()
+	if p.opts.sealKey != nil {
+		peer.PublicKey = p.opts.sealKey.PublicKey().Bytes()
+	}
+	return peer
 }
 
 //String Get Peer Infomation
@@ -191,6 +340,20 @@ func (p *Peer) String() string {
 	m := make(map[string]interface{})
 	m["id"] = p.id
 	m["addresses"] = p.addresses
+	sessions := []interface{}{}
+	for _, s := range p.sessions {
+		_, address := s.getClient()
+		sessions = append(sessions, map[string]interface{}{
+			"address":   address,
+			"connected": s.isConnected(),
+			"rtt":       s.getRTT().String(),
+		})
+	}
+	m["sessions"] = sessions
+	if p.replay != nil {
+		m["replay"] = p.replay.getStats()
+	}
+	m["pending"] = p.Pending()
 	bytes, err := json.Marshal(m)
 	if err != nil {
 		logger.Errorf("failed to json marshal --- %v\n", err)
@@ -198,35 +361,437 @@ func (p *Peer) String() string {
 	return string(bytes)
 }
 
-func (p *Peer) handleMsg(conn net.Conn, channel chan<- common.IMsg, m common.IMsg) error {
-	p.timerKeepAliveTimeout.Stop()
+//connect connects session to the first available router of candidates and configured addresses,
+//addresses used by other sessions and excluded addresses are skipped
+func (p *Peer) connect(s *session, candidates []string, excludes ...string) bool {
+	p.Lock()
+	for i := range p.addresses {
+		candidates = append(candidates, p.addresses[(p.index+i)%len(p.addresses)])
+	}
+	p.index = (p.index + 1) % len(p.addresses)
+	p.Unlock()
+
+	skip := make(map[string]bool)
+	for _, address := range excludes {
+		skip[address] = true
+	}
+	for _, other := range p.sessions {
+		if other != s && other.isConnected() {
+			_, address := other.getClient()
+			skip[address] = true
+		}
+	}
+
+	for _, address := range candidates {
+		if skip[address] {
+			continue
+		}
+		skip[address] = true
+		client := tcp.NewClient(address, func() common.IMsg {
+			return &pb.Message{}
+		}, func(conn net.Conn, channel chan<- common.IMsg, msg common.IMsg) error {
+			if msg.(*pb.Message).Type == pb.Message_PEER_CLOSE_ACK {
+				p.closeAck(conn.LocalAddr().String())
+				return nil
+			}
+			return p.handleMsg(s, channel, msg)
+		})
+		client.SetDialTimeout(p.opts.dialTimeout)
+		client.SetDisconnectHandle(func(conn net.Conn, err error) {
+			if current, address := s.getClient(); current == client {
+				p.events.publish(Event{Type: EventDisconnected, Router: address, Err: err})
+				go p.reconnect(s, err)
+			}
+		})
+		if conn := client.Connect(); conn == nil {
+			logger.Warnf("peer %s failed to connect to router %s", p.id, address)
+			continue
+		}
+		oldClient, oldAddress := s.getClient()
+		switched := oldClient != nil && oldClient.IsConnected() && oldAddress != address
+		s.setClient(address, client)
+		peer := p.info()
+		bytes, _ := peer.Serialize()
+		client.SendChannel() <- &pb.Message{Type: pb.Message_PEER_HELLO, Payload: bytes}
+		if oldClient != nil {
+			p.close(oldClient, time.Now().Add(p.opts.dialTimeout))
+		}
+		logger.Infof("peer %s connected to router %s", p.id, address)
+		if switched {
+			p.events.publish(Event{Type: EventRouterSwitched, Router: address, OldRouter: oldAddress})
+		} else {
+			p.events.publish(Event{Type: EventConnected, Router: address})
+		}
+		return true
+	}
+	return false
+}
+
+//reconnect replaces session broken by cause, it retries by reconnect policy
+func (p *Peer) reconnect(s *session, cause error) {
+	if p.ctx.Err() != nil || !s.startReconnect() {
+		return
+	}
+	defer s.stopReconnect()
+
+	client, address := s.getClient()
+	if client != nil && client.IsConnected() {
+		logger.Warnf("peer %s connection to router %s broken, reconnecting --- %v", p.id, address, cause)
+		client.Disconnect()
+		p.events.publish(Event{Type: EventDisconnected, Router: address, Err: cause})
+	}
+	for attempt := 1; p.opts.reconnectMax < 0 || attempt <= p.opts.reconnectMax; attempt++ {
+		p.events.publish(Event{Type: EventReconnecting, Router: address, Attempt: attempt})
+		if p.connect(s, nil) {
+			return
+		}
+		logger.Warnf("peer %s failed to reconnect, attempt %d", p.id, attempt)
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(p.opts.reconnectInterval):
+		}
+	}
+}
+
+//monitor sends keepalive and reconnects sessions without msg received in 2 keepalive durations
+func (p *Peer) monitor(ctx context.Context) {
+	ticker := time.NewTicker(p.opts.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, s := range p.sessions {
+				if s.isHealthy(2 * p.opts.keepAlive) {
+					client, _ := s.getClient()
+					s.keepAlive()
+					client.SendChannel() <- &pb.Message{Type: pb.Message_KEEPALIVE}
+				} else {
+					go p.reconnect(s, ErrKeepAliveTimeout)
+				}
+			}
+			p.msgUniquePrune(time.Now())
+			if p.replay != nil {
+				p.replay.prune(time.Now())
+			}
+		}
+	}
+}
+
+//healthiest returns connected session with the lowest keepalive round trip time, healthy sessions are preferred
+func (p *Peer) healthiest() *session {
+	var best *session
+	bestHealthy := false
+	for _, s := range p.sessions {
+		if !s.isConnected() {
+			continue
+		}
+		healthy := s.isHealthy(2 * p.opts.keepAlive)
+		if best != nil && bestHealthy && !healthy {
+			continue
+		}
+		if best != nil && healthy == bestHealthy {
+			if rtt, bestRTT := s.getRTT(), best.getRTT(); rtt == 0 || (bestRTT != 0 && rtt >= bestRTT) {
+				continue
+			}
+		}
+		best, bestHealthy = s, healthy
+	}
+	return best
+}
+
+//close says PEER_CLOSE and waits the ack of router until the deadline before disconnecting,
+//so the router runs graceful close instead of the disconnect path
+func (p *Peer) close(client *tcp.Client, deadline time.Time) {
+	if !client.IsConnected() {
+		return
+	}
+	peer := p.info()
+	bytes, _ := peer.Serialize()
+	key := client.LocalAddr()
+	acked := make(chan struct{})
+	p.rwClosing.Lock()
+	p.closing[key] = acked
+	p.rwClosing.Unlock()
+	client.SendChannel() <- &pb.Message{Type: pb.Message_PEER_CLOSE, Payload: bytes}
+	select {
+	case <-acked:
+	case <-time.After(time.Until(deadline)):
+		logger.Warnf("peer %s closes connection %s without ack of router", p.id, key)
+	}
+	p.rwClosing.Lock()
+	delete(p.closing, key)
+	p.rwClosing.Unlock()
+	client.Disconnect()
+}
+
+func (p *Peer) closeAck(key string) {
+	p.rwClosing.Lock()
+	defer p.rwClosing.Unlock()
+	if acked, ok := p.closing[key]; ok {
+		delete(p.closing, key)
+		close(acked)
+	}
+}
+
+func (p *Peer) handleMsg(s *session, channel chan<- common.IMsg, m common.IMsg) error {
+	s.recv()
 
 	msg := m.(*pb.Message)
 	switch msg.Type {
 	case pb.Message_ROUTER_CLOSE:
+		router := &pb.Router{}
+		if err := router.Deserialize(msg.Payload); err != nil {
+			return err
+		}
+		p.publishPeers(EventPeerLeft, p.directory.removeRouter(router.Address))
+		if router.Address == s.getRouter() {
+			go p.reconnect(s, ErrRouterClosed)
+		}
 	case pb.Message_PEER_HELLO_ACK:
+		router := &pb.Router{}
+		if err := router.Deserialize(msg.Payload); err != nil {
+			return err
+		}
+		s.setRouter(router.Address)
 	case pb.Message_KEEPALIVE:
-		p.client.SendChannel() <- &pb.Message{Type: pb.Message_KEEPALIVE_ACK, Payload: nil}
+		channel <- &pb.Message{Type: pb.Message_KEEPALIVE_ACK, Payload: nil}
 	case pb.Message_KEEPALIVE_ACK:
+		s.keepAliveAck()
 	case pb.Message_PEER_SYNC:
+		peers := &pb.Peers{}
+		if err := peers.Deserialize(msg.Payload); err != nil {
+			return err
+		}
+		joined, left, ok := p.directory.applyPeers(peers)
+		if !ok {
+			p.requestResync(s, peers.Id)
+		}
+		p.publishPeers(EventPeerJoined, joined)
+		p.publishPeers(EventPeerLeft, left)
+	case pb.Message_PEER_DIGEST:
+		digest := &pb.PeerDigest{}
+		if err := digest.Deserialize(msg.Payload); err != nil {
+			return err
+		}
+		if !p.directory.checkDigest(digest) {
+			p.requestResync(s, digest.Id)
+		}
 	case pb.Message_ROUTER_SYNC:
+		routers := &pb.Routers{}
+		if err := routers.Deserialize(msg.Payload); err != nil {
+			return err
+		}
+		addresses := []string{}
+		for _, router := range routers.Routers {
+			addresses = append(addresses, router.Address)
+		}
+		roots := []string{}
+		for _, s := range p.sessions {
+			if router := s.getRouter(); router != "" && s.isConnected() {
+				roots = append(roots, router)
+			}
+		}
+		p.publishPeers(EventPeerLeft, p.directory.updateLinks(routers.Id, addresses, roots))
 	case pb.Message_ROUTER_GET:
+	case pb.Message_PEER_LOOKUP_ACK:
+		lookup := &pb.PeerLookup{}
+		if err := lookup.Deserialize(msg.Payload); err != nil {
+			return err
+		}
+		p.rwLookup.RLock()
+		if c, ok := p.lookups[lookup.Id]; ok {
+			select {
+			case c <- lookup:
+			default:
+			}
+		}
+		p.rwLookup.RUnlock()
+	case pb.Message_PEER_MIGRATE:
+		routers := &pb.Routers{}
+		if err := routers.Deserialize(msg.Payload); err != nil {
+			return err
+		}
+		go p.migrate(s, routers)
+	case pb.Message_PEER_CONFLICT:
+		winner := &pb.Peer{}
+		if err := winner.Deserialize(msg.Payload); err != nil {
+			return err
+		}
+		_, address := s.getClient()
+		logger.Errorf("peer %s is dropped by router %s, id is in use by instance %s", p.id, address, winner.Instance)
+		p.events.publish(Event{Type: EventConflict, Router: address, PeerID: winner.Id, Err: ErrDuplicateID})
+		go p.Stop()
 	case pb.Message_CHAIN_MESSAGE:
 		chainMsg := &pb.ChainMessage{}
 		if err := chainMsg.Deserialize(msg.Payload); err != nil {
 			return err
 		}
-		if err := p.chainMessageHandle(chainMsg.SrcId, chainMsg.DstId, chainMsg.Payload, chainMsg.Signature); err != nil {
+		//the same msg arrives from every router the peer is connected to, reliable msg is remembered until it expires
+		//and its retransmissions are acked again in case the ack is lost
+		until := time.Now().Add(uniqueWindow)
+		if expires := time.Unix(0, chainMsg.Expires); chainMsg.Reliable && expires.After(until) {
+			until = expires
+		}
+		if chainMsg.Id != "" {
+			//copies come once through each session, another one through the same session is replayed,
+			//except ordered msgs which are redelivered on request of the gap
+			if first, ok := p.msgUniqueAdd(chainMsg.Id, until, s); !ok {
+				if chainMsg.Reliable && chainMsg.Kind == pb.ChainMessage_DATA {
+					go p.ack(chainMsg)
+				} else if p.replay != nil && first == s && chainMsg.Order == 0 {
+					p.replay.replayed()
+					p.reject(chainMsg, ErrReplay)
+					return nil
+				}
+				logger.Debugf("peer %s drop duplicate msg %s from %s", p.id, chainMsg.Id, chainMsg.SrcId)
+				return nil
+			}
+		}
+		if chainMsg.Sealed {
+			if err := open(chainMsg, p.opts.sealKey); err != nil {
+				p.reject(chainMsg, err)
+				return nil
+			}
+		}
+		if p.replay != nil {
+			if err := p.replay.check(chainMsg.SrcId, chainMsg.DstId, chainMsg.Timestamp, chainMsg.Sequence, time.Now()); err != nil {
+				p.reject(chainMsg, err)
+				return nil
+			}
+		}
+		if chainMsg.Reliable && chainMsg.Kind == pb.ChainMessage_DATA {
+			go p.ack(chainMsg)
+		}
+		switch {
+		case chainMsg.Kind == pb.ChainMessage_REDELIVER:
+			go p.redeliver(chainMsg)
+		case chainMsg.Kind == pb.ChainMessage_ACK:
+			p.acked(chainMsg)
+		case chainMsg.Order > 0:
+			p.receiveOrdered(chainMsg)
+		default:
+			return p.deliver(chainMsg)
+		}
+	case pb.Message_DEAD_LETTER:
+		notice := &pb.DeadLetter{}
+		if err := notice.Deserialize(msg.Payload); err != nil {
 			return err
 		}
+		p.undeliverable(notice)
 	default:
 		logger.Errorf("unsupport message type --- %v", msg.Type)
 	}
 
-	p.timerKeepAliveTimeout.Reset(2 * p.durationKeepAlive)
 	return nil
 }
 
+//deliver hands received message to the handler
+func (p *Peer) deliver(chainMsg *pb.ChainMessage) error {
+	return p.chainMessageHandle(chainMsg.SrcId, chainMsg.DstId, chainMsg.Payload, chainMsg.Signature)
+}
+
+//reject drops received message and reports it, retransmissions of rejected reliable message are accepted
+func (p *Peer) reject(chainMsg *pb.ChainMessage, err error) {
+	if chainMsg.Reliable {
+		p.msgUniqueRemove(chainMsg.Id)
+	}
+	logger.Warnf("peer %s drop msg %s from %s --- %v", p.id, chainMsg.Id, chainMsg.SrcId, err)
+	if p.opts.rejectHandler != nil {
+		p.opts.rejectHandler(chainMsg.SrcId, MsgID(chainMsg.Id), err)
+	}
+}
+
+//ReplayStats returns counters of replay protection
+func (p *Peer) ReplayStats() ReplayStats {
+	if p.replay == nil {
+		return ReplayStats{}
+	}
+	return p.replay.getStats()
+}
+
+//requestResync asks the router of peer table for full snapshot through session
+func (p *Peer) requestResync(s *session, router string) {
+	if !p.directory.requestResync(router) {
+		return
+	}
+	client, _ := s.getClient()
+	if client == nil {
+		return
+	}
+	bytes, _ := (&pb.PeerDigest{Id: router}).Serialize()
+	msg := &pb.Message{Type: pb.Message_PEER_RESYNC, Payload: bytes}
+	msg.Metadata = []byte(time.Now().String() + ":" + p.id)
+	select {
+	case client.SendChannel() <- msg:
+	default:
+	}
+}
+
+func (p *Peer) publishPeers(t EventType, ids []string) {
+	for _, id := range ids {
+		if id != p.id {
+			p.events.publish(Event{Type: t, PeerID: id})
+		}
+	}
+}
+
+//migrate moves the session away from the draining router, the candidates are routers advised by it and then the configured addresses
+func (p *Peer) migrate(s *session, routers *pb.Routers) {
+	addresses := []string{}
+	for _, router := range routers.Routers {
+		addresses = append(addresses, router.Address)
+	}
+	_, current := s.getClient()
+	if !p.connect(s, addresses, routers.Id, current) {
+		logger.Errorf("peer %s failed to migrate from router %s, no router available", p.id, routers.Id)
+		return
+	}
+	logger.Infof("peer %s migrated from router %s", p.id, routers.Id)
+}
+
+//uniqueMsg received msg id is remembered until the time with the session it came first
+type uniqueMsg struct {
+	until time.Time
+	s     *session
+}
+
+//msgUniqueAdd records msg id received by session until the time, returns false and the session it came first
+//if it is already received
+func (p *Peer) msgUniqueAdd(id string, until time.Time, s *session) (*session, bool) {
+	p.rwMsg.Lock()
+	defer p.rwMsg.Unlock()
+	if u, ok := p.msgUnique[id]; ok {
+		return u.s, false
+	}
+	p.msgUnique[id] = uniqueMsg{until: until, s: s}
+	return s, true
+}
+
+func (p *Peer) msgUniqueRemove(id string) {
+	p.rwMsg.Lock()
+	defer p.rwMsg.Unlock()
+	delete(p.msgUnique, id)
+}
+
+func (p *Peer) msgUniquePrune(now time.Time) {
+	p.rwMsg.Lock()
+	defer p.rwMsg.Unlock()
+	for id, u := range p.msgUnique {
+		if now.After(u.until) {
+			delete(p.msgUnique, id)
+		}
+	}
+}
+
+func newMsgID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
 //SetLogOut set log out path
 func SetLogOut(dir string) {
 	config.Set("logger.out", dir)
@@ -19,13 +19,24 @@
 package peer
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"fmt"
 
 	"github.com/bocheninc/msg-net/config"
+	pb "github.com/bocheninc/msg-net/protos"
 	"github.com/bocheninc/msg-net/router"
+	"github.com/bocheninc/msg-net/router/audit"
 )
 
 func initTestConfig() {
@@ -191,3 +202,1358 @@ func TestBroadcastPeer(t *testing.T) {
 	p0.Stop()
 	p1.Stop()
 }
+
+func TestPeerMigrate(t *testing.T) {
+	initTestConfig()
+	config.Set("router.timeout.drain", "5s")
+
+	r := router.NewRouter("00", "0.0.0.0:8006")
+	go r.Start()
+	time.Sleep(time.Second)
+
+	config.Set("router.discovery", "0.0.0.0:8006")
+	r1 := router.NewRouter("01", "0.0.0.0:8007")
+	go r1.Start()
+	time.Sleep(time.Second)
+
+	p0 := NewPeer("00:8006", []string{"0.0.0.0:8006"}, chainMessageHandle)
+	p0.Start()
+	recv := make(chan string, 1)
+	p1 := NewPeer("01:8007", []string{"0.0.0.0:8007"}, func(srcID, dstID string, payload []byte, signature []byte) error {
+		recv <- string(payload)
+		return nil
+	})
+	p1.Start()
+	time.Sleep(time.Second)
+
+	start := time.Now()
+	r.Drain()
+	if d := time.Since(start); d > 6*time.Second {
+		t.Fatalf("drain exceeds deadline, %s", d)
+	}
+	time.Sleep(time.Second)
+	if client, _ := p0.sessions[0].getClient(); !strings.HasSuffix(client.RemoteAddr(), ":8007") {
+		t.Fatalf("peer is not migrated, connected to %s", client.RemoteAddr())
+	}
+
+	p0.Send("01:8007", []byte("8006-->8007"), nil)
+	select {
+	case payload := <-recv:
+		if payload != "8006-->8007" {
+			t.Fatalf("unexpected payload %s", payload)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("message is not delivered after migration")
+	}
+
+	p0.Stop()
+	p1.Stop()
+	r1.Stop()
+	config.Set("router.timeout.drain", "30s")
+}
+
+func TestPeerMultiHoming(t *testing.T) {
+	initTestConfig()
+
+	r := router.NewRouter("00", "0.0.0.0:8008")
+	go r.Start()
+	time.Sleep(time.Second)
+
+	config.Set("router.discovery", "0.0.0.0:8008")
+	r1 := router.NewRouter("01", "0.0.0.0:8009")
+	go r1.Start()
+	time.Sleep(time.Second)
+
+	config.Set("peer.sessions", 2)
+	recv := make(chan string, 10)
+	p0 := NewPeer("00:p0", []string{"0.0.0.0:8008", "0.0.0.0:8009"}, func(srcID, dstID string, payload []byte, signature []byte) error {
+		recv <- string(payload)
+		return nil
+	})
+	p0.Start()
+	p1 := NewPeer("01:p1", []string{"0.0.0.0:8009"}, chainMessageHandle)
+	p1.Start()
+	time.Sleep(2 * time.Second)
+
+	connected := 0
+	for _, s := range p0.sessions {
+		if s.isConnected() {
+			connected++
+		}
+	}
+	if connected != 2 {
+		t.Fatalf("expect 2 sessions, got %d --- %s", connected, p0.String())
+	}
+
+	p1.Send("00:p0", []byte("first"), nil)
+	time.Sleep(time.Second)
+	if n := len(recv); n != 1 {
+		t.Fatalf("expect msg delivered once, got %d", n)
+	}
+	<-recv
+
+	//one router fails, the other session still delivers
+	r.Stop()
+	time.Sleep(time.Second)
+	p1.Send("00:p0", []byte("second"), nil)
+	select {
+	case payload := <-recv:
+		if payload != "second" {
+			t.Fatalf("unexpected payload %s", payload)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("message is not delivered after router failure")
+	}
+
+	p0.Stop()
+	p1.Stop()
+	r1.Stop()
+}
+
+func TestDial(t *testing.T) {
+	initTestConfig()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	if _, err := Dial(ctx, WithID("00:p0"), WithRouters("0.0.0.0:8012"), WithReconnect(100*time.Millisecond, 0)); err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded without router, got %v", err)
+	}
+	cancel()
+	if _, err := Dial(context.Background(), WithID("00:p0"), WithRouters("0.0.0.0:8012"), WithReconnect(100*time.Millisecond, 2)); err != ErrNotConnected {
+		t.Fatalf("expect %v when reconnecting gives up, got %v", ErrNotConnected, err)
+	}
+	if _, err := Dial(context.Background(), WithRouters("0.0.0.0:8012")); err == nil {
+		t.Fatal("expect error without id")
+	}
+
+	r := router.NewRouter("00", "0.0.0.0:8012")
+	go r.Start()
+	time.Sleep(time.Second)
+
+	recv := make(chan string, 1)
+	c0, err := Dial(context.Background(), WithID("00:p0"), WithRouters("0.0.0.0:8012"), WithMaxMsgSize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, err := Dial(context.Background(), WithID("00:p1"), WithRouters("0.0.0.0:8012"), WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+		recv <- string(payload)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	if id, err := c0.Send(context.Background(), "00:p1", []byte("hello"), nil); err != nil || id == "" {
+		t.Fatalf("failed to send --- %v", err)
+	}
+	select {
+	case payload := <-recv:
+		if payload != "hello" {
+			t.Fatalf("unexpected payload %s", payload)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("message is not delivered")
+	}
+	if _, err := c0.Send(context.Background(), "00:p1", make([]byte, 2048), nil); err != ErrTooLarge {
+		t.Fatalf("expect too large, got %v", err)
+	}
+
+	if err := c0.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c0.Close(); err != ErrClosed {
+		t.Fatalf("expect closed, got %v", err)
+	}
+	if _, err := c0.Send(context.Background(), "00:p1", []byte("hello"), nil); err != ErrClosed {
+		t.Fatalf("expect closed, got %v", err)
+	}
+	c1.Close()
+	r.Stop()
+
+	//stop before start
+	NewPeer("00:p2", []string{"0.0.0.0:8012"}, chainMessageHandle).Stop()
+}
+
+func TestPeerEvents(t *testing.T) {
+	initTestConfig()
+
+	r := router.NewRouter("00", "0.0.0.0:8013")
+	go r.Start()
+	time.Sleep(time.Second)
+
+	p0 := NewPeer("00:p0", []string{"0.0.0.0:8013"}, chainMessageHandle)
+	p0.opts.reconnectInterval = 100 * time.Millisecond
+	events, cancel := p0.Subscribe(100)
+	defer cancel()
+	expect := func(typ EventType, check func(Event) bool) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case e := <-events:
+				if e.Type == typ && (check == nil || check(e)) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("event %s is not received", typ)
+			}
+		}
+	}
+
+	p0.Start()
+	expect(EventConnected, nil)
+
+	p1 := NewPeer("00:p1", []string{"0.0.0.0:8013"}, chainMessageHandle)
+	p1.Start()
+	expect(EventPeerJoined, func(e Event) bool { return e.PeerID == "00:p1" })
+	p1.Stop()
+	expect(EventPeerLeft, func(e Event) bool { return e.PeerID == "00:p1" })
+
+	r.Stop()
+	expect(EventDisconnected, nil)
+	expect(EventReconnecting, func(e Event) bool { return e.Attempt == 1 })
+
+	p0.Stop()
+}
+
+func TestPeerLookup(t *testing.T) {
+	initTestConfig()
+
+	r := router.NewRouter("00", "0.0.0.0:8014")
+	go r.Start()
+	time.Sleep(time.Second)
+	config.Set("router.discovery", "0.0.0.0:8014")
+	r1 := router.NewRouter("01", "0.0.0.0:8015")
+	go r1.Start()
+	time.Sleep(time.Second)
+
+	p0 := NewPeer("00:p0", []string{"0.0.0.0:8014"}, chainMessageHandle)
+	p0.Start()
+	p1 := NewPeer("01:p1", []string{"0.0.0.0:8015"}, chainMessageHandle)
+	p1.Start()
+	p2 := NewPeer("01:p2", []string{"0.0.0.0:8015"}, chainMessageHandle)
+	p2.Start()
+	time.Sleep(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	peers, err := p0.Lookup(ctx, "01:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 || peers[0].ID != "01:p1" || peers[1].ID != "01:p2" {
+		t.Fatalf("unexpected lookup result %v", peers)
+	}
+	if len(peers[0].Routers) != 1 || peers[0].Routers[0] != "0.0.0.0:8015" {
+		t.Fatalf("unexpected routers %v", peers[0].Routers)
+	}
+	if peers, err := p0.Lookup(ctx, "00:p0"); err != nil || len(peers) != 1 {
+		t.Fatalf("unexpected lookup result %v --- %v", peers, err)
+	}
+	if peers, err := p0.Lookup(ctx, "02:"); err != nil || len(peers) != 0 {
+		t.Fatalf("unexpected lookup result %v --- %v", peers, err)
+	}
+
+	p0.Stop()
+	p1.Stop()
+	p2.Stop()
+	r1.Stop()
+	r.Stop()
+}
+
+func TestPeerSelector(t *testing.T) {
+	initTestConfig()
+
+	r := router.NewRouter("00", "0.0.0.0:8016")
+	go r.Start()
+	time.Sleep(time.Second)
+	config.Set("router.discovery", "0.0.0.0:8016")
+	r1 := router.NewRouter("01", "0.0.0.0:8017")
+	go r1.Start()
+	time.Sleep(time.Second)
+
+	recv := make(chan string, 10)
+	handler := func(srcID, dstID string, payload []byte, signature []byte) error {
+		recv <- string(payload)
+		return nil
+	}
+	dial := func(id, address string, opts ...Option) *Client {
+		c, err := Dial(context.Background(), append(opts, WithID(id), WithRouters(address), WithSessions(1))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	src := dial("00:src", "0.0.0.0:8016")
+	v1 := dial("01:v1", "0.0.0.0:8017", WithRole(RoleValidator), WithLabels(map[string]string{"region": "eu"}), WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+		return handler(srcID, dstID, append([]byte("v1 "), payload...), signature)
+	}))
+	v2 := dial("01:v2", "0.0.0.0:8016", WithRole(RoleValidator), WithLabels(map[string]string{"region": "us"}), WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+		return handler(srcID, dstID, append([]byte("v2 "), payload...), signature)
+	}))
+	o1 := dial("01:o1", "0.0.0.0:8017", WithRole(RoleObserver), WithCapabilities("archive"), WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+		return handler(srcID, dstID, append([]byte("o1 "), payload...), signature)
+	}))
+	time.Sleep(2 * time.Second)
+
+	expect := func(want ...string) {
+		got := map[string]bool{}
+		timeout := time.After(3 * time.Second)
+		for len(got) < len(want) {
+			select {
+			case payload := <-recv:
+				got[payload] = true
+			case <-timeout:
+				t.Fatalf("expect %v, got %v", want, got)
+			}
+		}
+		select {
+		case payload := <-recv:
+			t.Fatalf("unexpected message %s", payload)
+		case <-time.After(500 * time.Millisecond):
+		}
+		for _, w := range want {
+			if !got[w] {
+				t.Fatalf("expect %v, got %v", want, got)
+			}
+		}
+	}
+	if _, err := src.Multicast(context.Background(), "01", "role=validator", []byte("validators"), nil); err != nil {
+		t.Fatal(err)
+	}
+	expect("v1 validators", "v2 validators")
+	if _, err := src.Multicast(context.Background(), "01", "role=validator,region=eu", []byte("eu"), nil); err != nil {
+		t.Fatal(err)
+	}
+	expect("v1 eu")
+	if _, err := src.Multicast(context.Background(), "01", "capability=archive", []byte("archive"), nil); err != nil {
+		t.Fatal(err)
+	}
+	expect("o1 archive")
+	if _, err := src.Multicast(context.Background(), "01", "role=leader", []byte("invalid"), nil); err == nil {
+		t.Fatal("expect error of invalid selector")
+	}
+
+	src.Close()
+	v1.Close()
+	v2.Close()
+	o1.Close()
+	r1.Stop()
+	r.Stop()
+}
+
+func TestPeerDuplicateID(t *testing.T) {
+	initTestConfig()
+	defer config.Set("router.duplicate", "reject")
+
+	r := router.NewRouter("00", "0.0.0.0:8018")
+	go r.Start()
+	time.Sleep(time.Second)
+	config.Set("router.discovery", "0.0.0.0:8018")
+	r1 := router.NewRouter("01", "0.0.0.0:8019")
+	go r1.Start()
+	time.Sleep(time.Second)
+	conflicts := make(chan *router.Conflict, 10)
+	r.OnConflict(func(c *router.Conflict) { conflicts <- c })
+	r1.OnConflict(func(c *router.Conflict) { conflicts <- c })
+
+	expectConflict := func(p *Peer, events <-chan Event) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case e := <-events:
+				if e.Type == EventConflict {
+					if e.Err != ErrDuplicateID {
+						t.Fatalf("unexpected conflict error %v", e.Err)
+					}
+					select {
+					case <-conflicts:
+					case <-timeout:
+						t.Fatal("conflict alert is not raised")
+					}
+					time.Sleep(500 * time.Millisecond)
+					if p.IsRunning() {
+						t.Fatal("peer of duplicate id is still running")
+					}
+					return
+				}
+			case <-timeout:
+				t.Fatal("event conflict is not received")
+			}
+		}
+	}
+
+	//reject the newcomer on the same router
+	config.Set("router.duplicate", "reject")
+	p0 := NewPeer("00:p", []string{"0.0.0.0:8018"}, chainMessageHandle)
+	p0.Start()
+	time.Sleep(500 * time.Millisecond)
+	p1 := NewPeer("00:p", []string{"0.0.0.0:8018"}, chainMessageHandle)
+	events1, cancel1 := p1.Subscribe(10)
+	defer cancel1()
+	p1.Start()
+	expectConflict(p1, events1)
+	if !p0.IsRunning() {
+		t.Fatal("old peer is dropped by reject policy")
+	}
+
+	//evict the old session attached to another router
+	config.Set("router.duplicate", "evict")
+	events0, cancel0 := p0.Subscribe(10)
+	defer cancel0()
+	p2 := NewPeer("00:p", []string{"0.0.0.0:8019"}, chainMessageHandle)
+	p2.Start()
+	expectConflict(p0, events0)
+	if !p2.IsRunning() {
+		t.Fatal("new peer is dropped by evict policy")
+	}
+	if r.Conflicts() != 2 {
+		t.Fatalf("expect 2 conflicts at router, got %d", r.Conflicts())
+	}
+
+	p2.Stop()
+	r1.Stop()
+	r.Stop()
+}
+
+func TestPeerTableResync(t *testing.T) {
+	initTestConfig()
+
+	r := router.NewRouter("00", "0.0.0.0:8020")
+	go r.Start()
+	time.Sleep(time.Second)
+	p0 := NewPeer("00:p0", []string{"0.0.0.0:8020"}, chainMessageHandle)
+	p0.Start()
+	time.Sleep(500 * time.Millisecond)
+
+	//r1 joins after the first delta of r
+	config.Set("router.discovery", "0.0.0.0:8020")
+	r1 := router.NewRouter("01", "0.0.0.0:8021")
+	go r1.Start()
+	time.Sleep(time.Second)
+	p1 := NewPeer("00:p1", []string{"0.0.0.0:8020"}, chainMessageHandle)
+	p1.Start()
+	p2 := NewPeer("01:p2", []string{"0.0.0.0:8021"}, chainMessageHandle)
+	p2.Start()
+	time.Sleep(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	peers, err := p2.Lookup(ctx, "00:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 {
+		t.Fatalf("peer table is not resynced, got %v", peers)
+	}
+
+	p0.Stop()
+	p1.Stop()
+	p2.Stop()
+	r1.Stop()
+	r.Stop()
+}
+
+func TestAreaRouting(t *testing.T) {
+	initTestConfig()
+	defer config.Set("router.area", "")
+	defer config.Set("router.border", false)
+
+	//x0 - xb | xb - b0 - yb | yb - y0, xb and yb are border routers of area x and y
+	start := func(id, address, area string, border bool, discovery string) *router.Router {
+		config.Set("router.area", area)
+		config.Set("router.border", border)
+		config.Set("router.discovery", discovery)
+		r := router.NewRouter(id, address)
+		go r.Start()
+		time.Sleep(time.Second)
+		return r
+	}
+	x0 := start("x0", "0.0.0.0:8022", "x", false, "")
+	xb := start("xb", "0.0.0.0:8023", "x", true, "0.0.0.0:8022")
+	b0 := start("b0", "0.0.0.0:8024", "", false, "0.0.0.0:8023")
+	yb := start("yb", "0.0.0.0:8025", "y", true, "0.0.0.0:8024")
+	y0 := start("y0", "0.0.0.0:8026", "y", false, "0.0.0.0:8025")
+
+	recv := make(chan string, 10)
+	dial := func(id, address string) *Client {
+		c, err := Dial(context.Background(), WithID(id), WithRouters(address), WithSessions(1), WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+			recv <- dstID + " " + string(payload)
+			return nil
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	px := dial("cx:px", "0.0.0.0:8022")
+	pb := dial("cb:pb", "0.0.0.0:8024")
+	py := dial("cy:py", "0.0.0.0:8026")
+	time.Sleep(3 * time.Second)
+
+	expect := func(want string) {
+		select {
+		case got := <-recv:
+			if got != want {
+				t.Fatalf("expect %s, got %s", want, got)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("expect %s, got nothing", want)
+		}
+	}
+	for _, c := range []struct {
+		src *Client
+		dst string
+	}{{px, "cy:py"}, {py, "cx:px"}, {px, "cb:pb"}, {pb, "cy:py"}} {
+		if _, err := c.src.Send(context.Background(), c.dst, []byte("hi"), nil); err != nil {
+			t.Fatal(err)
+		}
+		expect(c.dst + " hi")
+	}
+	select {
+	case got := <-recv:
+		t.Fatalf("unexpected message %s", got)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	//peer ids are not flooded out of their area
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	for _, c := range []struct {
+		src     *Client
+		pattern string
+		n       int
+	}{{px, "cx:", 1}, {py, "cx:", 0}, {pb, "cx:", 0}, {pb, "cb:", 1}, {px, "cb:", 0}} {
+		peers, err := c.src.Lookup(ctx, c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(peers) != c.n {
+			t.Fatalf("peer %s lookup %s expect %d peers, got %v", c.src.ID(), c.pattern, c.n, peers)
+		}
+	}
+
+	px.Close()
+	pb.Close()
+	py.Close()
+	y0.Stop()
+	yb.Stop()
+	b0.Stop()
+	xb.Stop()
+	x0.Stop()
+}
+
+func TestRoutePolicy(t *testing.T) {
+	initTestConfig()
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.yaml")
+	if err := ioutil.WriteFile(path, []byte("rules:\n  - src: [\"A:\"]\n    dst: [\"B:\"]\n    action: deny\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Set("router.policy.path", path)
+	defer config.Set("router.policy.path", "")
+
+	r := router.NewRouter("00", "0.0.0.0:8027")
+	go r.Start()
+	time.Sleep(time.Second)
+
+	recv := make(chan string, 10)
+	dial := func(id string) *Client {
+		c, err := Dial(context.Background(), WithID(id), WithRouters("0.0.0.0:8027"), WithSessions(1), WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+			recv <- srcID + " " + string(payload)
+			return nil
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	a := dial("A:p0")
+	b := dial("B:p0")
+	time.Sleep(time.Second)
+
+	expect := func(want string) {
+		select {
+		case got := <-recv:
+			if got != want {
+				t.Fatalf("expect %q, got %q", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			if want != "" {
+				t.Fatalf("expect %q, got nothing", want)
+			}
+		}
+	}
+	a.Send(context.Background(), "B:p0", []byte("denied"), nil)
+	expect("")
+	b.Send(context.Background(), "A:p0", []byte("allowed"), nil)
+	expect("B:p0 allowed")
+
+	//dry run only logs the decision
+	if err := ioutil.WriteFile(path, []byte("dryRun: true\nrules:\n  - src: [\"A:\"]\n    action: deny\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r.Reload()
+	a.Send(context.Background(), "B:p0", []byte("dry run"), nil)
+	expect("A:p0 dry run")
+
+	//invalid policy is not applied
+	if err := ioutil.WriteFile(path, []byte("default: drop\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r.Reload()
+	a.Send(context.Background(), "B:p0", []byte("kept"), nil)
+	expect("A:p0 kept")
+
+	a.Close()
+	b.Close()
+	r.Stop()
+}
+
+func TestSealedPayload(t *testing.T) {
+	initTestConfig()
+	keyA, _ := GenerateKey()
+	keyB, _ := GenerateKey()
+
+	chainMsg := &pb.ChainMessage{Id: "m0", SrcId: "A:p0", DstId: "B:p0", Payload: []byte("secret")}
+	if err := seal(chainMsg, keyB.PublicKey().Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if !chainMsg.Sealed || strings.Contains(string(chainMsg.Payload), "secret") {
+		t.Fatal("payload is not sealed")
+	}
+	tampered := *chainMsg
+	tampered.DstId = "B:p1"
+	if err := open(&tampered, keyB); err != ErrSealBroken {
+		t.Fatalf("header change is not detected --- %v", err)
+	}
+	if err := open(chainMsg, keyA); err != ErrSealBroken {
+		t.Fatalf("opened by other key --- %v", err)
+	}
+	if err := open(chainMsg, keyB); err != nil || string(chainMsg.Payload) != "secret" {
+		t.Fatalf("failed to open sealed payload %q --- %v", chainMsg.Payload, err)
+	}
+
+	//another key announced by online peer is refused until it goes offline
+	dir := newDirectory()
+	announce := func(version uint64, peers ...*pb.Peer) {
+		dir.applyPeers(&pb.Peers{Id: "0.0.0.0:9000", Epoch: 1, Version: version, Peers: peers})
+	}
+	announce(1, &pb.Peer{Id: "B:p0", PublicKey: keyB.PublicKey().Bytes()})
+	announce(2, &pb.Peer{Id: "B:p0", PublicKey: keyA.PublicKey().Bytes()})
+	if _, err := dir.publicKey("B:p0"); err != ErrKeyChanged {
+		t.Fatalf("expect %v, got %v", ErrKeyChanged, err)
+	}
+	announce(3)
+	announce(4, &pb.Peer{Id: "B:p0", PublicKey: keyA.PublicKey().Bytes()})
+	if key, err := dir.publicKey("B:p0"); err != nil || string(key) != string(keyA.PublicKey().Bytes()) {
+		t.Fatalf("key of rejoined peer is not used --- %v", err)
+	}
+
+	r := router.NewRouter("00", "0.0.0.0:8028")
+	go r.Start()
+	time.Sleep(time.Second)
+
+	recv := make(chan string, 10)
+	dial := func(id string, opts ...Option) *Client {
+		c, err := Dial(context.Background(), append(opts, WithID(id), WithRouters("0.0.0.0:8028"), WithSessions(1), WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+			recv <- dstID + " " + string(payload)
+			return nil
+		}))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	a := dial("A:p0", WithSealing(keyA))
+	b := dial("B:p0", WithSealing(keyB))
+	c := dial("C:p0")
+	other, _ := GenerateKey()
+	d := dial("D:p0", WithSealing(keyA), WithKeyRegistry(StaticKeys{"B:p0": other.PublicKey().Bytes()}))
+	time.Sleep(time.Second)
+
+	expect := func(want string) {
+		select {
+		case got := <-recv:
+			if got != want {
+				t.Fatalf("expect %q, got %q", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			if want != "" {
+				t.Fatalf("expect %q, got nothing", want)
+			}
+		}
+	}
+	if _, err := a.Send(context.Background(), "B:p0", []byte("sealed"), nil); err != nil {
+		t.Fatal(err)
+	}
+	expect("B:p0 sealed")
+	if _, err := b.Send(context.Background(), "A:p0", []byte("reply"), nil); err != nil {
+		t.Fatal(err)
+	}
+	expect("A:p0 reply")
+	//c announces no key
+	if _, err := a.Send(context.Background(), "C:p0", []byte("clear"), nil); err != ErrNoKey {
+		t.Fatalf("expect %v, got %v", ErrNoKey, err)
+	}
+	if _, err := c.Send(context.Background(), "A:p0", []byte("clear"), nil); err != nil {
+		t.Fatal(err)
+	}
+	expect("A:p0 clear")
+	//key of registry is trusted over the announced one, b fails to open
+	if _, err := d.Send(context.Background(), "B:p0", []byte("wrong key"), nil); err != nil {
+		t.Fatal(err)
+	}
+	expect("")
+
+	a.Close()
+	b.Close()
+	c.Close()
+	d.Close()
+	r.Stop()
+}
+
+func TestReplayGuard(t *testing.T) {
+	g := newReplayGuard(100, time.Second)
+	now := time.Now()
+	ts := now.UnixNano()
+	for _, c := range []struct {
+		seq uint64
+		err error
+	}{{1000, nil}, {1000, ErrReplay}, {998, nil}, {1001, nil}, {1100, nil}, {998, ErrReplay}, {1001, ErrReplay}, {1050, nil}, {1050, ErrReplay}, {1000, ErrReplay}, {1300, nil}, {1250, nil}, {1100, ErrReplay}} {
+		if err := g.check("A:p0", "B:p0", ts, c.seq, now); err != c.err {
+			t.Fatalf("sequence %d expect %v, got %v", c.seq, c.err, err)
+		}
+	}
+	if err := g.check("B:p0", "B:p0", ts, 1000, now); err != nil {
+		t.Fatalf("sources share window --- %v", err)
+	}
+	if err := g.check("A:p0", "C:p0", ts, 1000, now); err != nil {
+		t.Fatalf("destinations share window --- %v", err)
+	}
+	if err := g.check("A:p0", "B:p0", now.Add(-2*time.Second).UnixNano(), 2000, now); err != ErrStale {
+		t.Fatalf("expect %v, got %v", ErrStale, err)
+	}
+	if err := g.check("A:p0", "B:p0", now.Add(2*time.Second).UnixNano(), 2000, now); err != ErrStale {
+		t.Fatalf("expect %v, got %v", ErrStale, err)
+	}
+	if err := g.check("A:p0", "B:p0", 0, 2000, now); err != ErrStale {
+		t.Fatalf("expect %v, got %v", ErrStale, err)
+	}
+	g.prune(now.Add(2 * time.Second))
+	if stats := g.getStats(); stats.Sources != 0 || stats.Replayed != 6 || stats.Stale != 3 || stats.Accepted != 9 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestReplayProtection(t *testing.T) {
+	initTestConfig()
+	r := router.NewRouter("00", "0.0.0.0:8029")
+	go r.Start()
+	time.Sleep(time.Second)
+
+	recv := make(chan string, 10)
+	rejected := make(chan error, 10)
+	a, err := Dial(context.Background(), WithID("A:p0"), WithRouters("0.0.0.0:8029"), WithSessions(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Dial(context.Background(), WithID("B:p0"), WithRouters("0.0.0.0:8029"), WithSessions(1), WithReplayProtection(0, 0),
+		WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+			recv <- string(payload)
+			return nil
+		}),
+		WithRejectHandler(func(srcID string, id MsgID, err error) {
+			rejected <- err
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	inject := func(chainMsg *pb.ChainMessage) {
+		bytes, _ := chainMsg.Serialize()
+		client, _ := a.peer.healthiest().getClient()
+		client.SendChannel() <- &pb.Message{Type: pb.Message_CHAIN_MESSAGE, Payload: bytes}
+	}
+	expect := func(payload string, err error) {
+		select {
+		case got := <-recv:
+			if got != payload {
+				t.Fatalf("expect %q, got %q", payload, got)
+			}
+		case got := <-rejected:
+			if got != err {
+				t.Fatalf("expect %v, got %v", err, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("nothing received")
+		}
+	}
+	first, err := a.Send(context.Background(), "B:p0", []byte("first"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect("first", nil)
+	//captured message re-injected as is, then under a new id
+	seq := atomic.LoadUint64(&a.peer.sequence)
+	inject(&pb.ChainMessage{Id: string(first), SrcId: "A:p0", DstId: "B:p0", Payload: []byte("first"), Timestamp: time.Now().UnixNano(), Sequence: seq})
+	expect("", ErrReplay)
+	inject(&pb.ChainMessage{Id: "replay", SrcId: "A:p0", DstId: "B:p0", Payload: []byte("first"), Timestamp: time.Now().UnixNano(), Sequence: seq})
+	expect("", ErrReplay)
+	inject(&pb.ChainMessage{Id: "stale", SrcId: "A:p0", DstId: "B:p0", Payload: []byte("stale"), Timestamp: time.Now().Add(-time.Hour).UnixNano(), Sequence: seq + 100})
+	expect("", ErrStale)
+	if _, err := a.Send(context.Background(), "B:p0", []byte("second"), nil); err != nil {
+		t.Fatal(err)
+	}
+	expect("second", nil)
+	if stats := b.ReplayStats(); stats.Accepted != 2 || stats.Replayed != 2 || stats.Stale != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	a.Close()
+	b.Close()
+	r.Stop()
+}
+
+func TestOrderedDelivery(t *testing.T) {
+	initTestConfig()
+	r := router.NewRouter("00", "0.0.0.0:8030")
+	go r.Start()
+	time.Sleep(time.Second)
+
+	recv := make(chan string, 20)
+	gaps := make(chan error, 10)
+	a, err := Dial(context.Background(), WithID("A:p0"), WithRouters("0.0.0.0:8030"), WithSessions(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Dial(context.Background(), WithID("B:p0"), WithRouters("0.0.0.0:8030"), WithSessions(1), WithOrderTimeout(800*time.Millisecond), WithReplayProtection(0, 0),
+		WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+			recv <- string(payload)
+			return nil
+		}),
+		WithRejectHandler(func(srcID string, id MsgID, err error) {
+			gaps <- err
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	//lose numbers next ordered msg without sending it, it is redelivered on request if kept
+	lose := func(payload string, keep bool) {
+		sp := a.peer.orders.sentPair("B:p0")
+		sp.Lock()
+		defer sp.Unlock()
+		chainMsg := &pb.ChainMessage{Id: newMsgID(), SrcId: "A:p0", DstId: "B:p0", Payload: []byte(payload), Order: sp.last + 1, OrderEpoch: a.peer.started,
+			Timestamp: time.Now().UnixNano(), Sequence: atomic.AddUint64(&a.peer.sequence, 1)}
+		bytes, _ := chainMsg.Serialize()
+		sp.last = chainMsg.Order
+		if keep {
+			sp.history = append(sp.history, sentMsg{order: chainMsg.Order, bytes: bytes})
+		}
+	}
+	send := func(payload string) {
+		if _, err := a.Send(context.Background(), "B:p0", []byte(payload), nil, Ordered()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(want ...string) {
+		for _, w := range want {
+			select {
+			case got := <-recv:
+				if got != w {
+					t.Fatalf("expect %q, got %q", w, got)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatalf("expect %q, got nothing", w)
+			}
+		}
+	}
+
+	send("1")
+	lose("2", true)
+	send("3")
+	send("4")
+	expect("1", "2", "3", "4")
+
+	lose("5", false)
+	send("6")
+	select {
+	case err := <-gaps:
+		if err != ErrGap {
+			t.Fatalf("expect %v, got %v", ErrGap, err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("gap is not reported")
+	}
+	expect("6")
+
+	//unordered msgs are not held back
+	lose("7", false)
+	send("8")
+	if _, err := a.Send(context.Background(), "B:p0", []byte("unordered"), nil); err != nil {
+		t.Fatal(err)
+	}
+	expect("unordered", "8")
+	//buffered msgs redelivered with the missing ones are not replays
+	if stats := b.ReplayStats(); stats.Replayed != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	a.Close()
+	b.Close()
+	r.Stop()
+}
+
+func TestReliableDelivery(t *testing.T) {
+	initTestConfig()
+	r := router.NewRouter("00", "0.0.0.0:8031")
+	go r.Start()
+	time.Sleep(time.Second)
+
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox.log")
+
+	expired := make(chan error, 1)
+	dial := func() (*Client, *FileOutbox) {
+		outbox, err := NewFileOutbox(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := Dial(context.Background(), WithID("A:p0"), WithRouters("0.0.0.0:8031"), WithSessions(1),
+			WithOutbox(outbox), WithRetransmit(100*time.Millisecond, 400*time.Millisecond),
+			WithErrorHandler(func(id MsgID, err error) { expired <- err }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a, outbox
+	}
+
+	//destination is offline, msg stays in outbox across restart of source
+	a, outbox := dial()
+	if _, err := a.Send(context.Background(), "B:", []byte("all"), nil, Reliable(0)); err != ErrNotUnicast {
+		t.Fatalf("expect %v, got %v", ErrNotUnicast, err)
+	}
+	if _, err := a.Send(context.Background(), "B:p0", []byte("reliable"), nil, Reliable(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if a.Pending() != 1 {
+		t.Fatalf("expect 1 pending msg, got %d", a.Pending())
+	}
+	a.Close()
+	outbox.Close()
+	a, outbox = dial()
+	defer outbox.Close()
+	if a.Pending() != 1 {
+		t.Fatalf("expect 1 pending msg after restart, got %d", a.Pending())
+	}
+
+	var recv int32
+	b, err := Dial(context.Background(), WithID("B:p0"), WithRouters("0.0.0.0:8031"), WithSessions(1),
+		WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+			atomic.AddInt32(&recv, 1)
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; a.Pending() > 0; i++ {
+		if i > 50 {
+			t.Fatal("reliable msg is not acked")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if entries, _ := outbox.List(); len(entries) != 0 {
+		t.Fatalf("expect empty outbox, got %d entries", len(entries))
+	}
+
+	//retransmission whose ack is lost is acked again but not delivered twice
+	chainMsg := &pb.ChainMessage{Id: newMsgID(), SrcId: "A:p0", DstId: "B:p0", Payload: []byte("twice"), Reliable: true,
+		Expires: time.Now().Add(time.Minute).UnixNano()}
+	for i := 0; i < 2; i++ {
+		retry := *chainMsg
+		if _, err := a.peer.post(context.Background(), &retry); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&recv); n != 2 {
+		t.Fatalf("expect 2 msgs delivered, got %d", n)
+	}
+
+	//msg not acked before expiry is reported
+	if _, err := a.Send(context.Background(), "C:p0", []byte("lost"), nil, Reliable(300*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-expired:
+		if err != ErrExpired {
+			t.Fatalf("expect %v, got %v", ErrExpired, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expiry is not reported")
+	}
+	if a.Pending() != 0 {
+		t.Fatalf("expect no pending msg, got %d", a.Pending())
+	}
+
+	//msg failing for good on retransmission is reported at once
+	big := &pb.ChainMessage{Id: newMsgID(), SrcId: "A:p0", DstId: "B:p0", Payload: make([]byte, a.peer.opts.maxMsgSize), Reliable: true}
+	msg, _ := big.Serialize()
+	a.peer.track(&OutboxEntry{ID: big.Id, Dst: big.DstId, Msg: msg, Expires: time.Now().Add(time.Minute)})
+	select {
+	case err := <-expired:
+		if err != ErrTooLarge {
+			t.Fatalf("expect %v, got %v", ErrTooLarge, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failure of retransmission is not reported")
+	}
+	if a.Pending() != 0 {
+		t.Fatalf("expect no pending msg, got %d", a.Pending())
+	}
+
+	a.Close()
+	b.Close()
+	r.Stop()
+}
+
+func TestDeadLetter(t *testing.T) {
+	initTestConfig()
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config.Set("router.deadletter.path", filepath.Join(dir, "deadletter.log"))
+	config.Set("router.admin.address", "127.0.0.1:8033")
+	config.Set("router.admin.token", "secret")
+	defer config.Set("router.deadletter.path", "")
+	defer config.Set("router.admin.address", "")
+	defer config.Set("router.admin.token", "")
+	r := router.NewRouter("00", "0.0.0.0:8032")
+	go r.Start()
+	time.Sleep(time.Second)
+
+	undeliverable := make(chan error, 10)
+	a, err := Dial(context.Background(), WithID("A:p0"), WithRouters("0.0.0.0:8032"), WithSessions(1),
+		WithErrorHandler(func(id MsgID, err error) { undeliverable <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := func(target error) {
+		select {
+		case err := <-undeliverable:
+			if _, ok := err.(*UndeliverableError); !ok || !errors.Is(err, target) {
+				t.Fatalf("expect %v, got %v", target, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expect %v, got nothing", target)
+		}
+	}
+
+	id, err := a.Send(context.Background(), "B:p0", []byte("offline"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(ErrNoRoute)
+	expired := &pb.ChainMessage{Id: newMsgID(), SrcId: "A:p0", DstId: "B:p0", Expires: time.Now().Add(-time.Second).UnixNano()}
+	if _, err := a.peer.post(context.Background(), expired); err != nil {
+		t.Fatal(err)
+	}
+	expect(ErrExpired)
+
+	//reliable msg is retransmitted instead of reported while there is no route
+	if _, err := a.Send(context.Background(), "C:p0", []byte("reliable"), nil, Reliable(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-undeliverable:
+		t.Fatalf("unexpected error of reliable msg %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	admin := func(method, path string) (*http.Response, error) {
+		req, _ := http.NewRequest(method, "http://127.0.0.1:8033"+path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		return http.DefaultClient.Do(req)
+	}
+	if resp, err := http.Get("http://127.0.0.1:8033/deadletters"); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect unauthorized, got %v %v", resp, err)
+	}
+	resp, err := admin(http.MethodGet, "/deadletters?limit=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	letters := []struct{ ID, Reason string }{}
+	json.NewDecoder(resp.Body).Decode(&letters)
+	resp.Body.Close()
+	if len(letters) < 3 || letters[0].ID != string(id) || letters[0].Reason != "NO_ROUTE" || letters[1].Reason != "TTL_EXPIRED" {
+		t.Fatalf("unexpected dead letters %+v", letters)
+	}
+
+	//replayed once destination is online
+	recv := make(chan string, 1)
+	b, err := Dial(context.Background(), WithID("B:p0"), WithRouters("0.0.0.0:8032"), WithSessions(1),
+		WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+			recv <- string(payload)
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	resp, err = admin(http.MethodPost, "/deadletters/replay?id="+string(id))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("failed to replay dead letter %v %v", resp, err)
+	}
+	resp.Body.Close()
+	select {
+	case payload := <-recv:
+		if payload != "offline" {
+			t.Fatalf("unexpected payload %q", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("dead letter is not replayed")
+	}
+	if resp, err := admin(http.MethodPost, "/deadletters/replay?id=unknown"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect not found, got %v %v", resp, err)
+	}
+	//source is verified as a live message, it must be attached
+	a.Close()
+	if resp, err := admin(http.MethodPost, "/deadletters/replay?id="+string(id)); err != nil || resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expect conflict, got %v %v", resp, err)
+	}
+
+	b.Close()
+	r.Stop()
+}
+
+func TestTracing(t *testing.T) {
+	initTestConfig()
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spans.json")
+	config.Set("router.trace.exporter", "file")
+	config.Set("router.trace.path", path)
+	config.Set("router.trace.interval", "100ms")
+	defer config.Set("router.trace.exporter", "")
+	r0 := router.NewRouter("00", "0.0.0.0:8034")
+	go r0.Start()
+	time.Sleep(time.Second)
+	config.Set("router.discovery", "0.0.0.0:8034")
+	r1 := router.NewRouter("01", "0.0.0.0:8035")
+	go r1.Start()
+	time.Sleep(4 * time.Second)
+
+	recv := make(chan string, 2)
+	a, err := Dial(context.Background(), WithID("A:p0"), WithRouters("0.0.0.0:8034"), WithSessions(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Dial(context.Background(), WithID("B:p0"), WithRouters("0.0.0.0:8035"), WithSessions(1),
+		WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+			recv <- string(payload)
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second)
+
+	traced, err := a.Send(context.Background(), "B:p0", []byte("traced"), nil, Traced())
+	if err != nil {
+		t.Fatal(err)
+	}
+	untraced, err := a.Send(context.Background(), "B:p0", []byte("untraced"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-recv:
+		case <-time.After(2 * time.Second):
+			t.Fatal("msg is not delivered")
+		}
+	}
+	a.Close()
+	b.Close()
+	r1.Stop()
+	r0.Stop()
+
+	type span struct {
+		TraceID, SpanID, ParentSpanID, Name string
+		Attributes                          []struct {
+			Key   string
+			Value struct{ StringValue string }
+		}
+	}
+	spans := map[string]*span{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		req := struct {
+			ResourceSpans []struct{ ScopeSpans []struct{ Spans []*span } }
+		}{}
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			t.Fatal(err)
+		}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					if s.TraceID == string(untraced) {
+						t.Fatal("untraced msg is recorded")
+					}
+					if s.TraceID == string(traced) {
+						router := ""
+						for _, attr := range s.Attributes {
+							if attr.Key == "msgnet.router" {
+								router = attr.Value.StringValue
+							}
+						}
+						spans[s.SpanID] = s
+						if router != "" {
+							spans[router] = s
+						}
+					}
+				}
+			}
+		}
+	}
+	//receive, route and forward spans of both routers, the receive span of the next router is child of the forward span
+	receive0, receive1 := spans["0.0.0.0:8034"], spans["0.0.0.0:8035"]
+	if len(spans) != 8 || receive0 == nil || receive1 == nil || receive0.ParentSpanID != "" {
+		t.Fatalf("unexpected spans %d", len(spans))
+	}
+	if forward := spans[receive1.ParentSpanID]; forward == nil || forward.Name != "forward" || forward.ParentSpanID != receive0.SpanID {
+		t.Fatalf("receive span of next router is not child of forward span")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	initTestConfig()
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path0, path1 := filepath.Join(dir, "audit0.log"), filepath.Join(dir, "audit1.log")
+	defer config.Set("router.audit.path", "")
+	config.Set("router.audit.path", path0)
+	r0 := router.NewRouter("00", "0.0.0.0:8036")
+	go r0.Start()
+	time.Sleep(time.Second)
+	config.Set("router.audit.path", path1)
+	config.Set("router.discovery", "0.0.0.0:8036")
+	r1 := router.NewRouter("01", "0.0.0.0:8037")
+	go r1.Start()
+	time.Sleep(4 * time.Second)
+
+	recv := make(chan string, 1)
+	a, err := Dial(context.Background(), WithID("A:p0"), WithRouters("0.0.0.0:8036"), WithSessions(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Dial(context.Background(), WithID("B:p0"), WithRouters("0.0.0.0:8037"), WithSessions(1),
+		WithHandler(func(srcID, dstID string, payload []byte, signature []byte) error {
+			recv <- string(payload)
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second)
+
+	delivered, err := a.Send(context.Background(), "B:p0", []byte("audited"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-recv:
+	case <-time.After(2 * time.Second):
+		t.Fatal("msg is not delivered")
+	}
+	dropped, err := a.Send(context.Background(), "C:p0", []byte("audited"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	a.Close()
+	b.Close()
+	r1.Stop()
+	r0.Stop()
+
+	decisions := func(path string) map[string]*audit.Record {
+		if _, err := audit.Verify(path, nil, audit.Expect{}); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := map[string]*audit.Record{}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			r := &audit.Record{}
+			if err := json.Unmarshal([]byte(line), r); err != nil {
+				t.Fatal(err)
+			}
+			records[r.ID+":"+r.Decision] = r
+		}
+		return records
+	}
+	records0, records1 := decisions(path0), decisions(path1)
+	if r := records0[string(delivered)+":forward"]; r == nil || r.NextHop != "0.0.0.0:8037" || r.Src != "A:p0" || r.Dst != "B:p0" ||
+		r.Payload != audit.PayloadHash([]byte("audited")) || r.Size != len("audited") {
+		t.Fatalf("unexpected forward record %+v", r)
+	}
+	if r := records1[string(delivered)+":deliver"]; r == nil || r.NextHop != "B:p0" || r.Router != "0.0.0.0:8037" {
+		t.Fatalf("unexpected deliver record %+v", r)
+	}
+	if r := records0[string(dropped)+":drop"]; r == nil || r.Reason != pb.DeadLetter_NO_ROUTE.String() {
+		t.Fatalf("unexpected drop record %+v", r)
+	}
+}
+
+func TestGracefulClose(t *testing.T) {
+	initTestConfig()
+	r := router.NewRouter("00", "0.0.0.0:8048")
+	go r.Start()
+	time.Sleep(time.Second)
+
+	attached := func() bool {
+		for _, rt := range r.Topology().Routers {
+			if rt.Address == "0.0.0.0:8048" {
+				return len(rt.Peers) > 0
+			}
+		}
+		return false
+	}
+	p, err := Dial(context.Background(), WithID("A:p0"), WithRouters("0.0.0.0:8048"), WithSessions(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	if !attached() {
+		t.Fatal("peer is not attached")
+	}
+	//close returns once the router handled PEER_CLOSE
+	p.Close()
+	if attached() {
+		t.Fatal("peer is still attached after close")
+	}
+	r.Stop()
+}
@@ -0,0 +1,235 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package peer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bocheninc/msg-net/logger"
+	pb "github.com/bocheninc/msg-net/protos"
+)
+
+//default reliable delivery
+const (
+	defaultRetransmit    = time.Second
+	defaultRetransmitMax = 30 * time.Second
+	defaultReliableTTL   = 10 * time.Minute
+)
+
+//pendingMsg reliable message waiting for ack
+type pendingMsg struct {
+	entry *OutboxEntry
+	timer *time.Timer
+}
+
+//reliables unacknowledged reliable messages of peer
+type reliables struct {
+	pending map[string]*pendingMsg
+	sync.Mutex
+}
+
+func newReliables() *reliables {
+	return &reliables{pending: make(map[string]*pendingMsg)}
+}
+
+//isUnicast message is sent to a single peer
+func isUnicast(chainMsg *pb.ChainMessage) bool {
+	return chainMsg.Selector == "" && chainMsg.DstId != "" && chainMsg.DstId[len(chainMsg.DstId)-1] != ':'
+}
+
+//transient failure to send, the message is retransmitted later
+func transient(err error) bool {
+	return err == ErrNotConnected || err == context.Canceled || err == context.DeadlineExceeded
+}
+
+//sendReliable keeps chain message in outbox and sends it, it is retransmitted until acked or expired.
+//Transient failures to send are retried, the others fail
+func (p *Peer) sendReliable(ctx context.Context, chainMsg *pb.ChainMessage) ([]byte, error) {
+	msg, err := chainMsg.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	entry := &OutboxEntry{ID: chainMsg.Id, Dst: chainMsg.DstId, Msg: msg, Expires: time.Unix(0, chainMsg.Expires)}
+	if err := p.opts.outbox.Put(entry); err != nil {
+		return nil, err
+	}
+	p.track(entry)
+	bytes, err := p.post(ctx, chainMsg)
+	if err != nil && !transient(err) {
+		p.untrack(entry.ID)
+		return nil, err
+	} else if err != nil {
+		logger.Debugf("peer %s failed to send reliable msg %s to %s, retransmit later --- %v", p.id, entry.ID, entry.Dst, err)
+		return nil, nil
+	}
+	return bytes, nil
+}
+
+//track schedules retransmission of outbox entry
+func (p *Peer) track(entry *OutboxEntry) {
+	r := p.reliables
+	r.Lock()
+	defer r.Unlock()
+	pm := &pendingMsg{entry: entry}
+	pm.timer = time.AfterFunc(p.backoff(entry, 0), func() { p.retransmit(pm, 1) })
+	r.pending[entry.ID] = pm
+}
+
+//untrack stops retransmission of message and removes it from outbox
+func (p *Peer) untrack(id string) {
+	r := p.reliables
+	r.Lock()
+	pm, ok := r.pending[id]
+	if ok {
+		pm.timer.Stop()
+		delete(r.pending, id)
+	}
+	r.Unlock()
+	if !ok {
+		return
+	}
+	if err := p.opts.outbox.Delete(id); err != nil {
+		logger.Warnf("peer %s failed to delete msg %s from outbox --- %v", p.id, id, err)
+	}
+}
+
+//backoff delay before the next attempt, it doubles from retransmit interval up to the max and stops at expiry
+func (p *Peer) backoff(entry *OutboxEntry, attempt uint) time.Duration {
+	d := p.opts.retransmit
+	for i := uint(0); i < attempt && d < p.opts.retransmitMax; i++ {
+		d *= 2
+	}
+	if d > p.opts.retransmitMax {
+		d = p.opts.retransmitMax
+	}
+	if left := time.Until(entry.Expires); left < d {
+		d = left
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+//retransmit resends pending message with fresh timestamp and sequence, or drops it if expired or it fails for good
+func (p *Peer) retransmit(pm *pendingMsg, attempt uint) {
+	if p.ctx.Err() != nil {
+		return
+	}
+	r := p.reliables
+	r.Lock()
+	if r.pending[pm.entry.ID] != pm {
+		r.Unlock()
+		return
+	}
+	r.Unlock()
+
+	if !time.Now().Before(pm.entry.Expires) {
+		p.untrack(pm.entry.ID)
+		logger.Warnf("peer %s gives up reliable msg %s to %s, not acked before expiry", p.id, pm.entry.ID, pm.entry.Dst)
+		if p.opts.errorHandler != nil {
+			p.opts.errorHandler(MsgID(pm.entry.ID), ErrExpired)
+		}
+		return
+	}
+	chainMsg := &pb.ChainMessage{}
+	if err := chainMsg.Deserialize(pm.entry.Msg); err != nil {
+		logger.Errorf("peer %s drop broken msg %s from outbox --- %v", p.id, pm.entry.ID, err)
+		p.untrack(pm.entry.ID)
+		return
+	}
+	if chainMsg.Order > 0 && chainMsg.OrderEpoch != p.started {
+		//numbered by the previous process, destination has moved on to the new epoch
+		chainMsg.Order, chainMsg.OrderEpoch = 0, 0
+	}
+	if _, err := p.post(context.Background(), chainMsg); err != nil && !transient(err) {
+		p.untrack(pm.entry.ID)
+		logger.Warnf("peer %s gives up reliable msg %s to %s --- %v", p.id, pm.entry.ID, pm.entry.Dst, err)
+		if p.opts.errorHandler != nil {
+			p.opts.errorHandler(MsgID(pm.entry.ID), err)
+		}
+		return
+	} else if err != nil {
+		logger.Debugf("peer %s failed to retransmit msg %s to %s, attempt %d --- %v", p.id, pm.entry.ID, pm.entry.Dst, attempt, err)
+	} else {
+		logger.Debugf("peer %s retransmit msg %s to %s, attempt %d", p.id, pm.entry.ID, pm.entry.Dst, attempt)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	if r.pending[pm.entry.ID] == pm {
+		pm.timer = time.AfterFunc(p.backoff(pm.entry, attempt), func() { p.retransmit(pm, attempt+1) })
+	}
+}
+
+//resume schedules retransmission of messages left in outbox, e.g. by the previous process
+func (p *Peer) resume() {
+	entries, err := p.opts.outbox.List()
+	if err != nil {
+		logger.Errorf("peer %s failed to load outbox --- %v", p.id, err)
+		return
+	}
+	for _, entry := range entries {
+		p.track(entry)
+	}
+	if len(entries) > 0 {
+		logger.Infof("peer %s resumes %d reliable msgs from outbox", p.id, len(entries))
+	}
+}
+
+//ack acknowledges reliable message to its source
+func (p *Peer) ack(chainMsg *pb.ChainMessage) {
+	ack := &pb.ChainMessage{Id: newMsgID(), SrcId: p.id, DstId: chainMsg.SrcId, Kind: pb.ChainMessage_ACK, Payload: []byte(chainMsg.Id)}
+	if _, err := p.post(context.Background(), ack); err != nil {
+		logger.Warnf("peer %s failed to ack msg %s to %s --- %v", p.id, chainMsg.Id, chainMsg.SrcId, err)
+	}
+}
+
+//acked stops retransmission of message acknowledged by its destination
+func (p *Peer) acked(ack *pb.ChainMessage) {
+	id := string(ack.Payload)
+	r := p.reliables
+	r.Lock()
+	pm, ok := r.pending[id]
+	r.Unlock()
+	if !ok || pm.entry.Dst != ack.SrcId {
+		return
+	}
+	p.untrack(id)
+	logger.Debugf("peer %s reliable msg %s is acked by %s", p.id, id, ack.SrcId)
+}
+
+func (p *Peer) isPending(id string) bool {
+	p.reliables.Lock()
+	defer p.reliables.Unlock()
+	_, ok := p.reliables.pending[id]
+	return ok
+}
+
+//Pending returns number of reliable messages not acknowledged yet
+func (p *Peer) Pending() int {
+	if p.reliables == nil {
+		return 0
+	}
+	p.reliables.Lock()
+	defer p.reliables.Unlock()
+	return len(p.reliables.pending)
+}
@@ -0,0 +1,146 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package peer
+
+import (
+	"sync"
+	"time"
+)
+
+//default replay protection
+const (
+	defaultReplayWindow = 1024
+	defaultReplaySkew   = 30 * time.Second
+)
+
+//ReplayStats counters of replay protection
+type ReplayStats struct {
+	Accepted uint64 `json:"accepted"`
+	Replayed uint64 `json:"replayed"` //id or sequence received before, or sequence older than the window
+	Stale    uint64 `json:"stale"`    //timestamp outside clock skew tolerance
+	Sources  int    `json:"sources"`  //source and destination pairs tracked
+}
+
+//replayWindow sequences received from a source, bit i of mask is set if top-i is received
+type replayWindow struct {
+	top    uint64
+	mask   []uint64
+	newest int64 //newest timestamp accepted
+}
+
+//replayGuard sliding windows of sequences per source peer and destination, the sequence of a source is shared by its destinations.
+//A window is dropped once its newest timestamp is outside the tolerance, replays of it are stale then
+type replayGuard struct {
+	size    int
+	skew    time.Duration
+	windows map[string]*replayWindow
+	stats   ReplayStats
+	sync.Mutex
+}
+
+func newReplayGuard(size int, skew time.Duration) *replayGuard {
+	if size <= 0 {
+		size = defaultReplayWindow
+	}
+	if skew <= 0 {
+		skew = defaultReplaySkew
+	}
+	size = (size + 63) / 64 * 64
+	return &replayGuard{size: size, skew: skew, windows: make(map[string]*replayWindow)}
+}
+
+//check records sequence of source to destination, it returns ErrReplay or ErrStale if the message is rejected
+func (g *replayGuard) check(src, dst string, timestamp int64, sequence uint64, now time.Time) error {
+	g.Lock()
+	defer g.Unlock()
+	if d := now.Sub(time.Unix(0, timestamp)); timestamp == 0 || d > g.skew || d < -g.skew {
+		g.stats.Stale++
+		return ErrStale
+	}
+	key := src + "\x00" + dst
+	w, ok := g.windows[key]
+	if !ok {
+		w = &replayWindow{top: sequence, mask: make([]uint64, g.size/64)}
+		w.mask[0] = 1
+		g.windows[key] = w
+	} else if sequence > w.top {
+		w.shift(sequence - w.top)
+		w.top = sequence
+		w.mask[0] |= 1
+	} else {
+		i := w.top - sequence
+		if i >= uint64(g.size) || w.mask[i/64]&(1<<(i%64)) != 0 {
+			g.stats.Replayed++
+			return ErrReplay
+		}
+		w.mask[i/64] |= 1 << (i % 64)
+	}
+	if timestamp > w.newest {
+		w.newest = timestamp
+	}
+	g.stats.Accepted++
+	return nil
+}
+
+//shift moves window forward by n sequences
+func (w *replayWindow) shift(n uint64) {
+	words, bits := n/64, n%64
+	if words >= uint64(len(w.mask)) {
+		for i := range w.mask {
+			w.mask[i] = 0
+		}
+		return
+	}
+	for i := len(w.mask) - 1; i >= 0; i-- {
+		var v uint64
+		if j := i - int(words); j >= 0 {
+			v = w.mask[j] << bits
+			if bits > 0 && j > 0 {
+				v |= w.mask[j-1] >> (64 - bits)
+			}
+		}
+		w.mask[i] = v
+	}
+}
+
+//prune drops windows of sources whose messages are all outside the tolerance
+func (g *replayGuard) prune(now time.Time) {
+	g.Lock()
+	defer g.Unlock()
+	for key, w := range g.windows {
+		if now.Sub(time.Unix(0, w.newest)) > g.skew {
+			delete(g.windows, key)
+		}
+	}
+}
+
+//replayed counts message rejected as replayed by its id
+func (g *replayGuard) replayed() {
+	g.Lock()
+	defer g.Unlock()
+	g.stats.Replayed++
+}
+
+func (g *replayGuard) getStats() ReplayStats {
+	g.Lock()
+	defer g.Unlock()
+	stats := g.stats
+	stats.Sources = len(g.windows)
+	return stats
+}
@@ -0,0 +1,178 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package peer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"strconv"
+
+	pb "github.com/bocheninc/msg-net/protos"
+)
+
+//sealInfo binds derived keys to the sealing scheme
+const sealInfo = "msg-net seal x25519-aes256gcm"
+
+//KeyRegistry gives X25519 public keys of peers, it is trusted over keys announced through routers
+type KeyRegistry interface {
+	PublicKey(id string) ([]byte, bool)
+}
+
+//StaticKeys key registry of fixed public keys by peer id
+type StaticKeys map[string][]byte
+
+//PublicKey gets public key of peer id
+func (k StaticKeys) PublicKey(id string) ([]byte, bool) {
+	key, ok := k[id]
+	return key, ok
+}
+
+//GenerateKey generates X25519 key for sealed payloads
+func GenerateKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+//sealAAD header fields routers need in clear are authenticated with the payload
+func sealAAD(chainMsg *pb.ChainMessage) []byte {
+	return []byte(chainMsg.Id + "\x00" + chainMsg.SrcId + "\x00" + chainMsg.DstId + "\x00" +
+		strconv.FormatInt(chainMsg.Timestamp, 10) + "\x00" + strconv.FormatUint(chainMsg.Sequence, 10) + "\x00" +
+		chainMsg.Kind.String() + "\x00" + strconv.FormatUint(chainMsg.Order, 10) + "\x00" + strconv.FormatInt(chainMsg.OrderEpoch, 10) + "\x00" +
+		strconv.FormatBool(chainMsg.Reliable) + "\x00" + strconv.FormatInt(chainMsg.Expires, 10))
+}
+
+//hkdfKey HKDF-SHA256 (RFC 5869) key of size bytes derived from secret
+func hkdfKey(secret, salt []byte, info string, size int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	key, block := []byte{}, []byte{}
+	for i := byte(1); len(key) < size; i++ {
+		expand.Reset()
+		expand.Write(block)
+		expand.Write([]byte(info))
+		expand.Write([]byte{i})
+		block = expand.Sum(nil)
+		key = append(key, block...)
+	}
+	return key[:size]
+}
+
+func sealCipher(shared, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	block, err := aes.NewCipher(hkdfKey(shared, salt, sealInfo, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//seal encrypts payload of chain message to public key of recipient by a fresh ephemeral key,
+//sealed payload is ephemeral public key, nonce and ciphertext
+func seal(chainMsg *pb.ChainMessage, recipient []byte) error {
+	pub, err := ecdh.X25519().NewPublicKey(recipient)
+	if err != nil {
+		return err
+	}
+	ephemeral, err := GenerateKey()
+	if err != nil {
+		return err
+	}
+	shared, err := ephemeral.ECDH(pub)
+	if err != nil {
+		return err
+	}
+	aead, err := sealCipher(shared, ephemeral.PublicKey().Bytes(), recipient)
+	if err != nil {
+		return err
+	}
+	out := append([]byte{}, ephemeral.PublicKey().Bytes()...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	out = append(out, nonce...)
+	chainMsg.Payload = aead.Seal(out, nonce, chainMsg.Payload, sealAAD(chainMsg))
+	chainMsg.Sealed = true
+	return nil
+}
+
+//open decrypts sealed payload of chain message by private key of recipient
+func open(chainMsg *pb.ChainMessage, key *ecdh.PrivateKey) error {
+	if key == nil {
+		return ErrNoKey
+	}
+	size := len(key.PublicKey().Bytes())
+	if len(chainMsg.Payload) < size {
+		return ErrSealBroken
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(chainMsg.Payload[:size])
+	if err != nil {
+		return ErrSealBroken
+	}
+	shared, err := key.ECDH(ephemeral)
+	if err != nil {
+		return ErrSealBroken
+	}
+	aead, err := sealCipher(shared, ephemeral.Bytes(), key.PublicKey().Bytes())
+	if err != nil {
+		return err
+	}
+	rest := chainMsg.Payload[size:]
+	if len(rest) < aead.NonceSize() {
+		return ErrSealBroken
+	}
+	payload, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], sealAAD(chainMsg))
+	if err != nil {
+		return ErrSealBroken
+	}
+	chainMsg.Payload = payload
+	chainMsg.Sealed = false
+	return nil
+}
+
+//publicKey gets public key of peer id, from registry if set, otherwise from keys announced in peer tables
+func (p *Peer) publicKey(id string) ([]byte, error) {
+	if p.opts.keys != nil {
+		if key, ok := p.opts.keys.PublicKey(id); ok {
+			return key, nil
+		}
+		return nil, ErrNoKey
+	}
+	return p.directory.publicKey(id)
+}
+
+//sealMsg seals payload of unicast message if sealing is enabled, messages to several peers are not sealed
+func (p *Peer) sealMsg(chainMsg *pb.ChainMessage) error {
+	if p.opts.sealKey == nil || !isUnicast(chainMsg) {
+		return nil
+	}
+	key, err := p.publicKey(chainMsg.DstId)
+	if err != nil {
+		return err
+	}
+	if err := seal(chainMsg, key); err != nil {
+		return errors.New("peer: failed to seal payload --- " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package peer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bocheninc/msg-net/net/tcp"
+)
+
+//session connection of peer to one router
+type session struct {
+	address       string
+	router        string //address announced by router in PEER_HELLO_ACK
+	client        *tcp.Client
+	lastRecv      time.Time
+	keepAliveSent time.Time
+	rtt           time.Duration
+	reconnecting  bool
+	sync.RWMutex
+}
+
+//isConnected connected to router or not
+func (s *session) isConnected() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.client != nil && s.client.IsConnected()
+}
+
+//isHealthy connected and received msg from router within timeout
+func (s *session) isHealthy(timeout time.Duration) bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.client != nil && s.client.IsConnected() && time.Since(s.lastRecv) < timeout
+}
+
+//getClient returns current client and router address
+func (s *session) getClient() (*tcp.Client, string) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.client, s.address
+}
+
+//setClient replaces client and returns the old one
+func (s *session) setClient(address string, client *tcp.Client) *tcp.Client {
+	s.Lock()
+	defer s.Unlock()
+	old := s.client
+	s.address = address
+	s.router = ""
+	s.client = client
+	s.lastRecv = time.Now()
+	s.keepAliveSent = time.Time{}
+	s.rtt = 0
+	return old
+}
+
+func (s *session) setRouter(router string) {
+	s.Lock()
+	defer s.Unlock()
+	s.router = router
+}
+
+func (s *session) getRouter() string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.router
+}
+
+func (s *session) recv() {
+	s.Lock()
+	defer s.Unlock()
+	s.lastRecv = time.Now()
+}
+
+func (s *session) keepAlive() {
+	s.Lock()
+	defer s.Unlock()
+	s.keepAliveSent = time.Now()
+}
+
+func (s *session) keepAliveAck() {
+	s.Lock()
+	defer s.Unlock()
+	if !s.keepAliveSent.IsZero() {
+		s.rtt = time.Since(s.keepAliveSent)
+		s.keepAliveSent = time.Time{}
+	}
+}
+
+//getRTT returns round trip time of the last keepalive, 0 if unknown
+func (s *session) getRTT() time.Duration {
+	s.RLock()
+	defer s.RUnlock()
+	return s.rtt
+}
+
+//startReconnect marks session reconnecting, false if it is already reconnecting
+func (s *session) startReconnect() bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.reconnecting {
+		return false
+	}
+	s.reconnecting = true
+	return true
+}
+
+func (s *session) stopReconnect() {
+	s.Lock()
+	defer s.Unlock()
+	s.reconnecting = false
+}
@@ -108,6 +108,57 @@ func (m *Peers) Deserialize(data []byte) error {
 	return nil
 }
 
+//Serialize serializes areaSummary message
+func (m *AreaSummary) Serialize() ([]byte, error) {
+	msgData, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return msgData, nil
+}
+
+//Deserialize deserializes areaSummary message
+func (m *AreaSummary) Deserialize(data []byte) error {
+	if err := proto.Unmarshal(data, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+//Serialize serializes peerDigest message
+func (m *PeerDigest) Serialize() ([]byte, error) {
+	msgData, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return msgData, nil
+}
+
+//Deserialize deserializes peerDigest message
+func (m *PeerDigest) Deserialize(data []byte) error {
+	if err := proto.Unmarshal(data, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+//Serialize serializes peerLookup message
+func (m *PeerLookup) Serialize() ([]byte, error) {
+	msgData, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return msgData, nil
+}
+
+//Deserialize deserializes peerLookup message
+func (m *PeerLookup) Deserialize(data []byte) error {
+	if err := proto.Unmarshal(data, m); err != nil {
+		return err
+	}
+	return nil
+}
+
 //Serialize serializes chainMessage message
 func (m *ChainMessage) Serialize() ([]byte, error) {
 	msgData, err := proto.Marshal(m)
@@ -124,3 +175,37 @@ func (m *ChainMessage) Deserialize(data []byte) error {
 	}
 	return nil
 }
+
+//Serialize serializes deadLetter message
+func (m *DeadLetter) Serialize() ([]byte, error) {
+	msgData, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return msgData, nil
+}
+
+//Deserialize deserializes deadLetter message
+func (m *DeadLetter) Deserialize(data []byte) error {
+	if err := proto.Unmarshal(data, m); err != nil {
+		return err
+	}
+	return nil
+}
+
+//Serialize serializes membership message
+func (m *Membership) Serialize() ([]byte, error) {
+	msgData, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return msgData, nil
+}
+
+//Deserialize deserializes membership message
+func (m *Membership) Deserialize(data []byte) error {
+	if err := proto.Unmarshal(data, m); err != nil {
+		return err
+	}
+	return nil
+}
@@ -30,9 +30,16 @@ It has these top-level messages:
 	Message
 	Router
 	Routers
+	AreaSummary
 	Peer
 	Peers
+	PeerDigest
+	PeerLocation
+	PeerLookup
 	ChainMessage
+	DeadLetter
+	Member
+	Membership
 */
 package protos
 
@@ -61,11 +68,23 @@ const (
 	Message_ROUTER_GET       Message_Type = 4
 	Message_ROUTER_GET_ACK   Message_Type = 5
 	Message_ROUTER_SYNC      Message_Type = 6
+	Message_ROUTER_SUMMARY   Message_Type = 7
+	Message_MEMBER_PING      Message_Type = 8
+	Message_MEMBER_PING_REQ  Message_Type = 9
+	Message_MEMBER_ACK       Message_Type = 10
 	Message_PEER_HELLO       Message_Type = 11
 	Message_PEER_HELLO_ACK   Message_Type = 12
 	Message_PEER_CLOSE       Message_Type = 13
 	Message_PEER_SYNC        Message_Type = 14
+	Message_PEER_MIGRATE     Message_Type = 15
+	Message_PEER_LOOKUP      Message_Type = 16
+	Message_PEER_LOOKUP_ACK  Message_Type = 17
+	Message_PEER_CONFLICT    Message_Type = 18
+	Message_PEER_DIGEST      Message_Type = 19
+	Message_PEER_RESYNC      Message_Type = 20
+	Message_PEER_CLOSE_ACK   Message_Type = 23
 	Message_CHAIN_MESSAGE    Message_Type = 21
+	Message_DEAD_LETTER      Message_Type = 22
 	Message_KEEPALIVE        Message_Type = 31
 	Message_KEEPALIVE_ACK    Message_Type = 32
 )
@@ -78,11 +97,23 @@ var Message_Type_name = map[int32]string{
 	4:  "ROUTER_GET",
 	5:  "ROUTER_GET_ACK",
 	6:  "ROUTER_SYNC",
+	7:  "ROUTER_SUMMARY",
+	8:  "MEMBER_PING",
+	9:  "MEMBER_PING_REQ",
+	10: "MEMBER_ACK",
 	11: "PEER_HELLO",
 	12: "PEER_HELLO_ACK",
 	13: "PEER_CLOSE",
 	14: "PEER_SYNC",
+	15: "PEER_MIGRATE",
+	16: "PEER_LOOKUP",
+	17: "PEER_LOOKUP_ACK",
+	18: "PEER_CONFLICT",
+	19: "PEER_DIGEST",
+	20: "PEER_RESYNC",
+	23: "PEER_CLOSE_ACK",
 	21: "CHAIN_MESSAGE",
+	22: "DEAD_LETTER",
 	31: "KEEPALIVE",
 	32: "KEEPALIVE_ACK",
 }
@@ -94,11 +125,23 @@ var Message_Type_value = map[string]int32{
 	"ROUTER_GET":       4,
 	"ROUTER_GET_ACK":   5,
 	"ROUTER_SYNC":      6,
+	"ROUTER_SUMMARY":   7,
+	"MEMBER_PING":      8,
+	"MEMBER_PING_REQ":  9,
+	"MEMBER_ACK":       10,
 	"PEER_HELLO":       11,
 	"PEER_HELLO_ACK":   12,
 	"PEER_CLOSE":       13,
 	"PEER_SYNC":        14,
+	"PEER_MIGRATE":     15,
+	"PEER_LOOKUP":      16,
+	"PEER_LOOKUP_ACK":  17,
+	"PEER_CONFLICT":    18,
+	"PEER_DIGEST":      19,
+	"PEER_RESYNC":      20,
+	"PEER_CLOSE_ACK":   23,
 	"CHAIN_MESSAGE":    21,
+	"DEAD_LETTER":      22,
 	"KEEPALIVE":        31,
 	"KEEPALIVE_ACK":    32,
 }
@@ -108,6 +151,117 @@ func (x Message_Type) String() string {
 }
 func (Message_Type) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 0} }
 
+type Peer_Role int32
+
+const (
+	Peer_UNSPECIFIED Peer_Role = 0
+	Peer_VALIDATOR   Peer_Role = 1
+	Peer_OBSERVER    Peer_Role = 2
+)
+
+var Peer_Role_name = map[int32]string{
+	0: "UNSPECIFIED",
+	1: "VALIDATOR",
+	2: "OBSERVER",
+}
+var Peer_Role_value = map[string]int32{
+	"UNSPECIFIED": 0,
+	"VALIDATOR":   1,
+	"OBSERVER":    2,
+}
+
+func (x Peer_Role) String() string {
+	return proto.EnumName(Peer_Role_name, int32(x))
+}
+func (Peer_Role) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{4, 0} }
+
+type ChainMessage_Kind int32
+
+const (
+	ChainMessage_DATA      ChainMessage_Kind = 0
+	ChainMessage_REDELIVER ChainMessage_Kind = 1
+	ChainMessage_ACK       ChainMessage_Kind = 2
+)
+
+var ChainMessage_Kind_name = map[int32]string{
+	0: "DATA",
+	1: "REDELIVER",
+	2: "ACK",
+}
+var ChainMessage_Kind_value = map[string]int32{
+	"DATA":      0,
+	"REDELIVER": 1,
+	"ACK":       2,
+}
+
+func (x ChainMessage_Kind) String() string {
+	return proto.EnumName(ChainMessage_Kind_name, int32(x))
+}
+func (ChainMessage_Kind) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{9, 0} }
+
+type DeadLetter_Reason int32
+
+const (
+	DeadLetter_UNKNOWN         DeadLetter_Reason = 0
+	DeadLetter_NO_ROUTE        DeadLetter_Reason = 1
+	DeadLetter_ACL_DENIED      DeadLetter_Reason = 2
+	DeadLetter_TTL_EXPIRED     DeadLetter_Reason = 3
+	DeadLetter_TOO_LARGE       DeadLetter_Reason = 4
+	DeadLetter_MAILBOX_FULL    DeadLetter_Reason = 5
+	DeadLetter_DELIVERY_FAILED DeadLetter_Reason = 6
+)
+
+var DeadLetter_Reason_name = map[int32]string{
+	0: "UNKNOWN",
+	1: "NO_ROUTE",
+	2: "ACL_DENIED",
+	3: "TTL_EXPIRED",
+	4: "TOO_LARGE",
+	5: "MAILBOX_FULL",
+	6: "DELIVERY_FAILED",
+}
+var DeadLetter_Reason_value = map[string]int32{
+	"UNKNOWN":         0,
+	"NO_ROUTE":        1,
+	"ACL_DENIED":      2,
+	"TTL_EXPIRED":     3,
+	"TOO_LARGE":       4,
+	"MAILBOX_FULL":    5,
+	"DELIVERY_FAILED": 6,
+}
+
+func (x DeadLetter_Reason) String() string {
+	return proto.EnumName(DeadLetter_Reason_name, int32(x))
+}
+func (DeadLetter_Reason) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{10, 0} }
+
+type Member_State int32
+
+const (
+	Member_ALIVE   Member_State = 0
+	Member_SUSPECT Member_State = 1
+	Member_DEAD    Member_State = 2
+	Member_LEFT    Member_State = 3
+)
+
+var Member_State_name = map[int32]string{
+	0: "ALIVE",
+	1: "SUSPECT",
+	2: "DEAD",
+	3: "LEFT",
+}
+var Member_State_value = map[string]int32{
+	"ALIVE":   0,
+	"SUSPECT": 1,
+	"DEAD":    2,
+	"LEFT":    3,
+}
+
+func (x Member_State) String() string {
+	return proto.EnumName(Member_State_name, int32(x))
+}
+func (Member_State) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{11, 0} }
+
 type Message struct {
 	Type     Message_Type `protobuf:"varint,1,opt,name=type,enum=protos.Message_Type" json:"type,omitempty"`
 	Payload  []byte       `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
@@ -141,8 +295,9 @@ func (m *Message) GetMetadata() []byte {
 }
 
 type Router struct {
-	Id      string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
-	Address string `protobuf:"bytes,2,opt,name=address" json:"address,omitempty"`
+	Id      string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Address string   `protobuf:"bytes,2,opt,name=address" json:"address,omitempty"`
+	Areas   []string `protobuf:"bytes,3,rep,name=areas" json:"areas,omitempty"`
 }
 
 func (m *Router) Reset()                    { *m = Router{} }
@@ -164,9 +319,17 @@ func (m *Router) GetAddress() string {
 	return ""
 }
 
+func (m *Router) GetAreas() []string {
+	if m != nil {
+		return m.Areas
+	}
+	return nil
+}
+
 type Routers struct {
 	Id      string    `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
 	Routers []*Router `protobuf:"bytes,2,rep,name=routers" json:"routers,omitempty"`
+	Area    string    `protobuf:"bytes,3,opt,name=area" json:"area,omitempty"`
 }
 
 func (m *Routers) Reset()                    { *m = Routers{} }
@@ -188,14 +351,77 @@ func (m *Routers) GetRouters() []*Router {
 	return nil
 }
 
+func (m *Routers) GetArea() string {
+	if m != nil {
+		return m.Area
+	}
+	return ""
+}
+
+type AreaSummary struct {
+	Id      string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Area    string   `protobuf:"bytes,2,opt,name=area" json:"area,omitempty"`
+	Epoch   int64    `protobuf:"varint,3,opt,name=epoch" json:"epoch,omitempty"`
+	Version uint64   `protobuf:"varint,4,opt,name=version" json:"version,omitempty"`
+	Chains  []string `protobuf:"bytes,5,rep,name=chains" json:"chains,omitempty"`
+}
+
+func (m *AreaSummary) Reset()                    { *m = AreaSummary{} }
+func (m *AreaSummary) String() string            { return proto.CompactTextString(m) }
+func (*AreaSummary) ProtoMessage()               {}
+func (*AreaSummary) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *AreaSummary) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *AreaSummary) GetArea() string {
+	if m != nil {
+		return m.Area
+	}
+	return ""
+}
+
+func (m *AreaSummary) GetEpoch() int64 {
+	if m != nil {
+		return m.Epoch
+	}
+	return 0
+}
+
+func (m *AreaSummary) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *AreaSummary) GetChains() []string {
+	if m != nil {
+		return m.Chains
+	}
+	return nil
+}
+
 type Peer struct {
-	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Id           string            `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	ChainId      string            `protobuf:"bytes,2,opt,name=chainId" json:"chainId,omitempty"`
+	NodeId       string            `protobuf:"bytes,3,opt,name=nodeId" json:"nodeId,omitempty"`
+	Role         Peer_Role         `protobuf:"varint,4,opt,name=role,enum=protos.Peer_Role" json:"role,omitempty"`
+	Capabilities []string          `protobuf:"bytes,5,rep,name=capabilities" json:"capabilities,omitempty"`
+	Labels       map[string]string `protobuf:"bytes,6,rep,name=labels" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Instance     string            `protobuf:"bytes,7,opt,name=instance" json:"instance,omitempty"`
+	Started      int64             `protobuf:"varint,8,opt,name=started" json:"started,omitempty"`
+	PublicKey    []byte            `protobuf:"bytes,9,opt,name=publicKey,proto3" json:"publicKey,omitempty"`
 }
 
 func (m *Peer) Reset()                    { *m = Peer{} }
 func (m *Peer) String() string            { return proto.CompactTextString(m) }
 func (*Peer) ProtoMessage()               {}
-func (*Peer) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+func (*Peer) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
 
 func (m *Peer) GetId() string {
 	if m != nil {
@@ -204,15 +430,77 @@ func (m *Peer) GetId() string {
 	return ""
 }
 
+func (m *Peer) GetChainId() string {
+	if m != nil {
+		return m.ChainId
+	}
+	return ""
+}
+
+func (m *Peer) GetNodeId() string {
+	if m != nil {
+		return m.NodeId
+	}
+	return ""
+}
+
+func (m *Peer) GetRole() Peer_Role {
+	if m != nil {
+		return m.Role
+	}
+	return Peer_UNSPECIFIED
+}
+
+func (m *Peer) GetCapabilities() []string {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
+func (m *Peer) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *Peer) GetInstance() string {
+	if m != nil {
+		return m.Instance
+	}
+	return ""
+}
+
+func (m *Peer) GetStarted() int64 {
+	if m != nil {
+		return m.Started
+	}
+	return 0
+}
+
+func (m *Peer) GetPublicKey() []byte {
+	if m != nil {
+		return m.PublicKey
+	}
+	return nil
+}
+
 type Peers struct {
-	Id    string  `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
-	Peers []*Peer `protobuf:"bytes,2,rep,name=peers" json:"peers,omitempty"`
+	Id      string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Peers   []*Peer  `protobuf:"bytes,2,rep,name=peers" json:"peers,omitempty"`
+	Epoch   int64    `protobuf:"varint,3,opt,name=epoch" json:"epoch,omitempty"`
+	Version uint64   `protobuf:"varint,4,opt,name=version" json:"version,omitempty"`
+	Delta   bool     `protobuf:"varint,5,opt,name=delta" json:"delta,omitempty"`
+	Base    uint64   `protobuf:"varint,6,opt,name=base" json:"base,omitempty"`
+	Removed []string `protobuf:"bytes,7,rep,name=removed" json:"removed,omitempty"`
+	Area    string   `protobuf:"bytes,8,opt,name=area" json:"area,omitempty"`
 }
 
 func (m *Peers) Reset()                    { *m = Peers{} }
 func (m *Peers) String() string            { return proto.CompactTextString(m) }
 func (*Peers) ProtoMessage()               {}
-func (*Peers) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+func (*Peers) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
 
 func (m *Peers) GetId() string {
 	if m != nil {
@@ -228,17 +516,176 @@ func (m *Peers) GetPeers() []*Peer {
 	return nil
 }
 
+func (m *Peers) GetEpoch() int64 {
+	if m != nil {
+		return m.Epoch
+	}
+	return 0
+}
+
+func (m *Peers) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *Peers) GetDelta() bool {
+	if m != nil {
+		return m.Delta
+	}
+	return false
+}
+
+func (m *Peers) GetBase() uint64 {
+	if m != nil {
+		return m.Base
+	}
+	return 0
+}
+
+func (m *Peers) GetRemoved() []string {
+	if m != nil {
+		return m.Removed
+	}
+	return nil
+}
+
+func (m *Peers) GetArea() string {
+	if m != nil {
+		return m.Area
+	}
+	return ""
+}
+
+type PeerDigest struct {
+	Id      string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Epoch   int64  `protobuf:"varint,2,opt,name=epoch" json:"epoch,omitempty"`
+	Version uint64 `protobuf:"varint,3,opt,name=version" json:"version,omitempty"`
+	Count   uint32 `protobuf:"varint,4,opt,name=count" json:"count,omitempty"`
+	Area    string `protobuf:"bytes,5,opt,name=area" json:"area,omitempty"`
+}
+
+func (m *PeerDigest) Reset()                    { *m = PeerDigest{} }
+func (m *PeerDigest) String() string            { return proto.CompactTextString(m) }
+func (*PeerDigest) ProtoMessage()               {}
+func (*PeerDigest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *PeerDigest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *PeerDigest) GetEpoch() int64 {
+	if m != nil {
+		return m.Epoch
+	}
+	return 0
+}
+
+func (m *PeerDigest) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *PeerDigest) GetCount() uint32 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *PeerDigest) GetArea() string {
+	if m != nil {
+		return m.Area
+	}
+	return ""
+}
+
+type PeerLocation struct {
+	Id      string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Routers []string `protobuf:"bytes,2,rep,name=routers" json:"routers,omitempty"`
+}
+
+func (m *PeerLocation) Reset()                    { *m = PeerLocation{} }
+func (m *PeerLocation) String() string            { return proto.CompactTextString(m) }
+func (*PeerLocation) ProtoMessage()               {}
+func (*PeerLocation) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *PeerLocation) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *PeerLocation) GetRouters() []string {
+	if m != nil {
+		return m.Routers
+	}
+	return nil
+}
+
+type PeerLookup struct {
+	Id      string          `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Pattern string          `protobuf:"bytes,2,opt,name=pattern" json:"pattern,omitempty"`
+	Peers   []*PeerLocation `protobuf:"bytes,3,rep,name=peers" json:"peers,omitempty"`
+}
+
+func (m *PeerLookup) Reset()                    { *m = PeerLookup{} }
+func (m *PeerLookup) String() string            { return proto.CompactTextString(m) }
+func (*PeerLookup) ProtoMessage()               {}
+func (*PeerLookup) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *PeerLookup) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *PeerLookup) GetPattern() string {
+	if m != nil {
+		return m.Pattern
+	}
+	return ""
+}
+
+func (m *PeerLookup) GetPeers() []*PeerLocation {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
 type ChainMessage struct {
-	SrcId     string `protobuf:"bytes,1,opt,name=srcId" json:"srcId,omitempty"`
-	DstId     string `protobuf:"bytes,2,opt,name=dstId" json:"dstId,omitempty"`
-	Payload   []byte `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
-	Signature []byte `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	SrcId      string            `protobuf:"bytes,1,opt,name=srcId" json:"srcId,omitempty"`
+	DstId      string            `protobuf:"bytes,2,opt,name=dstId" json:"dstId,omitempty"`
+	Payload    []byte            `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Signature  []byte            `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	Id         string            `protobuf:"bytes,5,opt,name=id" json:"id,omitempty"`
+	Selector   string            `protobuf:"bytes,6,opt,name=selector" json:"selector,omitempty"`
+	Sealed     bool              `protobuf:"varint,7,opt,name=sealed" json:"sealed,omitempty"`
+	Timestamp  int64             `protobuf:"varint,8,opt,name=timestamp" json:"timestamp,omitempty"`
+	Sequence   uint64            `protobuf:"varint,9,opt,name=sequence" json:"sequence,omitempty"`
+	Kind       ChainMessage_Kind `protobuf:"varint,10,opt,name=kind,enum=protos.ChainMessage_Kind" json:"kind,omitempty"`
+	Order      uint64            `protobuf:"varint,11,opt,name=order" json:"order,omitempty"`
+	OrderEpoch int64             `protobuf:"varint,12,opt,name=orderEpoch" json:"orderEpoch,omitempty"`
+	Reliable   bool              `protobuf:"varint,13,opt,name=reliable" json:"reliable,omitempty"`
+	Expires    int64             `protobuf:"varint,14,opt,name=expires" json:"expires,omitempty"`
+	TraceId    string            `protobuf:"bytes,15,opt,name=traceId" json:"traceId,omitempty"`
+	SpanId     string            `protobuf:"bytes,16,opt,name=spanId" json:"spanId,omitempty"`
+	Sampled    bool              `protobuf:"varint,17,opt,name=sampled" json:"sampled,omitempty"`
 }
 
 func (m *ChainMessage) Reset()                    { *m = ChainMessage{} }
 func (m *ChainMessage) String() string            { return proto.CompactTextString(m) }
 func (*ChainMessage) ProtoMessage()               {}
-func (*ChainMessage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+func (*ChainMessage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
 
 func (m *ChainMessage) GetSrcId() string {
 	if m != nil {
@@ -268,44 +715,368 @@ func (m *ChainMessage) GetSignature() []byte {
 	return nil
 }
 
+func (m *ChainMessage) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ChainMessage) GetSelector() string {
+	if m != nil {
+		return m.Selector
+	}
+	return ""
+}
+
+func (m *ChainMessage) GetSealed() bool {
+	if m != nil {
+		return m.Sealed
+	}
+	return false
+}
+
+func (m *ChainMessage) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *ChainMessage) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *ChainMessage) GetKind() ChainMessage_Kind {
+	if m != nil {
+		return m.Kind
+	}
+	return ChainMessage_DATA
+}
+
+func (m *ChainMessage) GetOrder() uint64 {
+	if m != nil {
+		return m.Order
+	}
+	return 0
+}
+
+func (m *ChainMessage) GetOrderEpoch() int64 {
+	if m != nil {
+		return m.OrderEpoch
+	}
+	return 0
+}
+
+func (m *ChainMessage) GetReliable() bool {
+	if m != nil {
+		return m.Reliable
+	}
+	return false
+}
+
+func (m *ChainMessage) GetExpires() int64 {
+	if m != nil {
+		return m.Expires
+	}
+	return 0
+}
+
+func (m *ChainMessage) GetTraceId() string {
+	if m != nil {
+		return m.TraceId
+	}
+	return ""
+}
+
+func (m *ChainMessage) GetSpanId() string {
+	if m != nil {
+		return m.SpanId
+	}
+	return ""
+}
+
+func (m *ChainMessage) GetSampled() bool {
+	if m != nil {
+		return m.Sampled
+	}
+	return false
+}
+
+type DeadLetter struct {
+	Id        string            `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	SrcId     string            `protobuf:"bytes,2,opt,name=srcId" json:"srcId,omitempty"`
+	DstId     string            `protobuf:"bytes,3,opt,name=dstId" json:"dstId,omitempty"`
+	Reason    DeadLetter_Reason `protobuf:"varint,4,opt,name=reason,enum=protos.DeadLetter_Reason" json:"reason,omitempty"`
+	Router    string            `protobuf:"bytes,5,opt,name=router" json:"router,omitempty"`
+	Detail    string            `protobuf:"bytes,6,opt,name=detail" json:"detail,omitempty"`
+	Timestamp int64             `protobuf:"varint,7,opt,name=timestamp" json:"timestamp,omitempty"`
+}
+
+func (m *DeadLetter) Reset()                    { *m = DeadLetter{} }
+func (m *DeadLetter) String() string            { return proto.CompactTextString(m) }
+func (*DeadLetter) ProtoMessage()               {}
+func (*DeadLetter) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *DeadLetter) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *DeadLetter) GetSrcId() string {
+	if m != nil {
+		return m.SrcId
+	}
+	return ""
+}
+
+func (m *DeadLetter) GetDstId() string {
+	if m != nil {
+		return m.DstId
+	}
+	return ""
+}
+
+func (m *DeadLetter) GetReason() DeadLetter_Reason {
+	if m != nil {
+		return m.Reason
+	}
+	return DeadLetter_UNKNOWN
+}
+
+func (m *DeadLetter) GetRouter() string {
+	if m != nil {
+		return m.Router
+	}
+	return ""
+}
+
+func (m *DeadLetter) GetDetail() string {
+	if m != nil {
+		return m.Detail
+	}
+	return ""
+}
+
+func (m *DeadLetter) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+type Member struct {
+	Id          string       `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Address     string       `protobuf:"bytes,2,opt,name=address" json:"address,omitempty"`
+	State       Member_State `protobuf:"varint,3,opt,name=state,enum=protos.Member_State" json:"state,omitempty"`
+	Incarnation uint64       `protobuf:"varint,4,opt,name=incarnation" json:"incarnation,omitempty"`
+}
+
+func (m *Member) Reset()                    { *m = Member{} }
+func (m *Member) String() string            { return proto.CompactTextString(m) }
+func (*Member) ProtoMessage()               {}
+func (*Member) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+func (m *Member) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Member) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+func (m *Member) GetState() Member_State {
+	if m != nil {
+		return m.State
+	}
+	return Member_ALIVE
+}
+
+func (m *Member) GetIncarnation() uint64 {
+	if m != nil {
+		return m.Incarnation
+	}
+	return 0
+}
+
+type Membership struct {
+	Seq     uint64    `protobuf:"varint,1,opt,name=seq" json:"seq,omitempty"`
+	Src     string    `protobuf:"bytes,2,opt,name=src" json:"src,omitempty"`
+	Dst     string    `protobuf:"bytes,3,opt,name=dst" json:"dst,omitempty"`
+	Target  string    `protobuf:"bytes,4,opt,name=target" json:"target,omitempty"`
+	Members []*Member `protobuf:"bytes,5,rep,name=members" json:"members,omitempty"`
+	Ttl     uint32    `protobuf:"varint,6,opt,name=ttl" json:"ttl,omitempty"`
+}
+
+func (m *Membership) Reset()                    { *m = Membership{} }
+func (m *Membership) String() string            { return proto.CompactTextString(m) }
+func (*Membership) ProtoMessage()               {}
+func (*Membership) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *Membership) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+func (m *Membership) GetSrc() string {
+	if m != nil {
+		return m.Src
+	}
+	return ""
+}
+
+func (m *Membership) GetDst() string {
+	if m != nil {
+		return m.Dst
+	}
+	return ""
+}
+
+func (m *Membership) GetTarget() string {
+	if m != nil {
+		return m.Target
+	}
+	return ""
+}
+
+func (m *Membership) GetMembers() []*Member {
+	if m != nil {
+		return m.Members
+	}
+	return nil
+}
+
+func (m *Membership) GetTtl() uint32 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*Message)(nil), "protos.Message")
 	proto.RegisterType((*Router)(nil), "protos.Router")
 	proto.RegisterType((*Routers)(nil), "protos.Routers")
+	proto.RegisterType((*AreaSummary)(nil), "protos.AreaSummary")
 	proto.RegisterType((*Peer)(nil), "protos.Peer")
 	proto.RegisterType((*Peers)(nil), "protos.Peers")
+	proto.RegisterType((*PeerDigest)(nil), "protos.PeerDigest")
+	proto.RegisterType((*PeerLocation)(nil), "protos.PeerLocation")
+	proto.RegisterType((*PeerLookup)(nil), "protos.PeerLookup")
 	proto.RegisterType((*ChainMessage)(nil), "protos.ChainMessage")
+	proto.RegisterType((*DeadLetter)(nil), "protos.DeadLetter")
+	proto.RegisterType((*Member)(nil), "protos.Member")
+	proto.RegisterType((*Membership)(nil), "protos.Membership")
 	proto.RegisterEnum("protos.Message_Type", Message_Type_name, Message_Type_value)
+	proto.RegisterEnum("protos.Peer_Role", Peer_Role_name, Peer_Role_value)
+	proto.RegisterEnum("protos.ChainMessage_Kind", ChainMessage_Kind_name, ChainMessage_Kind_value)
+	proto.RegisterEnum("protos.DeadLetter_Reason", DeadLetter_Reason_name, DeadLetter_Reason_value)
+	proto.RegisterEnum("protos.Member_State", Member_State_name, Member_State_value)
 }
 
 func init() { proto.RegisterFile("message.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 406 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0x52, 0x4f, 0x8f, 0x93, 0x40,
-	0x14, 0x17, 0x4a, 0x5b, 0xfb, 0x4a, 0x71, 0x9c, 0x54, 0x43, 0x8c, 0x89, 0xcd, 0x9c, 0x38, 0xf5,
-	0x50, 0x8f, 0x9e, 0x1a, 0x76, 0xdc, 0x25, 0xcb, 0xd2, 0x66, 0xe8, 0x9a, 0x78, 0x6a, 0x46, 0x67,
-	0xb2, 0x92, 0xb8, 0x0b, 0x61, 0xe8, 0xa1, 0xdf, 0xd8, 0x0f, 0xe1, 0xc1, 0xcc, 0x0c, 0x7f, 0x6a,
-	0x7a, 0x22, 0xbf, 0xbf, 0x0f, 0x1e, 0x0f, 0x16, 0xcf, 0x52, 0x29, 0xfe, 0x24, 0xd7, 0x55, 0x5d,
-	0x36, 0x25, 0x9e, 0x98, 0x87, 0x22, 0x7f, 0x5c, 0x98, 0x3e, 0x58, 0x05, 0x47, 0xe0, 0x35, 0xe7,
-	0x4a, 0x86, 0xce, 0xca, 0x89, 0x82, 0xcd, 0xd2, 0x3a, 0xd5, 0xba, 0x95, 0xd7, 0x87, 0x73, 0x25,
-	0x99, 0x71, 0xe0, 0x10, 0xa6, 0x15, 0x3f, 0xff, 0x2e, 0xb9, 0x08, 0xdd, 0x95, 0x13, 0xf9, 0xac,
-	0x83, 0xf8, 0x03, 0xbc, 0x7e, 0x96, 0x0d, 0x17, 0xbc, 0xe1, 0xe1, 0xc8, 0x48, 0x3d, 0x26, 0x7f,
-	0x1d, 0xf0, 0x74, 0x09, 0x5e, 0xc0, 0xec, 0x31, 0xbb, 0xa1, 0x5f, 0x93, 0x8c, 0xde, 0xa0, 0x57,
-	0x18, 0x81, 0xcf, 0x76, 0x8f, 0x07, 0xca, 0x8e, 0x77, 0x34, 0x4d, 0x77, 0xc8, 0xc1, 0x4b, 0x40,
-	0x97, 0xcc, 0x71, 0x1b, 0xdf, 0x23, 0xf7, 0xc2, 0x17, 0xa7, 0xbb, 0x9c, 0xa2, 0x11, 0x0e, 0x00,
-	0x5a, 0xe6, 0x96, 0x1e, 0x90, 0x87, 0x31, 0x04, 0x03, 0x36, 0xa9, 0x31, 0x7e, 0x03, 0xf3, 0x96,
-	0xcb, 0xbf, 0x67, 0x31, 0x9a, 0xe8, 0xd0, 0x9e, 0xf6, 0xc3, 0xe6, 0x3a, 0x34, 0x60, 0x13, 0xf2,
-	0x7b, 0x8f, 0x1d, 0xb4, 0xd0, 0x6f, 0x6c, 0xb0, 0xa9, 0x08, 0xf0, 0x5b, 0x58, 0xc4, 0x77, 0xdb,
-	0x24, 0x3b, 0x3e, 0xd0, 0x3c, 0xdf, 0xde, 0x52, 0xf4, 0x4e, 0x3b, 0xee, 0x29, 0xdd, 0x6f, 0xd3,
-	0xe4, 0x1b, 0x45, 0x9f, 0xb4, 0xa3, 0x87, 0xa6, 0x73, 0x45, 0x36, 0x30, 0x61, 0xe5, 0xa9, 0x91,
-	0x35, 0x0e, 0xc0, 0x2d, 0x84, 0x59, 0xf3, 0x8c, 0xb9, 0x85, 0xd0, 0xeb, 0xe4, 0x42, 0xd4, 0x52,
-	0x29, 0xb3, 0xce, 0x19, 0xeb, 0x20, 0x89, 0x61, 0x6a, 0x33, 0xea, 0x2a, 0x14, 0xc1, 0xb4, 0xb6,
-	0x52, 0xe8, 0xae, 0x46, 0xd1, 0x7c, 0x13, 0x74, 0x3f, 0xcc, 0x26, 0x58, 0x27, 0x93, 0xf7, 0xe0,
-	0xed, 0xe5, 0xf5, 0x58, 0xf2, 0x05, 0xc6, 0x9a, 0xbf, 0xae, 0x26, 0x30, 0xae, 0xe4, 0x50, 0xec,
-	0x77, 0xc5, 0xda, 0xcd, 0xac, 0x44, 0x6a, 0xf0, 0xe3, 0x5f, 0xbc, 0x78, 0xe9, 0x8e, 0x67, 0x09,
-	0x63, 0x55, 0xff, 0x4c, 0xba, 0x1a, 0x0b, 0x34, 0x2b, 0x54, 0x93, 0x88, 0xf6, 0xbb, 0x2c, 0xb8,
-	0x3c, 0x9f, 0xd1, 0xff, 0xe7, 0xf3, 0x11, 0x66, 0xaa, 0x78, 0x7a, 0xe1, 0xcd, 0xa9, 0x96, 0xa1,
-	0x67, 0xb4, 0x81, 0xf8, 0x61, 0x8f, 0xf6, 0xf3, 0xbf, 0x00, 0x00, 0x00, 0xff, 0xff, 0x4a, 0xb0,
-	0x6e, 0x8f, 0xcc, 0x02, 0x00, 0x00,
+	// 1393 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x56, 0xcb, 0x8e, 0xdb, 0x36,
+	0x17, 0x8e, 0x2d, 0xf9, 0x76, 0x7c, 0x19, 0x0e, 0x33, 0x7f, 0x7e, 0x35, 0x08, 0x5a, 0x43, 0x40,
+	0x01, 0x23, 0x40, 0x07, 0x6d, 0xd2, 0x45, 0xda, 0x9d, 0x62, 0x73, 0x26, 0xc2, 0xc8, 0x97, 0xd2,
+	0x76, 0x2e, 0x2b, 0x83, 0xb6, 0x88, 0x89, 0x10, 0xdb, 0x72, 0x24, 0x79, 0x50, 0x77, 0xd7, 0x6d,
+	0x1f, 0xa0, 0x6f, 0xd2, 0x27, 0x68, 0xfb, 0x0e, 0x7d, 0x9c, 0xe2, 0x90, 0x92, 0xac, 0xc9, 0x4c,
+	0x17, 0x59, 0x49, 0xdf, 0xe1, 0xe1, 0x77, 0xee, 0x24, 0xa1, 0xbd, 0x91, 0x71, 0x2c, 0xae, 0xe5,
+	0xf9, 0x2e, 0x0a, 0x93, 0x90, 0x56, 0xd5, 0x27, 0xb6, 0xff, 0x32, 0xa1, 0x36, 0xd4, 0x2b, 0xb4,
+	0x07, 0x66, 0x72, 0xd8, 0x49, 0xab, 0xd4, 0x2d, 0xf5, 0x3a, 0xcf, 0xce, 0xb4, 0x66, 0x7c, 0x9e,
+	0x2e, 0x9f, 0xcf, 0x0e, 0x3b, 0xc9, 0x95, 0x06, 0xb5, 0xa0, 0xb6, 0x13, 0x87, 0x75, 0x28, 0x7c,
+	0xab, 0xdc, 0x2d, 0xf5, 0x5a, 0x3c, 0x83, 0xf4, 0x31, 0xd4, 0x37, 0x32, 0x11, 0xbe, 0x48, 0x84,
+	0x65, 0xa8, 0xa5, 0x1c, 0xdb, 0xff, 0x18, 0x60, 0x22, 0x09, 0x6d, 0x43, 0x63, 0x3e, 0x1a, 0xb0,
+	0x0b, 0x77, 0xc4, 0x06, 0xe4, 0x01, 0x25, 0xd0, 0xe2, 0xe3, 0xf9, 0x8c, 0xf1, 0xc5, 0x2b, 0xe6,
+	0x79, 0x63, 0x52, 0xa2, 0x67, 0x40, 0x8a, 0x92, 0x85, 0xd3, 0xbf, 0x22, 0xe5, 0x82, 0x5e, 0xdf,
+	0x1b, 0x4f, 0x19, 0x31, 0x68, 0x07, 0x20, 0x95, 0x5c, 0xb2, 0x19, 0x31, 0x29, 0x85, 0xce, 0x11,
+	0xab, 0x5d, 0x15, 0x7a, 0x02, 0xcd, 0x54, 0x36, 0x7d, 0x37, 0xea, 0x93, 0x6a, 0x41, 0x69, 0x3a,
+	0x1f, 0x0e, 0x1d, 0xfe, 0x8e, 0xd4, 0x50, 0x69, 0xc8, 0x86, 0x2f, 0x19, 0x5f, 0x4c, 0xdc, 0xd1,
+	0x25, 0xa9, 0xd3, 0x87, 0x70, 0x52, 0x10, 0x2c, 0x38, 0xfb, 0x89, 0x34, 0xd0, 0x5c, 0x2a, 0x44,
+	0x6a, 0x40, 0x3c, 0x61, 0xb9, 0xdb, 0x4d, 0x64, 0x3e, 0x62, 0xa5, 0xd3, 0xca, 0x75, 0xb4, 0xcb,
+	0x6d, 0x8c, 0x7d, 0xc2, 0x32, 0x67, 0x3a, 0x18, 0x93, 0x82, 0x43, 0xf7, 0x92, 0x3b, 0x33, 0x46,
+	0x4e, 0xd0, 0x15, 0x25, 0xf1, 0xc6, 0xe3, 0xab, 0xf9, 0x84, 0x10, 0x74, 0xa5, 0x20, 0x50, 0xb4,
+	0xa7, 0xf4, 0x14, 0xda, 0x9a, 0x76, 0x3c, 0xba, 0xf0, 0xdc, 0xfe, 0x8c, 0xd0, 0x7c, 0xe3, 0xc0,
+	0xbd, 0x64, 0xd3, 0x19, 0x79, 0x98, 0x0b, 0x38, 0x53, 0xc6, 0xce, 0x72, 0xff, 0x94, 0x2f, 0x8a,
+	0xe8, 0xff, 0x48, 0xd4, 0x7f, 0xe5, 0xb8, 0xa3, 0xc5, 0x90, 0x4d, 0xa7, 0xce, 0x25, 0x23, 0xff,
+	0xc3, 0x7d, 0x03, 0xe6, 0x0c, 0x16, 0x1e, 0x9b, 0xcd, 0x18, 0x27, 0x8f, 0xd0, 0xe7, 0x2b, 0xc6,
+	0x26, 0x8e, 0xe7, 0xbe, 0x66, 0xe4, 0x2b, 0xdc, 0x92, 0x43, 0xc5, 0xd2, 0xb5, 0x5f, 0x41, 0x95,
+	0x87, 0xfb, 0x44, 0x46, 0xb4, 0x03, 0xe5, 0xc0, 0x57, 0x2d, 0xd4, 0xe0, 0xe5, 0xc0, 0xc7, 0x56,
+	0x11, 0xbe, 0x1f, 0xc9, 0x38, 0x56, 0xad, 0xd2, 0xe0, 0x19, 0xa4, 0x67, 0x50, 0x11, 0x91, 0x14,
+	0xb1, 0x65, 0x74, 0x8d, 0x5e, 0x83, 0x6b, 0x60, 0xbf, 0x81, 0x9a, 0x66, 0x8a, 0xef, 0x50, 0xf5,
+	0xa0, 0x16, 0xe9, 0x25, 0xab, 0xdc, 0x35, 0x7a, 0xcd, 0x67, 0x9d, 0xac, 0x45, 0xf5, 0x0e, 0x9e,
+	0x2d, 0x53, 0x0a, 0x26, 0xb2, 0xa9, 0x0e, 0x6c, 0x70, 0xf5, 0x6f, 0x1f, 0xa0, 0xe9, 0x44, 0x52,
+	0x4c, 0xf7, 0x9b, 0x8d, 0x88, 0x0e, 0x77, 0xc8, 0xb3, 0x2d, 0xe5, 0xe3, 0x16, 0xf4, 0x50, 0xee,
+	0xc2, 0xd5, 0x7b, 0xc5, 0x63, 0x70, 0x0d, 0x30, 0xa2, 0x1b, 0x19, 0xc5, 0x41, 0xb8, 0xb5, 0xcc,
+	0x6e, 0xa9, 0x67, 0xf2, 0x0c, 0xd2, 0x47, 0x50, 0x5d, 0xbd, 0x17, 0xc1, 0x36, 0xb6, 0x2a, 0x2a,
+	0xa4, 0x14, 0xd9, 0xbf, 0x19, 0x60, 0x4e, 0xe4, 0xfd, 0xc9, 0x51, 0x2a, 0xae, 0x9f, 0x25, 0x27,
+	0x85, 0x48, 0xb5, 0x0d, 0x7d, 0xe9, 0xfa, 0x69, 0x0c, 0x29, 0xa2, 0x5f, 0x83, 0x19, 0x85, 0x6b,
+	0xa9, 0x2c, 0x77, 0x9e, 0x9d, 0x66, 0x09, 0x40, 0xf6, 0x73, 0x1e, 0xae, 0x25, 0x57, 0xcb, 0xd4,
+	0x86, 0xd6, 0x4a, 0xec, 0xc4, 0x32, 0x58, 0x07, 0x49, 0x20, 0x33, 0x7f, 0x6e, 0xc9, 0xe8, 0xb7,
+	0x50, 0x5d, 0x8b, 0xa5, 0x5c, 0xc7, 0x56, 0x55, 0x65, 0xd3, 0xba, 0x45, 0xe6, 0xa9, 0x25, 0xb6,
+	0x4d, 0xa2, 0x03, 0x4f, 0xf5, 0x70, 0xb8, 0x83, 0x6d, 0x9c, 0x88, 0xed, 0x4a, 0x5a, 0x35, 0xe5,
+	0x56, 0x8e, 0x31, 0x94, 0x38, 0x11, 0x51, 0x22, 0x7d, 0xab, 0xae, 0xb2, 0x95, 0x41, 0xfa, 0x04,
+	0x1a, 0xbb, 0xfd, 0x72, 0x1d, 0xac, 0xae, 0xe4, 0xc1, 0x6a, 0xa8, 0x33, 0xe1, 0x28, 0x78, 0xfc,
+	0x03, 0x34, 0x0b, 0xa6, 0x28, 0x01, 0xe3, 0x83, 0x3c, 0xa4, 0x29, 0xc2, 0x5f, 0x2c, 0xc2, 0x8d,
+	0x58, 0xef, 0x65, 0x9a, 0x21, 0x0d, 0x7e, 0x2c, 0xbf, 0x28, 0xd9, 0xdf, 0x83, 0x89, 0x21, 0x63,
+	0xbf, 0xce, 0x47, 0xd3, 0x09, 0xeb, 0xbb, 0x17, 0xae, 0x3a, 0x50, 0xda, 0xd0, 0x78, 0xed, 0x78,
+	0xee, 0xc0, 0x99, 0x8d, 0x39, 0x29, 0xd1, 0x16, 0xd4, 0xc7, 0x2f, 0xa7, 0x8c, 0xbf, 0x66, 0x9c,
+	0x94, 0xed, 0x3f, 0x4b, 0x50, 0x99, 0xc8, 0xfb, 0xfa, 0xcb, 0x86, 0xca, 0x4e, 0x1e, 0xbb, 0xab,
+	0x55, 0xcc, 0x07, 0xd7, 0x4b, 0x9f, 0xdd, 0x12, 0x67, 0x50, 0xf1, 0xe5, 0x3a, 0x11, 0x56, 0xa5,
+	0x5b, 0xea, 0xd5, 0xb9, 0x06, 0xd8, 0x6c, 0x4b, 0x11, 0x4b, 0xab, 0xaa, 0x94, 0xd5, 0x3f, 0x72,
+	0x44, 0x72, 0x13, 0xde, 0x48, 0xdf, 0xaa, 0xa9, 0x6a, 0x65, 0x30, 0x6f, 0xcd, 0x7a, 0xa1, 0x9b,
+	0x6f, 0x00, 0xd0, 0xad, 0x41, 0x70, 0x2d, 0xe3, 0xe4, 0x4e, 0x24, 0xb9, 0x97, 0xe5, 0xff, 0xf0,
+	0xd2, 0xb8, 0xe3, 0xe5, 0x2a, 0xdc, 0x6f, 0x13, 0xe5, 0x7d, 0x9b, 0x6b, 0x90, 0xdb, 0xad, 0x14,
+	0xec, 0xbe, 0x80, 0x16, 0xda, 0xf5, 0xc2, 0x95, 0x48, 0x70, 0xe7, 0x3d, 0x1d, 0x5d, 0x9c, 0xd1,
+	0x46, 0x3e, 0x93, 0xf6, 0x52, 0x7b, 0xec, 0x85, 0xe1, 0x87, 0xfd, 0xee, 0xbe, 0x7d, 0x3b, 0x91,
+	0x24, 0x32, 0xda, 0x66, 0x93, 0x90, 0x42, 0xfa, 0x34, 0xab, 0x8a, 0xa1, 0xaa, 0x72, 0x56, 0xac,
+	0x4a, 0xe6, 0x46, 0x5a, 0x1d, 0xfb, 0x57, 0x13, 0x5a, 0x7d, 0x9c, 0xa0, 0xec, 0x4a, 0x3b, 0x83,
+	0x4a, 0x1c, 0xad, 0xdc, 0xcc, 0x92, 0x06, 0xaa, 0x28, 0x71, 0x92, 0x0f, 0x9d, 0x06, 0xc5, 0x4b,
+	0xcd, 0xb8, 0x7d, 0xa9, 0x3d, 0x81, 0x46, 0x1c, 0x5c, 0x6f, 0x45, 0xb2, 0x8f, 0xf4, 0xe4, 0xb5,
+	0xf8, 0x51, 0x90, 0x86, 0x52, 0xc9, 0x43, 0x79, 0x0c, 0xf5, 0x58, 0xae, 0xe5, 0x2a, 0x09, 0x23,
+	0x55, 0xe0, 0x06, 0xcf, 0x31, 0x8e, 0x75, 0x2c, 0xc5, 0x5a, 0xd5, 0x18, 0xfb, 0x21, 0x45, 0x68,
+	0x21, 0x09, 0x36, 0x32, 0x4e, 0xc4, 0x66, 0x97, 0xce, 0xcf, 0x51, 0xa0, 0x19, 0x3f, 0xee, 0x25,
+	0xce, 0x5d, 0x43, 0x55, 0x2e, 0xc7, 0xf4, 0x1b, 0x30, 0x3f, 0x04, 0x5b, 0xdf, 0x02, 0x75, 0x20,
+	0x7c, 0x91, 0x65, 0xa7, 0x98, 0x85, 0xf3, 0xab, 0x60, 0xeb, 0x73, 0xa5, 0x86, 0xa1, 0x87, 0x91,
+	0x2f, 0x23, 0xab, 0xa9, 0x78, 0x34, 0xa0, 0x5f, 0x02, 0xa8, 0x1f, 0xa6, 0x9a, 0xa6, 0xa5, 0xec,
+	0x17, 0x24, 0xe8, 0x40, 0x24, 0xd7, 0x81, 0x58, 0xae, 0xa5, 0xd5, 0x56, 0x8e, 0xe7, 0x18, 0xd3,
+	0x26, 0x7f, 0xde, 0x05, 0x91, 0x8c, 0xad, 0x8e, 0x1e, 0xfc, 0x14, 0xe2, 0x4a, 0x12, 0x89, 0x15,
+	0x1e, 0x62, 0x27, 0xba, 0xa6, 0x29, 0x54, 0x69, 0xd8, 0x09, 0x3c, 0xf6, 0x88, 0x3e, 0xdd, 0x34,
+	0xc2, 0x1d, 0xb1, 0xd8, 0xec, 0x30, 0x3f, 0xa7, 0xca, 0x4c, 0x06, 0xed, 0x1e, 0x98, 0x18, 0x05,
+	0xad, 0x83, 0x39, 0x70, 0x66, 0x8e, 0x1e, 0x72, 0xce, 0x06, 0x0c, 0x2f, 0x21, 0x1c, 0xf2, 0x1a,
+	0x18, 0xea, 0x95, 0x60, 0xff, 0x5d, 0x06, 0x18, 0x48, 0xe1, 0x7b, 0x32, 0xb9, 0xef, 0x3e, 0xca,
+	0x3b, 0xa2, 0x7c, 0x6f, 0x47, 0x18, 0xc5, 0x8e, 0xf8, 0x0e, 0xaa, 0x78, 0x27, 0xa5, 0x53, 0x5d,
+	0xc8, 0xee, 0x91, 0xff, 0x9c, 0x2b, 0x05, 0x9e, 0x2a, 0x62, 0x64, 0xba, 0xe1, 0xd3, 0x86, 0x48,
+	0x11, 0xca, 0x7d, 0x99, 0x88, 0x60, 0x9d, 0xb6, 0x44, 0x8a, 0x6e, 0x17, 0xbe, 0xf6, 0x49, 0xe1,
+	0xed, 0x5f, 0xa0, 0xaa, 0xf9, 0x69, 0x13, 0x6a, 0xf3, 0xd1, 0xd5, 0x68, 0xfc, 0x66, 0x44, 0x1e,
+	0xe0, 0x81, 0x36, 0x1a, 0x2f, 0xd4, 0x23, 0x86, 0x94, 0xf0, 0x85, 0xe1, 0xf4, 0xbd, 0xc5, 0x80,
+	0x8d, 0xf0, 0xf4, 0x2b, 0xe3, 0x71, 0x38, 0x9b, 0x79, 0x0b, 0xf6, 0x76, 0xe2, 0x72, 0x36, 0x20,
+	0x06, 0x66, 0x6a, 0x36, 0x1e, 0x2f, 0x3c, 0x87, 0x5f, 0x32, 0x62, 0xe2, 0x93, 0x63, 0xe8, 0xb8,
+	0xde, 0xcb, 0xf1, 0xdb, 0xc5, 0xc5, 0xdc, 0xf3, 0x48, 0x05, 0x5f, 0x18, 0x69, 0x22, 0xdf, 0x2d,
+	0x2e, 0x1c, 0xd7, 0x63, 0x03, 0x52, 0xb5, 0xff, 0x28, 0x41, 0x75, 0x28, 0x37, 0xcb, 0xcf, 0xba,
+	0xd3, 0x9f, 0x42, 0x25, 0x4e, 0x44, 0x22, 0x2d, 0xe3, 0xd3, 0x37, 0x24, 0x12, 0x9d, 0x4f, 0x71,
+	0x8d, 0x6b, 0x15, 0xda, 0x85, 0x66, 0xb0, 0x5d, 0x89, 0x68, 0xab, 0x46, 0x38, 0x3d, 0x38, 0x8b,
+	0x22, 0xfb, 0x39, 0x54, 0xd4, 0x0e, 0xda, 0x80, 0x8a, 0x7e, 0x7c, 0x3c, 0xc0, 0x44, 0x4c, 0xe7,
+	0x78, 0xd8, 0xcf, 0x48, 0x49, 0x75, 0x03, 0x73, 0x30, 0xe8, 0x3a, 0x98, 0x1e, 0xbb, 0x98, 0x11,
+	0xc3, 0xfe, 0xbd, 0x04, 0xa0, 0xcd, 0xc5, 0xef, 0x83, 0x1d, 0x5e, 0x28, 0xb1, 0xfc, 0xa8, 0x9c,
+	0x37, 0x39, 0xfe, 0x2a, 0x49, 0xb4, 0x4a, 0x3d, 0xc7, 0x5f, 0x94, 0xf8, 0x71, 0x92, 0xd6, 0x1e,
+	0x7f, 0xb1, 0x5c, 0x89, 0x88, 0xae, 0xa5, 0x3e, 0x11, 0x1b, 0x3c, 0x45, 0xf8, 0x04, 0xd9, 0x68,
+	0x6e, 0xab, 0x72, 0xfb, 0x09, 0xa2, 0x4d, 0xf2, 0x6c, 0x19, 0x39, 0x93, 0x44, 0x57, 0xbb, 0xcd,
+	0xf1, 0x77, 0xa9, 0x9f, 0xdc, 0xcf, 0xff, 0x1d, 0x00, 0x77, 0x75, 0x3b, 0x8c, 0x8a, 0x0b, 0x00,
+	0x00,
 }
@@ -0,0 +1,179 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package protos
+
+import (
+	"fmt"
+	"strings"
+)
+
+//selector keys referring to peer fields, other keys refer to labels
+const (
+	SelectorChain      = "chain"
+	SelectorNode       = "node"
+	SelectorRole       = "role"
+	SelectorCapability = "capability"
+)
+
+//Chain returns chain id of peer, it falls back to the "chainID:" prefix of id
+func (m *Peer) Chain() string {
+	if m.ChainId != "" {
+		return m.ChainId
+	}
+	if i := strings.Index(m.Id, ":"); i >= 0 {
+		return m.Id[:i]
+	}
+	return ""
+}
+
+//Node returns node id of peer, it falls back to the part of id after "chainID:"
+func (m *Peer) Node() string {
+	if m.NodeId != "" {
+		return m.NodeId
+	}
+	if i := strings.Index(m.Id, ":"); i >= 0 {
+		return m.Id[i+1:]
+	}
+	return m.Id
+}
+
+//MatchID matches peer id, id ending with ":" matches all peers of the chain
+func (m *Peer) MatchID(id string) bool {
+	if strings.HasSuffix(id, ":") {
+		return strings.HasPrefix(m.Id, id) || m.Chain()+":" == id
+	}
+	return m.Id == id
+}
+
+//HasCapability peer has capability or not
+func (m *Peer) HasCapability(capability string) bool {
+	for _, c := range m.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+//ParseRole parses role name, case insensitive
+func ParseRole(name string) (Peer_Role, error) {
+	if v, ok := Peer_Role_value[strings.ToUpper(name)]; ok {
+		return Peer_Role(v), nil
+	}
+	return Peer_UNSPECIFIED, fmt.Errorf("unknown peer role %q", name)
+}
+
+type selectorTerm struct {
+	key    string
+	value  string
+	negate bool
+	exists bool
+}
+
+//Selector peer label selector, terms are separated by "," and all of them must match.
+//A term is "key=value", "key!=value" or "key" which requires the key to be present.
+//Keys chain, node, role and capability refer to peer fields, others refer to labels,
+//e.g. "chain=A,role=validator,region=eu"
+type Selector []selectorTerm
+
+//ParseSelector parses selector, empty string matches all peers
+func ParseSelector(s string) (Selector, error) {
+	selector := Selector{}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		t := selectorTerm{}
+		if i := strings.Index(term, "!="); i >= 0 {
+			t.key, t.value, t.negate = term[:i], term[i+2:], true
+		} else if i := strings.Index(term, "="); i >= 0 {
+			t.key, t.value = term[:i], term[i+1:]
+		} else {
+			t.key, t.exists = term, true
+		}
+		t.key, t.value = strings.TrimSpace(t.key), strings.TrimSpace(t.value)
+		if t.key == "" || strings.ContainsAny(t.key, "=!") || strings.ContainsAny(t.value, "=!") {
+			return nil, fmt.Errorf("invalid selector term %q", term)
+		}
+		if t.key == SelectorRole && !t.exists {
+			if _, err := ParseRole(t.value); err != nil {
+				return nil, err
+			}
+		}
+		selector = append(selector, t)
+	}
+	return selector, nil
+}
+
+//Matches peer matches all terms or not
+func (s Selector) Matches(peer *Peer) bool {
+	for _, t := range s {
+		if !t.matches(peer) {
+			return false
+		}
+	}
+	return true
+}
+
+//String returns selector in the form accepted by ParseSelector
+func (s Selector) String() string {
+	terms := []string{}
+	for _, t := range s {
+		switch {
+		case t.exists:
+			terms = append(terms, t.key)
+		case t.negate:
+			terms = append(terms, t.key+"!="+t.value)
+		default:
+			terms = append(terms, t.key+"="+t.value)
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+func (t selectorTerm) matches(peer *Peer) bool {
+	var value string
+	var ok bool
+	switch t.key {
+	case SelectorChain:
+		value = peer.Chain()
+		ok = value != ""
+	case SelectorNode:
+		value = peer.Node()
+		ok = value != ""
+	case SelectorRole:
+		value = strings.ToLower(peer.Role.String())
+		ok = peer.Role != Peer_UNSPECIFIED
+	case SelectorCapability:
+		if t.exists {
+			return len(peer.Capabilities) > 0
+		}
+		return peer.HasCapability(t.value) != t.negate
+	default:
+		value, ok = peer.Labels[t.key]
+	}
+	if t.exists {
+		return ok
+	}
+	if t.key == SelectorRole {
+		return strings.EqualFold(value, t.value) != t.negate
+	}
+	return (ok && value == t.value) != t.negate
+}
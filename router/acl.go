@@ -0,0 +1,70 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package router
+
+import (
+	"fmt"
+
+	"github.com/bocheninc/msg-net/config"
+	"github.com/bocheninc/msg-net/logger"
+	pb "github.com/bocheninc/msg-net/protos"
+	"github.com/bocheninc/msg-net/router/policy"
+)
+
+//loadPolicy loads route policy file, all messages are denied if it fails at start, the current policy is kept if it fails on reload
+func (r *Router) loadPolicy() {
+	path := config.GetString("router.policy.path")
+	if path == "" {
+		r.acl.Set(nil)
+		return
+	}
+	p, err := policy.Load(path)
+	if err != nil {
+		if r.aclLoaded {
+			logger.Errorf("router %s failed to reload route policy %s, current policy is kept --- %v", r.address, path, err)
+		} else {
+			logger.Errorf("router %s failed to load route policy %s, all messages are denied --- %v", r.address, path, err)
+			r.acl.Set(policy.DenyAll())
+		}
+		return
+	}
+	r.aclLoaded = true
+	r.acl.Set(p)
+	logger.Infof("router %s loaded route policy %s, %d rules, default %s, dry run %v", r.address, path, len(p.Rules), p.Default, p.DryRun)
+}
+
+//admitMsg evaluates chain message against route policy, it is done by the router the source peer is attached to.
+//It returns the action and rule of denied message
+func (r *Router) admitMsg(chainMsg *pb.ChainMessage) (bool, string) {
+	d := r.acl.Evaluate(&policy.Message{
+		Src:  chainMsg.SrcId,
+		Dst:  chainMsg.DstId,
+		Kind: policy.KindOf(chainMsg.DstId, chainMsg.Selector),
+		Size: len(chainMsg.Payload),
+	})
+	if d.Allowed {
+		return true, ""
+	}
+	if d.DryRun {
+		logger.Infof("router %s would %s message %s from %s to %s by rule %q (dry run)", r.address, d.Action, chainMsg.Id, chainMsg.SrcId, chainMsg.DstId, d.Rule)
+		return true, ""
+	}
+	logger.Warnf("router %s %s message %s from %s to %s by rule %q", r.address, d.Action, chainMsg.Id, chainMsg.SrcId, chainMsg.DstId, d.Rule)
+	return false, fmt.Sprintf("%s by rule %q", d.Action, d.Rule)
+}
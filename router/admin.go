@@ -0,0 +1,167 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package router
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bocheninc/msg-net/config"
+	"github.com/bocheninc/msg-net/logger"
+	"github.com/bocheninc/msg-net/router/deadletter"
+)
+
+var errNoDeadLetterLog = errors.New("dead letter file is not configured")
+
+var errReplaySource = errors.New("source peer of dead letter is not attached to this router")
+
+//isLoopback address listens on loopback interface only
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+//startAdmin serves admin api on router.admin.address, empty disables it.
+//It exposes payloads of dead letters, so it needs router.admin.token unless it is bound to loopback
+func (r *Router) startAdmin() {
+	address := config.GetString("router.admin.address")
+	if address == "" {
+		return
+	}
+	token := config.GetString("router.admin.token")
+	if token == "" && !isLoopback(address) {
+		logger.Errorf("router %s refuses to serve admin api on %s without router.admin.token, bind it to loopback or set a token", r.address, address)
+		return
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		logger.Errorf("router %s failed to serve admin api on %s --- %v", r.address, address, err)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/deadletters", r.adminDeadLetters)
+	mux.HandleFunc("/deadletters/replay", r.adminReplay)
+	mux.HandleFunc("/topology", r.adminTopology)
+	r.admin = &http.Server{Handler: adminAuth(token, mux)}
+	logger.Infof("router %s serves admin api on %s", r.address, listener.Addr())
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("router %s admin api stopped --- %v", r.address, err)
+		}
+	}(r.admin)
+}
+
+//adminAuth requires header "Authorization: Bearer token" if token is set
+func adminAuth(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (r *Router) stopAdmin() {
+	if r.admin != nil {
+		r.admin.Close()
+		r.admin = nil
+	}
+}
+
+//adminDeadLetters GET /deadletters?limit=n lists the latest dead letters, 100 by default
+func (r *Router) adminDeadLetters(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := 100
+	if s := req.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	letters, err := r.DeadLetters(limit)
+	if err == errNoDeadLetterLog {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, letters)
+}
+
+//adminReplay POST /deadletters/replay?id=x routes the dead letter of message id again
+func (r *Router) adminReplay(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := req.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id is not specified", http.StatusBadRequest)
+		return
+	}
+	switch err := r.ReplayDeadLetter(id); err {
+	case nil:
+		writeJSON(w, map[string]string{"replayed": id})
+	case errNoDeadLetterLog, deadletter.ErrNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errReplaySource:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+//adminTopology GET /topology returns the mesh seen by this router
+func (r *Router) adminTopology(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, r.Topology())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Errorf("failed to json marshal --- %v", err)
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package router
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bocheninc/msg-net/config"
+	"github.com/bocheninc/msg-net/logger"
+	"github.com/bocheninc/msg-net/net/common"
+	pb "github.com/bocheninc/msg-net/protos"
+	"github.com/bocheninc/msg-net/util"
+)
+
+//BackboneArea 骨干区域，边界路由器同时属于骨干区域和自身区域
+const BackboneArea = ""
+
+//summaryExpire summaries not refreshed within the multiple of peer digest interval are dropped
+const summaryExpire = 3
+
+//summaryDelay summaries are recomputed after the delay, changes within it are summarized together
+var summaryDelay = 200 * time.Millisecond
+
+//loadAreas returns area of local router and all areas it is in
+func loadAreas() (string, []string) {
+	area := config.GetString("router.area")
+	areas := []string{area}
+	if area != BackboneArea && config.GetBool("router.border") {
+		areas = append(areas, BackboneArea)
+	}
+	return area, areas
+}
+
+//routerAreas areas of router, routers not telling areas are in the backbone
+func routerAreas(router *pb.Router) []string {
+	if router == nil || len(router.Areas) == 0 {
+		return []string{BackboneArea}
+	}
+	return router.Areas
+}
+
+//routerSelf router told to neighbours in hello
+func (r *Router) routerSelf() *pb.Router {
+	return &pb.Router{Id: r.id, Address: r.address, Areas: r.areas}
+}
+
+func (r *Router) inArea(area string) bool {
+	return util.IsStrExist(area, r.areas)
+}
+
+func (r *Router) isBorder() bool {
+	return len(r.areas) > 1
+}
+
+//sharedAreas areas both local router and neighbour router are in, links are only set up within them
+func (r *Router) sharedAreas(router *pb.Router) []string {
+	areas := []string{}
+	for _, area := range routerAreas(router) {
+		if r.inArea(area) {
+			areas = append(areas, area)
+		}
+	}
+	return areas
+}
+
+//inScope conn is reached by floods of area, peers and routers not said hello are in the area of local router
+func (r *Router) inScope(conn net.Conn, area string) bool {
+	r.rwRouters.RLock()
+	defer r.rwRouters.RUnlock()
+	for key, c := range r.connRouters {
+		if c == conn {
+			return util.IsStrExist(area, routerAreas(r.routers[key]))
+		}
+	}
+	return area == r.area
+}
+
+//broadcastArea floods msg to the neighbours in area
+func (r *Router) broadcastArea(msg *pb.Message, area string) {
+	send := func(conn net.Conn, msg common.IMsg) error {
+		if r.inScope(conn, area) {
+			(&common.Handler{}).Send(conn, msg)
+		}
+		return nil
+	}
+	r.server.BroadCastToClient(msg, send)
+	r.server.BroadCastToServer(msg, send)
+}
+
+//matchChain id is of chain, it matches both "chain:node" and "chain:"
+func matchChain(id, chain string) bool {
+	return chain != "" && strings.HasPrefix(id, chain+":")
+}
+
+//NewSummaries make new summaries struct
+func NewSummaries() *Summaries {
+	return &Summaries{m: make(map[string]map[string]*summary)}
+}
+
+//Summaries chains reachable through border routers, kept by area the summaries are flooded in
+type Summaries struct {
+	m map[string]map[string]*summary
+	sync.RWMutex
+}
+
+type summary struct {
+	*pb.AreaSummary
+	received time.Time
+}
+
+//Update applies summary of border router, it returns true if the chains change
+func (s *Summaries) Update(update *pb.AreaSummary) bool {
+	s.Lock()
+	defer s.Unlock()
+	borders, ok := s.m[update.Area]
+	if !ok {
+		borders = make(map[string]*summary)
+		s.m[update.Area] = borders
+	}
+	known, ok := borders[update.Id]
+	if ok && known.Epoch == update.Epoch && known.Version >= update.Version {
+		return false
+	}
+	borders[update.Id] = &summary{AreaSummary: update, received: time.Now()}
+	return !ok || !equalStrings(known.Chains, update.Chains)
+}
+
+//Keys gets border routers advertising chain of id, summaries older than expire are skipped
+func (s *Summaries) Keys(id string, expire time.Duration) (res []string) {
+	s.RLock()
+	defer s.RUnlock()
+	for _, borders := range s.m {
+		for key, sum := range borders {
+			if time.Since(sum.received) > expire || util.IsStrExist(key, res) {
+				continue
+			}
+			for _, chain := range sum.Chains {
+				if matchChain(id, chain) {
+					res = append(res, key)
+					break
+				}
+			}
+		}
+	}
+	return res
+}
+
+//Chains gets chains advertised in area by border routers, the routers of skip are skipped
+func (s *Summaries) Chains(area string, skip map[string]bool, expire time.Duration) []string {
+	s.RLock()
+	defer s.RUnlock()
+	res := []string{}
+	for key, sum := range s.m[area] {
+		if skip[key] || time.Since(sum.received) > expire {
+			continue
+		}
+		res = append(res, sum.Chains...)
+	}
+	return res
+}
+
+//Borders gets border routers advertising summaries in area
+func (s *Summaries) Borders(area string) map[string]bool {
+	s.RLock()
+	defer s.RUnlock()
+	res := make(map[string]bool)
+	for key := range s.m[area] {
+		res[key] = true
+	}
+	return res
+}
+
+//Len number of summaries kept
+func (s *Summaries) Len() int {
+	s.RLock()
+	defer s.RUnlock()
+	n := 0
+	for _, borders := range s.m {
+		n += len(borders)
+	}
+	return n
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Router) summaryExpire() time.Duration {
+	return summaryExpire * r.timeout(&r.durationNetworkPeers)
+}
+
+//summarize chains reachable through local router from its other areas.
+//Summaries of the backbone are passed on into the own area, those of the own area never go back into the backbone,
+//and summaries of border routers of the same area are skipped, so chains do not loop between areas
+func (r *Router) summarize(area string) []string {
+	set := make(map[string]bool)
+	for _, other := range r.areas {
+		if other == area {
+			continue
+		}
+		for _, chain := range r.allPeers.Chains(other) {
+			set[chain] = true
+		}
+		if other == BackboneArea {
+			skip := r.summaries.Borders(area)
+			skip[r.address] = true
+			for _, chain := range r.summaries.Chains(other, skip, r.summaryExpire()) {
+				set[chain] = true
+			}
+		}
+	}
+	chains := []string{}
+	for chain := range set {
+		chains = append(chains, chain)
+	}
+	sort.Strings(chains)
+	return chains
+}
+
+//broadcastSummaries floods summary of chains into each area of border router, unchanged ones are flooded only if forced
+func (r *Router) broadcastSummaries(force bool) {
+	if !r.isBorder() {
+		return
+	}
+	for _, area := range r.areas {
+		chains := []string{}
+		if !r.isDraining() {
+			chains = r.summarize(area)
+		}
+		r.rwSummary.Lock()
+		if !force && equalStrings(r.summarized[area], chains) {
+			r.rwSummary.Unlock()
+			continue
+		}
+		r.summarized[area] = chains
+		r.summaryVersion++
+		summary := &pb.AreaSummary{Id: r.address, Area: area, Epoch: r.peerEpoch, Version: r.summaryVersion, Chains: chains}
+		r.rwSummary.Unlock()
+
+		bytes, _ := summary.Serialize()
+		msg := &pb.Message{Type: pb.Message_ROUTER_SUMMARY, Payload: bytes}
+		msg.Metadata = append(msg.Metadata, []byte(time.Now().String()+":"+r.address)...)
+		r.msgUniqueAdd(msg)
+		r.broadcastArea(msg, area)
+	}
+}
+
+//applySummary applies summary of border router and floods it on within its area
+func (r *Router) applySummary(summary *pb.AreaSummary, msg *pb.Message) {
+	if !r.inArea(summary.Area) || summary.Id == r.address {
+		return
+	}
+	if r.summaries.Update(summary) {
+		logger.Debugf("router %s summary of %s in area %q changed %v", r.address, summary.Id, summary.Area, summary.Chains)
+		r.summarizeLater()
+	}
+	r.broadcastArea(msg, summary.Area)
+}
+
+//summarizeLater schedules summaries of border router
+func (r *Router) summarizeLater() {
+	if !r.isBorder() || !atomic.CompareAndSwapInt32(&r.summarizing, 0, 1) {
+		return
+	}
+	time.AfterFunc(summaryDelay, func() {
+		atomic.StoreInt32(&r.summarizing, 0)
+		if r.IsRunning() && r.ctx.Err() == nil {
+			r.broadcastSummaries(false)
+		}
+	})
+}
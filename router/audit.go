@@ -0,0 +1,66 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package router
+
+import (
+	"time"
+
+	"github.com/bocheninc/msg-net/config"
+	"github.com/bocheninc/msg-net/logger"
+	pb "github.com/bocheninc/msg-net/protos"
+	"github.com/bocheninc/msg-net/router/audit"
+)
+
+//loadAudit opens audit file, routing decisions are not recorded if router.audit.path is empty
+func (r *Router) loadAudit() {
+	r.audit = nil
+	path := config.GetString("router.audit.path")
+	if path == "" {
+		return
+	}
+	l, err := audit.Open(path, config.GetInt64("router.audit.maxSize"), []byte(config.GetString("router.audit.key")))
+	if err != nil {
+		logger.Errorf("router %s failed to open audit file %s --- %v", r.address, path, err)
+		return
+	}
+	seq, head := l.Head()
+	logger.Infof("router %s audit file %s, chain head %d %s", r.address, path, seq, head)
+	r.audit = l
+}
+
+//auditMsg records decision of chain message, nextHop is the next hop router or the local peer it is sent to
+func (r *Router) auditMsg(chainMsg *pb.ChainMessage, decision, reason, nextHop string) {
+	if r.audit == nil {
+		return
+	}
+	record := &audit.Record{Time: time.Now().UnixNano(), Router: r.address, ID: chainMsg.Id, Src: chainMsg.SrcId, Dst: chainMsg.DstId,
+		Payload: audit.PayloadHash(chainMsg.Payload), Size: len(chainMsg.Payload), Decision: decision, Reason: reason, NextHop: nextHop}
+	if chainMsg.Kind != pb.ChainMessage_DATA {
+		record.Kind = chainMsg.Kind.String()
+	}
+	if err := r.audit.Append(record); err != nil {
+		logger.Errorf("router %s failed to audit message %s --- %v", r.address, chainMsg.Id, err)
+	}
+}
+
+func (r *Router) closeAudit() {
+	if r.audit != nil {
+		r.audit.Close()
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//Package audit 提供跨链消息的审计日志，记录按哈希链接，篡改可被校验发现
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//decisions of router on a message
+const (
+	DecisionForward = "forward" //sent to next hop router
+	DecisionDeliver = "deliver" //sent to local peer
+	DecisionDrop    = "drop"    //dead letter, see reason
+)
+
+var errClosed = errors.New("audit log is closed")
+
+//Record routing decision of a message, Prev is the hash of the previous record and Hash covers all other fields
+type Record struct {
+	Seq      uint64 `json:"seq"`
+	Time     int64  `json:"time"` //unix nano
+	Router   string `json:"router"`
+	ID       string `json:"id"`
+	Src      string `json:"src"`
+	Dst      string `json:"dst"`
+	Kind     string `json:"kind,omitempty"` //empty for data messages
+	Payload  string `json:"payload"`        //sha256 of payload in hex
+	Size     int    `json:"size"`
+	Decision string `json:"decision"`
+	Reason   string `json:"reason,omitempty"`
+	NextHop  string `json:"nextHop,omitempty"` //next hop router or local peer
+	Prev     string `json:"prev"`
+	Hash     string `json:"hash"`
+}
+
+//PayloadHash digests payload for records
+func PayloadHash(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+//digest hash of record without its own hash, HMAC-SHA256 if key is set
+func digest(r *Record, key []byte) (string, error) {
+	c := *r
+	c.Hash = ""
+	bytes, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(bytes)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+//Log append-only audit file, it is rotated to path.1, path.2 ... when it exceeds max size and rotated files are kept.
+//The chain continues across rotated files and restarts
+type Log struct {
+	path    string
+	maxSize int64
+	key     []byte
+	file    *os.File
+	size    int64
+	index   int //index of the last rotated file
+	seq     uint64
+	last    string
+	sync.Mutex
+}
+
+//Open opens the audit file, creates it if not exist, and restores the head of the chain
+func Open(path string, maxSize int64, key []byte) (*Log, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	if maxSize <= 0 {
+		maxSize = 100 * 1024 * 1024
+	}
+	l := &Log{path: path, maxSize: maxSize, key: key}
+	files, err := Files(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := trimTail(path); err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		if last, err := lastRecord(files[i]); err != nil {
+			return nil, err
+		} else if last != nil {
+			l.seq, l.last = last.Seq, last.Hash
+			break
+		}
+	}
+	for _, file := range files {
+		if i := fileIndex(path, file); i > l.index {
+			l.index = i
+		}
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+//Append chains record after the last one and writes it, Seq, Prev and Hash are set
+func (l *Log) Append(r *Record) error {
+	l.Lock()
+	defer l.Unlock()
+	if l.file == nil {
+		return errClosed
+	}
+	r.Seq, r.Prev = l.seq+1, l.last
+	h, err := digest(r, l.key)
+	if err != nil {
+		return err
+	}
+	r.Hash = h
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	bytes = append(bytes, '\n')
+	if l.size > 0 && l.size+int64(len(bytes)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(bytes)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	l.seq, l.last = r.Seq, r.Hash
+	return nil
+}
+
+//Head returns sequence and hash of the last record
+func (l *Log) Head() (uint64, string) {
+	l.Lock()
+	defer l.Unlock()
+	return l.seq, l.last
+}
+
+//Close closes the audit file
+func (l *Log) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+func (l *Log) rotate() error {
+	l.file.Close()
+	l.file = nil
+	if err := os.Rename(l.path, fmt.Sprintf("%s.%d", l.path, l.index+1)); err != nil {
+		return err
+	}
+	l.index++
+	return l.open()
+}
+
+//Files lists audit files of path in chain order, the rotated ones by index and then the current one
+func Files(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, m := range matches {
+		if fileIndex(path, m) > 0 {
+			files = append(files, m)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return fileIndex(path, files[i]) < fileIndex(path, files[j]) })
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return files, nil
+}
+
+//fileIndex index of rotated file, 0 if it is not
+func fileIndex(path, file string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(file, path+"."))
+	if err != nil || n <= 0 || !strings.HasPrefix(file, path+".") {
+		return 0
+	}
+	return n
+}
+
+//trimTail drops the unterminated last line of the current file, it is a torn write of crash
+func trimTail(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return nil
+	}
+	return file.Truncate(int64(bytes.LastIndexByte(data, '\n') + 1))
+}
+
+func lastRecord(path string) (*Record, error) {
+	var last *Record
+	err := scan(path, func(line int, r *Record, err error) error {
+		if err == nil {
+			last = r
+		}
+		return nil
+	})
+	return last, err
+}
+
+func scan(path string, function func(line int, r *Record, err error) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		r := &Record{}
+		err := json.Unmarshal(scanner.Bytes(), r)
+		if err := function(line, r, err); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+//Result summary of verified audit files
+type Result struct {
+	Files   int    `json:"files"`
+	Records uint64 `json:"records"`
+	First   uint64 `json:"first"`  //sequence of the first record
+	Anchor  string `json:"anchor"` //prev of the first record, empty if the chain starts from the first record ever
+	Head    string `json:"head"`   //hash of the last record
+}
+
+//Expect values of the chain recorded outside the audit files, records removed before the first file
+//or from the end of the last file are not detected without them
+type Expect struct {
+	Anchor  string //prev of the first record, required if the chain does not start from the first record ever
+	HeadSeq uint64 //sequence of a recorded head, the chain must reach it
+	Head    string //hash of the recorded head, empty will not check the head
+}
+
+//VerifyError a record breaks the chain
+type VerifyError struct {
+	File   string
+	Line   int
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Reason)
+}
+
+//Verify checks the chain of audit files of path, records are verified by HMAC key if it was set when written.
+//Removed records, altered fields, reordering and broken links between files are reported as *VerifyError,
+//so are a chain starting after removed records unless it matches the expected anchor, and a chain not reaching the expected head
+func Verify(path string, key []byte, expect Expect) (*Result, error) {
+	files, err := Files(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no audit file at %s", path)
+	}
+	result := &Result{Files: len(files)}
+	var seq uint64
+	for _, file := range files {
+		err := scan(file, func(line int, r *Record, err error) error {
+			fail := func(reason string) error {
+				return &VerifyError{File: file, Line: line, Reason: reason}
+			}
+			if err != nil {
+				return fail("malformed record --- " + err.Error())
+			}
+			if result.Records == 0 {
+				result.First, result.Anchor = r.Seq, r.Prev
+				if r.Seq == 1 && r.Prev != "" {
+					return fail("first record links to a previous one")
+				}
+				if r.Seq > 1 && expect.Anchor == "" {
+					return fail(fmt.Sprintf("chain starts at record %d after removed records, anchor %s is not expected", r.Seq, r.Prev))
+				}
+				if r.Seq > 1 && r.Prev != expect.Anchor {
+					return fail(fmt.Sprintf("chain starts at record %d with anchor %s, expected %s", r.Seq, r.Prev, expect.Anchor))
+				}
+			} else {
+				if r.Seq != seq+1 {
+					return fail(fmt.Sprintf("sequence %d follows %d", r.Seq, seq))
+				}
+				if r.Prev != result.Head {
+					return fail(fmt.Sprintf("record %d does not link to record %d", r.Seq, seq))
+				}
+			}
+			h, err := digest(r, key)
+			if err != nil {
+				return fail(err.Error())
+			}
+			if !hmac.Equal([]byte(h), []byte(r.Hash)) {
+				return fail(fmt.Sprintf("hash of record %d mismatch", r.Seq))
+			}
+			if expect.Head != "" && r.Seq == expect.HeadSeq && r.Hash != expect.Head {
+				return fail(fmt.Sprintf("record %d is not the expected head %s", r.Seq, expect.Head))
+			}
+			seq, result.Head = r.Seq, r.Hash
+			result.Records++
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	if expect.Head != "" && (result.Records == 0 || expect.HeadSeq < result.First || expect.HeadSeq > seq) {
+		return result, fmt.Errorf("expected head %d is not in the chain of sequence %d to %d, records are removed", expect.HeadSeq, result.First, seq)
+	}
+	return result, nil
+}
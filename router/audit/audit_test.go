@@ -0,0 +1,131 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func appendRecords(t *testing.T, l *Log, from, n int) {
+	for i := from; i < from+n; i++ {
+		payload := []byte(fmt.Sprintf("payload-%d", i))
+		r := &Record{Time: time.Now().UnixNano(), Router: "0.0.0.0:8000", ID: fmt.Sprintf("%032x", i), Src: "00:chain", Dst: "01:chain",
+			Payload: PayloadHash(payload), Size: len(payload), Decision: DecisionForward, NextHop: "0.0.0.0:8001"}
+		if err := l.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	key := []byte("consortium")
+
+	l, err := Open(path, 1024, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, l, 1, 10)
+	l.Close()
+	//torn write of crash is dropped, the chain resumes after restart
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(`{"seq":11,"time":`)
+	file.Close()
+	if l, err = Open(path, 1024, key); err != nil {
+		t.Fatal(err)
+	}
+	if seq, _ := l.Head(); seq != 10 {
+		t.Fatalf("expect head 10 after reopen, got %d", seq)
+	}
+	appendRecords(t, l, 11, 10)
+	seq, head := l.Head()
+	l.Close()
+
+	files, err := Files(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 3 || files[len(files)-1] != path || files[0] != path+".1" {
+		t.Fatalf("unexpected files %v", files)
+	}
+	result, err := Verify(path, key, Expect{HeadSeq: seq, Head: head})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Records != 20 || result.First != 1 || result.Head != head || seq != 20 || result.Files != len(files) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if _, err := Verify(path, []byte("forged"), Expect{}); err == nil {
+		t.Fatal("records verified with wrong key")
+	}
+
+	//altered field
+	data, _ := ioutil.ReadFile(files[1])
+	altered := strings.Replace(string(data), `"nextHop":"0.0.0.0:8001"`, `"nextHop":"0.0.0.0:8002"`, 1)
+	ioutil.WriteFile(files[1], []byte(altered), 0644)
+	if _, err := Verify(path, key, Expect{}); err == nil || !strings.Contains(err.Error(), "mismatch") {
+		t.Fatalf("altered record is not detected --- %v", err)
+	}
+	//removed record
+	lines := strings.SplitAfter(string(data), "\n")
+	ioutil.WriteFile(files[1], []byte(strings.Join(lines[1:], "")), 0644)
+	if _, err := Verify(path, key, Expect{}); err == nil {
+		t.Fatal("removed record is not detected")
+	} else if e, ok := err.(*VerifyError); !ok || e.File != files[1] || e.Line != 1 {
+		t.Fatalf("unexpected error --- %v", err)
+	}
+	ioutil.WriteFile(files[1], data, 0644)
+	//records cut from the end are detected against the recorded head
+	data, _ = ioutil.ReadFile(path)
+	lines = strings.SplitAfter(string(data), "\n")
+	ioutil.WriteFile(path, []byte(strings.Join(lines[:len(lines)-2], "")), 0644)
+	if _, err := Verify(path, key, Expect{}); err != nil {
+		t.Fatalf("truncated chain fails without head --- %v", err)
+	}
+	if _, err := Verify(path, key, Expect{HeadSeq: seq, Head: head}); err == nil {
+		t.Fatal("truncated chain is not detected against the head")
+	}
+	if _, err := Verify(path, key, Expect{HeadSeq: seq - 1, Head: head}); err == nil {
+		t.Fatal("wrong head is not detected")
+	}
+	ioutil.WriteFile(path, data, 0644)
+	//the oldest file removed by retention, the rest verifies from the expected anchor only
+	first, _ := lastRecord(files[0])
+	os.Remove(files[0])
+	if _, err := Verify(path, key, Expect{}); err == nil {
+		t.Fatal("chain after removed records verifies without anchor")
+	}
+	if _, err := Verify(path, key, Expect{Anchor: head}); err == nil {
+		t.Fatal("chain verifies with wrong anchor")
+	}
+	if result, err := Verify(path, key, Expect{Anchor: first.Hash, HeadSeq: seq, Head: head}); err != nil || result.First == 1 || result.Anchor != first.Hash {
+		t.Fatalf("unexpected result %+v --- %v", result, err)
+	}
+}
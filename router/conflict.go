@@ -0,0 +1,144 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package router
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/bocheninc/msg-net/config"
+	"github.com/bocheninc/msg-net/logger"
+	"github.com/bocheninc/msg-net/net/common"
+	pb "github.com/bocheninc/msg-net/protos"
+)
+
+//duplicate peer id policies, all routers of the mesh should use the same one
+const (
+	PolicyReject = "reject" //the newcomer is rejected
+	PolicyEvict  = "evict"  //the old session is evicted
+)
+
+//localPeer peer attached to local router
+type localPeer struct {
+	peer *pb.Peer
+	conn net.Conn
+}
+
+//Conflict duplicate peer id detected, two peer processes announced the same id
+type Conflict struct {
+	ID      string
+	Policy  string
+	Kept    *pb.Peer //peer instance kept
+	Dropped *pb.Peer //peer instance dropped by local router
+	Router  string   //router the kept instance is attached to
+	Time    time.Time
+}
+
+//OnConflict registers function called when local router drops a peer of duplicate id
+func (r *Router) OnConflict(function func(*Conflict)) {
+	r.onConflict = function
+}
+
+//Conflicts number of peers dropped for duplicate id
+func (r *Router) Conflicts() int64 {
+	return atomic.LoadInt64(&r.conflicts)
+}
+
+func duplicatePolicy() string {
+	if policy := config.GetString("router.duplicate"); policy == PolicyEvict {
+		return policy
+	}
+	return PolicyReject
+}
+
+//isDuplicate peers of the same id from different processes, sessions of a multi-homed peer share the instance
+func isDuplicate(a, b *pb.Peer) bool {
+	return a.Id == b.Id && a.Instance != "" && b.Instance != "" && a.Instance != b.Instance
+}
+
+//loses peer a loses to peer b of the same id, every router makes the same decision on the same pair
+func loses(policy string, a, b *pb.Peer) bool {
+	older := a.Started < b.Started || (a.Started == b.Started && a.Instance < b.Instance)
+	if policy == PolicyEvict {
+		return older
+	}
+	return !older
+}
+
+//admitPeer resolves duplicate id of peer saying hello, it returns the winner if the peer is rejected
+func (r *Router) admitPeer(peer *pb.Peer) (winner *pb.Peer, router string) {
+	policy := duplicatePolicy()
+	if lp := r.peerGet(peer.Id); lp != nil && isDuplicate(peer, lp.peer) {
+		if loses(policy, peer, lp.peer) {
+			return lp.peer, r.address
+		}
+		r.dropPeer(lp, peer, r.address)
+	}
+	for key, other := range r.allPeers.Find(peer.Id) {
+		if key != r.address && isDuplicate(peer, other) && loses(policy, peer, other) {
+			return other, key
+		}
+	}
+	return nil, ""
+}
+
+//resolvePeers drops local peers losing to duplicates attached to router key
+func (r *Router) resolvePeers(key string, peers []*pb.Peer) {
+	if key == r.address {
+		return
+	}
+	policy := duplicatePolicy()
+	for _, peer := range peers {
+		if lp := r.peerGet(peer.Id); lp != nil && isDuplicate(lp.peer, peer) && loses(policy, lp.peer, peer) {
+			r.dropPeer(lp, peer, key)
+		}
+	}
+}
+
+//dropPeer notifies local peer of the conflict and disconnects it
+func (r *Router) dropPeer(lp *localPeer, winner *pb.Peer, router string) {
+	r.peerUpdate(func(peers map[string]*localPeer) ([]*pb.Peer, []string) {
+		if peers[lp.peer.Id] != lp {
+			return nil, nil
+		}
+		delete(peers, lp.peer.Id)
+		return nil, []string{lp.peer.Id}
+	})
+
+	(&common.Handler{}).Send(lp.conn, conflictMsg(winner))
+	r.connKeepAliveRemove(lp.conn)
+	r.server.Disconnect(lp.conn)
+	r.conflict(winner, lp.peer, router)
+}
+
+//conflict raises alert of duplicate peer id
+func (r *Router) conflict(kept, dropped *pb.Peer, router string) {
+	atomic.AddInt64(&r.conflicts, 1)
+	c := &Conflict{ID: kept.Id, Policy: duplicatePolicy(), Kept: kept, Dropped: dropped, Router: router, Time: time.Now()}
+	logger.Errorf("router %s duplicate peer id %s, instance %s dropped, instance %s kept at router %s (policy %s)", r.address, c.ID, dropped.Instance, kept.Instance, router, c.Policy)
+	if r.onConflict != nil {
+		r.onConflict(c)
+	}
+}
+
+func conflictMsg(winner *pb.Peer) *pb.Message {
+	bytes, _ := winner.Serialize()
+	return &pb.Message{Type: pb.Message_PEER_CONFLICT, Payload: bytes}
+}
@@ -0,0 +1,165 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package router
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bocheninc/msg-net/config"
+	"github.com/bocheninc/msg-net/logger"
+	"github.com/bocheninc/msg-net/net/common"
+	pb "github.com/bocheninc/msg-net/protos"
+	"github.com/bocheninc/msg-net/router/deadletter"
+)
+
+//deadLetters counters of undeliverable messages by reason and the optional dead letter file
+type deadLetters struct {
+	log    *deadletter.Log
+	counts map[string]uint64
+	sync.Mutex
+}
+
+//loadDeadLetters opens dead letter file, recording is disabled if router.deadletter.path is empty
+func (r *Router) loadDeadLetters() {
+	r.deadLetters = &deadLetters{counts: make(map[string]uint64)}
+	path := config.GetString("router.deadletter.path")
+	if path == "" {
+		return
+	}
+	l, err := deadletter.Open(path, config.GetInt64("router.deadletter.maxSize"), config.GetInt("router.deadletter.maxFiles"))
+	if err != nil {
+		logger.Errorf("router %s failed to open dead letter file %s --- %v", r.address, path, err)
+		return
+	}
+	r.deadLetters.log = l
+}
+
+//deadLetter records undeliverable chain message and notifies its source peer if notify, payload is the serialized chain message.
+//Acks and redelivery requests are only recorded
+func (r *Router) deadLetter(payload []byte, chainMsg *pb.ChainMessage, reason pb.DeadLetter_Reason, detail string, notify bool) {
+	logger.Warnf("router %s dead letter %s from %s to %s, %s --- %s", r.address, chainMsg.Id, chainMsg.SrcId, chainMsg.DstId, reason, detail)
+	now := time.Now()
+	r.deadLetters.Lock()
+	r.deadLetters.counts[reason.String()]++
+	l := r.deadLetters.log
+	r.deadLetters.Unlock()
+	if l != nil {
+		letter := &deadletter.Letter{ID: chainMsg.Id, Src: chainMsg.SrcId, Dst: chainMsg.DstId, Reason: reason.String(), Detail: detail, Time: now, Msg: payload}
+		if err := l.Append(letter); err != nil {
+			logger.Errorf("router %s failed to record dead letter %s --- %v", r.address, chainMsg.Id, err)
+		}
+	}
+	if !notify || chainMsg.Kind != pb.ChainMessage_DATA || chainMsg.Id == "" {
+		return
+	}
+	notice := &pb.DeadLetter{Id: chainMsg.Id, SrcId: chainMsg.SrcId, DstId: chainMsg.DstId, Reason: reason, Router: r.address, Detail: detail, Timestamp: now.UnixNano()}
+	bytes, err := notice.Serialize()
+	if err != nil {
+		logger.Errorf("router %s failed to serialize dead letter %s --- %v", r.address, chainMsg.Id, err)
+		return
+	}
+	r.routeDeadLetter(&pb.Message{Type: pb.Message_DEAD_LETTER, Payload: bytes})
+}
+
+//routeDeadLetter routes dead letter notice to the source peer of the undeliverable message, notices are not reported again
+func (r *Router) routeDeadLetter(msg *pb.Message) error {
+	if bytes.Contains(msg.Metadata, []byte(r.address)) {
+		return nil
+	}
+	msg.Metadata = append(msg.Metadata, []byte(r.address)...)
+
+	notice := &pb.DeadLetter{}
+	if err := notice.Deserialize(msg.Payload); err != nil {
+		return err
+	}
+	keys := r.routeKeys(notice.SrcId, nil)
+	if len(keys) == 0 {
+		logger.Warnf("router %s drop dead letter %s, source %s is unreachable", r.address, notice.Id, notice.SrcId)
+	}
+	for _, key := range keys {
+		if key == r.address {
+			r.peerIterFunc(func(peer *pb.Peer, conn net.Conn) {
+				if peer.Id == notice.SrcId {
+					(&common.Handler{}).Send(conn, msg)
+				}
+			})
+		} else if nextKeys, err := r.allRouters.GetFlowNextHops(key, notice.DstId, notice.SrcId); err != nil || r.sendToNextHops(nextKeys, msg) == "" {
+			logger.Warnf("router %s drop dead letter %s, no route to router %s of source %s", r.address, notice.Id, key, notice.SrcId)
+		}
+	}
+	return nil
+}
+
+//DeadLetters returns the latest recorded dead letters up to limit, all if limit is not positive
+func (r *Router) DeadLetters(limit int) ([]*deadletter.Letter, error) {
+	l := r.deadLetterLog()
+	if l == nil {
+		return nil, errNoDeadLetterLog
+	}
+	return l.List(limit)
+}
+
+//ReplayDeadLetter routes the recorded message of id again as if its source peer sent it to this router,
+//the source must be attached to this router. Receivers with replay protection reject it if it is older
+//than their clock skew tolerance
+func (r *Router) ReplayDeadLetter(id string) error {
+	l := r.deadLetterLog()
+	if l == nil {
+		return errNoDeadLetterLog
+	}
+	letter, err := l.Get(id)
+	if err != nil {
+		return err
+	}
+	lp := r.peerGet(letter.Src)
+	if lp == nil {
+		return errReplaySource
+	}
+	logger.Infof("router %s replay dead letter %s from %s to %s", r.address, letter.ID, letter.Src, letter.Dst)
+	return r.RouteMessage(&pb.Message{Type: pb.Message_CHAIN_MESSAGE, Payload: letter.Msg}, lp.conn)
+}
+
+func (r *Router) deadLetterLog() *deadletter.Log {
+	if r.deadLetters == nil {
+		return nil
+	}
+	r.deadLetters.Lock()
+	defer r.deadLetters.Unlock()
+	return r.deadLetters.log
+}
+
+//deadLetterStats counts of dead letters by reason
+func (r *Router) deadLetterStats() map[string]uint64 {
+	r.deadLetters.Lock()
+	defer r.deadLetters.Unlock()
+	counts := make(map[string]uint64)
+	for reason, n := range r.deadLetters.counts {
+		counts[reason] = n
+	}
+	return counts
+}
+
+func (r *Router) closeDeadLetters() {
+	if l := r.deadLetterLog(); l != nil {
+		l.Close()
+	}
+}
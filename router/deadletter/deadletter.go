@@ -0,0 +1,203 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//Package deadletter 提供无法投递消息的本地记录，文件按大小轮转
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//ErrNotFound dead letter of id is not recorded
+var ErrNotFound = errors.New("dead letter not found")
+
+var errClosed = errors.New("dead letter log is closed")
+
+//Letter undeliverable message recorded by router
+type Letter struct {
+	ID     string    `json:"id"`
+	Src    string    `json:"src"`
+	Dst    string    `json:"dst"`
+	Reason string    `json:"reason"`
+	Detail string    `json:"detail,omitempty"`
+	Time   time.Time `json:"time"`
+	Msg    []byte    `json:"msg,omitempty"` //serialized chain message
+}
+
+//Log append-only dead letter file, it is rotated to path.1 ... path.N when it exceeds max size
+type Log struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	sync.Mutex
+}
+
+//Open opens the dead letter file, creates it if not exist. maxFiles counts the current file and the rotated ones
+func Open(path string, maxSize int64, maxFiles int) (*Log, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	if maxSize <= 0 {
+		maxSize = 10 * 1024 * 1024
+	}
+	if maxFiles <= 0 {
+		maxFiles = 1
+	}
+	l := &Log{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+//Append records letter, the file is rotated first if it is full
+func (l *Log) Append(letter *Letter) error {
+	l.Lock()
+	defer l.Unlock()
+	if l.file == nil {
+		return errClosed
+	}
+	bytes, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	bytes = append(bytes, '\n')
+	if l.size > 0 && l.size+int64(len(bytes)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(bytes)
+	l.size += int64(n)
+	return err
+}
+
+//List returns the latest letters up to limit in time order, all letters if limit is not positive
+func (l *Log) List(limit int) ([]*Letter, error) {
+	l.Lock()
+	defer l.Unlock()
+	letters := []*Letter{}
+	for i := l.maxFiles - 1; i >= 0; i-- {
+		ls, err := read(l.name(i))
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, ls...)
+	}
+	if limit > 0 && len(letters) > limit {
+		letters = letters[len(letters)-limit:]
+	}
+	return letters, nil
+}
+
+//Get returns the latest letter of message id
+func (l *Log) Get(id string) (*Letter, error) {
+	letters, err := l.List(0)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(letters) - 1; i >= 0; i-- {
+		if letters[i].ID == id {
+			return letters[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+//Close closes the dead letter file
+func (l *Log) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+//name of the i-th file, 0 is the current one
+func (l *Log) name(i int) string {
+	if i == 0 {
+		return l.path
+	}
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
+
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+//rotate shifts path.i to path.i+1, the oldest file is dropped
+func (l *Log) rotate() error {
+	l.file.Close()
+	l.file = nil
+	if err := os.Remove(l.name(l.maxFiles - 1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := l.maxFiles - 2; i >= 0; i-- {
+		if err := os.Rename(l.name(i), l.name(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return l.open()
+}
+
+func read(path string) ([]*Letter, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	letters := []*Letter{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		letter := &Letter{}
+		if err := json.Unmarshal(scanner.Bytes(), letter); err != nil {
+			//torn write at the tail, the rest is discarded
+			break
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package deadletter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "deadletter.log")
+
+	l, err := Open(path, 300, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := l.Append(&Letter{ID: fmt.Sprint(i), Src: "A:p0", Dst: "B:p0", Reason: "NO_ROUTE", Time: time.Now(), Msg: []byte("payload")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatal("rotated files are not limited")
+	}
+	letters, err := l.List(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) == 0 || len(letters) >= 20 || letters[len(letters)-1].ID != "19" {
+		t.Fatalf("unexpected letters after rotation, %d letters", len(letters))
+	}
+	for i := 1; i < len(letters); i++ {
+		if letters[i].Time.Before(letters[i-1].Time) {
+			t.Fatalf("letters are not in time order, %s before %s", letters[i-1].ID, letters[i].ID)
+		}
+	}
+	if letters, _ := l.List(2); len(letters) != 2 || letters[1].ID != "19" {
+		t.Fatalf("unexpected latest letters %v", letters)
+	}
+	l.Close()
+
+	//letters are kept across reopen
+	l, err = Open(path, 300, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	letter, err := l.Get("18")
+	if err != nil || string(letter.Msg) != "payload" {
+		t.Fatalf("unexpected letter %v --- %v", letter, err)
+	}
+	if _, err := l.Get("0"); err != ErrNotFound {
+		t.Fatalf("expect %v, got %v", ErrNotFound, err)
+	}
+}
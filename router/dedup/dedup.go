@@ -0,0 +1,140 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//Package dedup 提供消息去重，按消息摘要记录，内存有界
+package dedup
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+//Key compact digest of message
+type Key [16]byte
+
+//Sum digests parts of message, each part is prefixed by its length
+func Sum(parts ...[]byte) Key {
+	h := sha256.New()
+	var n [8]byte
+	for _, part := range parts {
+		binary.BigEndian.PutUint64(n[:], uint64(len(part)))
+		h.Write(n[:])
+		h.Write(part)
+	}
+	var key Key
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+//Stats counters of filter
+type Stats struct {
+	Hits      uint64  `json:"hits"`      //duplicates dropped
+	Misses    uint64  `json:"misses"`    //new messages
+	Rotations uint64  `json:"rotations"` //generations dropped
+	Early     uint64  `json:"early"`     //generations dropped before the window because size is reached
+	Size      int     `json:"size"`      //digests kept
+	HitRate   float64 `json:"hitRate"`
+}
+
+//Filter time-windowed set of message digests with bounded size.
+//Digests are kept in two generations, the older one is dropped every half window,
+//or earlier when the current one reaches half size, so a digest is remembered for
+//half to one window and at most size digests are kept.
+type Filter struct {
+	size     int
+	window   time.Duration
+	current  map[Key]struct{}
+	previous map[Key]struct{}
+	rotated  time.Time
+	stats    Stats
+	sync.Mutex
+}
+
+//NewFilter make new filter keeping at most size digests within window
+func NewFilter(size int, window time.Duration) *Filter {
+	if size < 2 {
+		size = 2
+	}
+	return &Filter{size: size, window: window, current: make(map[Key]struct{}), previous: make(map[Key]struct{}), rotated: time.Now()}
+}
+
+//Add records key, returns false if it is seen within window
+func (f *Filter) Add(key Key) bool {
+	f.Lock()
+	defer f.Unlock()
+	f.rotate()
+	_, ok := f.current[key]
+	if !ok {
+		_, ok = f.previous[key]
+	}
+	if ok {
+		f.stats.Hits++
+		return false
+	}
+	f.stats.Misses++
+	if len(f.current) >= f.size/2 {
+		f.stats.Early++
+		f.drop()
+	}
+	f.current[key] = struct{}{}
+	return true
+}
+
+//Resize changes size and window, digests kept are not affected until rotated
+func (f *Filter) Resize(size int, window time.Duration) {
+	f.Lock()
+	defer f.Unlock()
+	if size < 2 {
+		size = 2
+	}
+	f.size = size
+	f.window = window
+}
+
+//Stats returns counters
+func (f *Filter) Stats() Stats {
+	f.Lock()
+	defer f.Unlock()
+	stats := f.stats
+	stats.Size = len(f.current) + len(f.previous)
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+func (f *Filter) rotate() {
+	elapsed := time.Since(f.rotated)
+	if elapsed < f.window/2 {
+		return
+	}
+	f.drop()
+	if elapsed >= f.window {
+		//nothing received for a whole window
+		f.drop()
+	}
+}
+
+func (f *Filter) drop() {
+	f.previous = f.current
+	f.current = make(map[Key]struct{})
+	f.rotated = time.Now()
+	f.stats.Rotations++
+}
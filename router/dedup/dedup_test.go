@@ -0,0 +1,70 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package dedup
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFilterWindow(t *testing.T) {
+	f := NewFilter(100, 200*time.Millisecond)
+	key := Sum([]byte("msg"), []byte("0"))
+	if !f.Add(key) {
+		t.Fatal("new key is duplicate")
+	}
+	if f.Add(key) {
+		t.Fatal("duplicate key is not detected")
+	}
+	if Sum([]byte("msg"), []byte("1")) == key {
+		t.Fatal("different messages have the same key")
+	}
+	time.Sleep(120 * time.Millisecond)
+	if f.Add(key) {
+		t.Fatal("key is forgotten within window")
+	}
+	time.Sleep(220 * time.Millisecond)
+	if !f.Add(key) {
+		t.Fatal("key is remembered after window")
+	}
+	stats := f.Stats()
+	if stats.Hits != 2 || stats.Misses != 2 || stats.HitRate != 0.5 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestFilterSize(t *testing.T) {
+	f := NewFilter(10, time.Hour)
+	for i := 0; i < 100; i++ {
+		f.Add(Sum([]byte(strconv.Itoa(i))))
+		if size := f.Stats().Size; size > 10 {
+			t.Fatalf("filter exceeds size, %d digests", size)
+		}
+	}
+	if f.Add(Sum([]byte("99"))) {
+		t.Fatal("recent key is forgotten")
+	}
+	if !f.Add(Sum([]byte("0"))) {
+		t.Fatal("old key is remembered beyond size")
+	}
+	if f.Stats().Early == 0 {
+		t.Fatal("early rotation is not counted")
+	}
+}
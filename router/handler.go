@@ -55,13 +55,21 @@ func (h *Handler) Init() {
 			{Name: pb.Message_ROUTER_GET.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.Message_ROUTER_GET_ACK.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.Message_ROUTER_SYNC.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.Message_ROUTER_SUMMARY.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.Message_ROUTER_CLOSE.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.Message_MEMBER_PING.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.Message_MEMBER_PING_REQ.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.Message_MEMBER_ACK.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.Message_PEER_HELLO.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.Message_PEER_SYNC.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.Message_PEER_CLOSE.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.Message_PEER_LOOKUP.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.Message_PEER_DIGEST.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.Message_PEER_RESYNC.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.Message_KEEPALIVE.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.Message_KEEPALIVE_ACK.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.Message_CHAIN_MESSAGE.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.Message_DEAD_LETTER.String(), Src: []string{"established"}, Dst: "established"},
 		},
 		fsm.Callbacks{
 			// "enter_state":                                     func(e *fsm.Event) { h.enterState(e) },
@@ -73,13 +81,21 @@ func (h *Handler) Init() {
 			"after_" + pb.Message_ROUTER_GET.String():       func(e *fsm.Event) { h.afterRouterGet(e) },
 			"after_" + pb.Message_ROUTER_GET_ACK.String():   func(e *fsm.Event) { h.afterRouterGetAck(e) },
 			"after_" + pb.Message_ROUTER_SYNC.String():      func(e *fsm.Event) { h.afterRouterSync(e) },
+			"after_" + pb.Message_ROUTER_SUMMARY.String():   func(e *fsm.Event) { h.afterRouterSummary(e) },
 			"after_" + pb.Message_ROUTER_CLOSE.String():     func(e *fsm.Event) { h.afterRouterClose(e) },
+			"after_" + pb.Message_MEMBER_PING.String():      func(e *fsm.Event) { h.afterMember(e) },
+			"after_" + pb.Message_MEMBER_PING_REQ.String():  func(e *fsm.Event) { h.afterMember(e) },
+			"after_" + pb.Message_MEMBER_ACK.String():       func(e *fsm.Event) { h.afterMember(e) },
 			"after_" + pb.Message_PEER_HELLO.String():       func(e *fsm.Event) { h.afterPeerHello(e) },
 			"after_" + pb.Message_PEER_SYNC.String():        func(e *fsm.Event) { h.afterPeerSync(e) },
 			"after_" + pb.Message_PEER_CLOSE.String():       func(e *fsm.Event) { h.afterPeerClose(e) },
+			"after_" + pb.Message_PEER_LOOKUP.String():      func(e *fsm.Event) { h.afterPeerLookup(e) },
+			"after_" + pb.Message_PEER_DIGEST.String():      func(e *fsm.Event) { h.afterPeerDigest(e) },
+			"after_" + pb.Message_PEER_RESYNC.String():      func(e *fsm.Event) { h.afterPeerResync(e) },
 			"after_" + pb.Message_KEEPALIVE.String():        func(e *fsm.Event) { h.afterKeepAlive(e) },
 			"after_" + pb.Message_KEEPALIVE_ACK.String():    func(e *fsm.Event) { h.afterKeepAliveAck(e) },
 			"after_" + pb.Message_CHAIN_MESSAGE.String():    func(e *fsm.Event) { h.afterChainMessage(e) },
+			"after_" + pb.Message_DEAD_LETTER.String():      func(e *fsm.Event) { h.afterDeadLetter(e) },
 		},
 	)
 }
@@ -138,9 +154,12 @@ func (h *Handler) afterRouterHello(e *fsm.Event) {
 	}
 
 	//Send
-	router0 := &pb.Router{Id: h.router.id, Address: h.router.address}
+	router0 := h.router.routerSelf()
 	if h.router.routerExist(router.Address) {
 		router0.Id = "unkown"
+	} else if len(h.router.sharedAreas(router)) == 0 {
+		logger.Warnf("router %s reject router %s, no shared area in %q", h.router.address, router.Address, router.Areas)
+		router0.Id = "unkown"
 	} else {
 		h.router.routerAdd(router.Address, router, conn)
 		h.router.connKeepAliveAdd(conn, true)
@@ -169,7 +188,7 @@ func (h *Handler) afterRouterHelloAck(e *fsm.Event) {
 		e.Cancel(fmt.Errorf("failed to handle message (%s) --- %s", msg.Type.String(), err))
 		return
 	}
-	if router.Id == "unkown" {
+	if router.Id == "unkown" || len(h.router.sharedAreas(router)) == 0 {
 		go h.router.server.Disconnect(conn)
 	} else {
 		h.router.routerAdd(router.Address, router, conn)
@@ -190,7 +209,7 @@ func (h *Handler) afterRouterGet(e *fsm.Event) {
 	routers := &pb.Routers{}
 	routers.Id = h.router.address
 	h.router.routerIterFunc(func(key string, router *pb.Router) {
-		routers.Routers = append(routers.Routers, &pb.Router{Id: router.Id, Address: router.Address})
+		routers.Routers = append(routers.Routers, &pb.Router{Id: router.Id, Address: router.Address, Areas: router.Areas})
 	})
 	bytes, err := routers.Serialize()
 	if err != nil {
@@ -216,7 +235,9 @@ func (h *Handler) afterRouterGetAck(e *fsm.Event) {
 	}
 	addresses := []string{}
 	for _, router := range routers.Routers {
-		addresses = append(addresses, router.Address)
+		if len(h.router.sharedAreas(router)) > 0 {
+			addresses = append(addresses, router.Address)
+		}
 	}
 	h.router.Discovery(addresses)
 }
@@ -235,8 +256,27 @@ func (h *Handler) afterRouterSync(e *fsm.Event) {
 			e.Cancel(fmt.Errorf("failed to handle message (%s) --- %s", msg.Type.String(), err))
 			return
 		}
-		h.router.updateRouters(routers.Id, routers.Routers)
-		h.router.broadcastMsg(msg)
+		if !h.router.inArea(routers.Area) {
+			return
+		}
+		h.router.updateRouters(routers.Id, routers.Area, routers.Routers)
+		h.router.broadcastArea(msg, routers.Area)
+	}
+}
+
+func (h *Handler) afterRouterSummary(e *fsm.Event) {
+	if _, ok := e.Args[0].(*pb.Message); !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	msg := e.Args[0].(*pb.Message)
+	if h.router.msgUniqueAdd(msg) {
+		summary := &pb.AreaSummary{}
+		if err := summary.Deserialize(msg.Payload); err != nil {
+			e.Cancel(fmt.Errorf("failed to handle message (%s) --- %s", msg.Type.String(), err))
+			return
+		}
+		h.router.applySummary(summary, msg)
 	}
 }
 
@@ -255,10 +295,23 @@ func (h *Handler) afterRouterClose(e *fsm.Event) {
 		e.Cancel(fmt.Errorf("failed to handle message (%s) --- %s", msg.Type.String(), err))
 		return
 	}
+	h.router.routerLeft(router.Address)
 	h.router.routerRemove(router.Address)
 	h.router.connKeepAliveRemove(conn)
 }
 
+func (h *Handler) afterMember(e *fsm.Event) {
+	if _, ok := e.Args[0].(*pb.Message); !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	msg := e.Args[0].(*pb.Message)
+
+	if err := h.router.handleMember(msg); err != nil {
+		e.Cancel(err)
+	}
+}
+
 func (h *Handler) afterPeerHello(e *fsm.Event) {
 	if _, ok := e.Args[0].(*pb.Message); !ok {
 		e.Cancel(fmt.Errorf("Received unexpected message type"))
@@ -273,6 +326,15 @@ func (h *Handler) afterPeerHello(e *fsm.Event) {
 		e.Cancel(fmt.Errorf("failed to handle message (%s) --- %s", msg.Type.String(), err))
 		return
 	}
+	if h.router.isDraining() {
+		sendChannel <- h.router.migrateMsg()
+		return
+	}
+	if winner, router := h.router.admitPeer(peer); winner != nil {
+		h.router.conflict(winner, peer, router)
+		sendChannel <- conflictMsg(winner)
+		return
+	}
 	h.router.peerAdd(peer, conn)
 	h.router.connKeepAliveAdd(conn, true)
 
@@ -299,8 +361,61 @@ func (h *Handler) afterPeerSync(e *fsm.Event) {
 			e.Cancel(fmt.Errorf("failed to handle message (%s) --- %s", msg.Type.String(), err))
 			return
 		}
-		h.router.updatePeers(peers.Id, peers.Peers)
-		h.router.broadcastMsg(msg)
+		if !h.router.inArea(peers.Area) {
+			return
+		}
+		h.router.applyPeers(peers)
+		h.router.resolvePeers(peers.Id, peers.Peers)
+		h.router.broadcastArea(msg, peers.Area)
+	}
+}
+
+func (h *Handler) afterPeerDigest(e *fsm.Event) {
+	if _, ok := e.Args[0].(*pb.Message); !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	msg := e.Args[0].(*pb.Message)
+	if h.router.msgUniqueAdd(msg) {
+		digest := &pb.PeerDigest{}
+		if err := digest.Deserialize(msg.Payload); err != nil {
+			e.Cancel(fmt.Errorf("failed to handle message (%s) --- %s", msg.Type.String(), err))
+			return
+		}
+		if !h.router.inArea(digest.Area) {
+			return
+		}
+		h.router.checkPeers(digest)
+		h.router.broadcastArea(msg, digest.Area)
+	}
+}
+
+func (h *Handler) afterPeerResync(e *fsm.Event) {
+	if _, ok := e.Args[0].(*pb.Message); !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	msg := e.Args[0].(*pb.Message)
+	conn := e.Args[2].(net.Conn)
+	if h.router.msgUniqueAdd(msg) {
+		digest := &pb.PeerDigest{}
+		if err := digest.Deserialize(msg.Payload); err != nil {
+			e.Cancel(fmt.Errorf("failed to handle message (%s) --- %s", msg.Type.String(), err))
+			return
+		}
+		if digest.Id == h.router.address {
+			h.router.resync()
+			return
+		}
+		if h.router.routerKey(conn) == "" {
+			//peers only learn peer tables of the area of their router
+			digest.Area = h.router.area
+			msg.Payload, _ = digest.Serialize()
+		}
+		if !h.router.inArea(digest.Area) {
+			return
+		}
+		h.router.broadcastArea(msg, digest.Area)
 	}
 }
 
@@ -310,7 +425,7 @@ func (h *Handler) afterPeerClose(e *fsm.Event) {
 		return
 	}
 	msg := e.Args[0].(*pb.Message)
-	//sendChannel := e.Args[1].(chan<- common.IMsg)
+	sendChannel := e.Args[1].(chan<- common.IMsg)
 	conn := e.Args[2].(net.Conn)
 
 	//Recv
@@ -319,8 +434,38 @@ func (h *Handler) afterPeerClose(e *fsm.Event) {
 		e.Cancel(fmt.Errorf("failed to handle message (%s) --- %s", msg.Type.String(), err))
 		return
 	}
-	h.router.peerRemove(peer)
+	h.router.peerRemove(conn)
 	h.router.connKeepAliveRemove(conn)
+	//the peer disconnects once the close is handled
+	sendChannel <- &pb.Message{Type: pb.Message_PEER_CLOSE_ACK}
+}
+
+func (h *Handler) afterPeerLookup(e *fsm.Event) {
+	if _, ok := e.Args[0].(*pb.Message); !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	msg := e.Args[0].(*pb.Message)
+	sendChannel := e.Args[1].(chan<- common.IMsg)
+
+	//Recv
+	lookup := &pb.PeerLookup{}
+	if err := lookup.Deserialize(msg.Payload); err != nil {
+		e.Cancel(fmt.Errorf("failed to handle message (%s) --- %s", msg.Type.String(), err))
+		return
+	}
+
+	//Send
+	lookup.Peers = nil
+	for id, routers := range h.router.allPeers.Lookup(lookup.Pattern) {
+		lookup.Peers = append(lookup.Peers, &pb.PeerLocation{Id: id, Routers: routers})
+	}
+	bytes, err := lookup.Serialize()
+	if err != nil {
+		e.Cancel(fmt.Errorf("failed to handle message (%s) --- %s", msg.Type.String(), err))
+		return
+	}
+	sendChannel <- &pb.Message{Type: pb.Message_PEER_LOOKUP_ACK, Payload: bytes}
 }
 
 func (h *Handler) afterKeepAlive(e *fsm.Event) {
@@ -351,8 +496,27 @@ func (h *Handler) afterChainMessage(e *fsm.Event) {
 		return
 	}
 	msg := e.Args[0].(*pb.Message)
+	conn := e.Args[2].(net.Conn)
 
-	if err := h.router.RouteMessage(msg); err != nil {
+	if err := h.router.RouteMessage(msg, conn); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (h *Handler) afterDeadLetter(e *fsm.Event) {
+	if _, ok := e.Args[0].(*pb.Message); !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	msg := e.Args[0].(*pb.Message)
+	conn := e.Args[2].(net.Conn)
+
+	//notices are generated by routers only, peers could direct them to any peer
+	if !h.router.isRouterConn(conn) {
+		e.Cancel(fmt.Errorf("router %s refuses dead letter from %s, not a router", h.router.address, conn.RemoteAddr()))
+		return
+	}
+	if err := h.router.routeDeadLetter(msg); err != nil {
 		e.Cancel(err)
 	}
 }
@@ -0,0 +1,331 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//Package member 提供 SWIM 风格的路由器成员表，包括怀疑机制、化身号(incarnation)和捎带传播
+package member
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+//State state of member
+type State int
+
+//states of member, a member refutes suspicion by a higher incarnation
+const (
+	Alive State = iota
+	Suspect
+	Dead
+	Left
+)
+
+func (s State) String() string {
+	switch s {
+	case Alive:
+		return "alive"
+	case Suspect:
+		return "suspect"
+	case Dead:
+		return "dead"
+	case Left:
+		return "left"
+	}
+	return "unknown"
+}
+
+//Member router of the mesh, identified by address
+type Member struct {
+	Address     string    `json:"address"`
+	ID          string    `json:"id,omitempty"`
+	State       State     `json:"state"`
+	Incarnation uint64    `json:"incarnation"`
+	Since       time.Time `json:"since"` //time of the last state change seen locally
+}
+
+//Config parameters of member list
+type Config struct {
+	Suspicion  time.Duration //suspect member is declared dead if it does not refute within it
+	Retransmit int           //each update is piggybacked Retransmit*log2(n+1) times
+	Reap       time.Duration //dead and left members are forgotten after it
+}
+
+type broadcast struct {
+	member    Member
+	transmits int
+}
+
+//List members known by local router
+type List struct {
+	self    Member
+	members map[string]*Member
+	queue   []*broadcast
+	order   []string //probe order, shuffled each round
+	next    int
+	config  Config
+	sync.Mutex
+}
+
+//NewList creates member list of local member, it is announced as alive
+func NewList(self Member, config Config) *List {
+	if config.Suspicion <= 0 {
+		config.Suspicion = 5 * time.Second
+	}
+	if config.Retransmit <= 0 {
+		config.Retransmit = 3
+	}
+	if config.Reap <= 0 {
+		config.Reap = time.Hour
+	}
+	self.State = Alive
+	l := &List{self: self, members: make(map[string]*Member), config: config}
+	l.enqueue(self)
+	return l
+}
+
+//Self returns local member
+func (l *List) Self() Member {
+	l.Lock()
+	defer l.Unlock()
+	return l.self
+}
+
+//Get returns member of address
+func (l *List) Get(address string) (Member, bool) {
+	l.Lock()
+	defer l.Unlock()
+	m, ok := l.members[address]
+	if !ok {
+		return Member{}, false
+	}
+	return *m, true
+}
+
+//Members returns known members without local one, ordered by address
+func (l *List) Members() []Member {
+	l.Lock()
+	defer l.Unlock()
+	members := []Member{}
+	for _, m := range l.members {
+		members = append(members, *m)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Address < members[j].Address })
+	return members
+}
+
+//Stats number of members by state, local one included
+func (l *List) Stats() map[string]int {
+	l.Lock()
+	defer l.Unlock()
+	stats := map[string]int{l.self.State.String(): 1}
+	for _, m := range l.members {
+		stats[m.State.String()]++
+	}
+	return stats
+}
+
+//overrides returns true if update u supersedes the state of member m
+func overrides(m *Member, u Member) bool {
+	switch {
+	case u.Incarnation > m.Incarnation:
+		return true
+	case u.Incarnation < m.Incarnation:
+		return false
+	}
+	//same incarnation, suspicion overrides alive and death overrides both
+	return u.State > m.State && m.State < Dead
+}
+
+//Apply merges update about member, it returns the member and true if its state changed.
+//Suspicion or death of local member is refuted by announcing it alive with a higher incarnation
+func (l *List) Apply(u Member, now time.Time) (Member, bool) {
+	l.Lock()
+	defer l.Unlock()
+	return l.apply(u, now)
+}
+
+func (l *List) apply(u Member, now time.Time) (Member, bool) {
+	if u.Address == l.self.Address {
+		if u.State != Alive && u.Incarnation >= l.self.Incarnation && l.self.State == Alive {
+			l.self.Incarnation = u.Incarnation + 1
+			l.enqueue(l.self)
+		}
+		return l.self, false
+	}
+	m, ok := l.members[u.Address]
+	if ok && !overrides(m, u) {
+		if m.ID == "" && u.ID != "" {
+			m.ID = u.ID
+		}
+		return *m, false
+	}
+	if !ok {
+		m = &Member{Address: u.Address}
+		l.members[u.Address] = m
+	}
+	m.State, m.Incarnation, m.Since = u.State, u.Incarnation, now
+	if u.ID != "" {
+		m.ID = u.ID
+	}
+	l.enqueue(*m)
+	return *m, true
+}
+
+//Join adds member met directly as alive, it returns false if the member is already known
+func (l *List) Join(address, id string, now time.Time) (Member, bool) {
+	l.Lock()
+	defer l.Unlock()
+	if address == l.self.Address {
+		return l.self, false
+	}
+	if m, ok := l.members[address]; ok {
+		return *m, false
+	}
+	return l.apply(Member{Address: address, ID: id, State: Alive}, now)
+}
+
+//Suspect marks member suspected after it failed to answer probes
+func (l *List) Suspect(address string, now time.Time) (Member, bool) {
+	l.Lock()
+	defer l.Unlock()
+	m, ok := l.members[address]
+	if !ok || m.State != Alive {
+		return Member{}, false
+	}
+	return l.apply(Member{Address: address, ID: m.ID, State: Suspect, Incarnation: m.Incarnation}, now)
+}
+
+//Leave announces local member left
+func (l *List) Leave() Member {
+	l.Lock()
+	defer l.Unlock()
+	l.self.State = Left
+	l.enqueue(l.self)
+	return l.self
+}
+
+//Tick declares suspects dead after the suspicion timeout and forgets dead and left members after reap,
+//it returns members declared dead
+func (l *List) Tick(now time.Time) []Member {
+	l.Lock()
+	defer l.Unlock()
+	dead := []Member{}
+	for address, m := range l.members {
+		switch {
+		case m.State == Suspect && now.Sub(m.Since) >= l.config.Suspicion:
+			m.State, m.Since = Dead, now
+			l.enqueue(*m)
+			dead = append(dead, *m)
+		case m.State >= Dead && now.Sub(m.Since) >= l.config.Reap:
+			delete(l.members, address)
+		}
+	}
+	sort.Slice(dead, func(i, j int) bool { return dead[i].Address < dead[j].Address })
+	return dead
+}
+
+//Next returns the next member to probe, alive and suspect members are probed round robin in random order
+func (l *List) Next() (Member, bool) {
+	l.Lock()
+	defer l.Unlock()
+	for round := 0; round < 2; round++ {
+		for ; l.next < len(l.order); l.next++ {
+			if m, ok := l.members[l.order[l.next]]; ok && m.State <= Suspect {
+				l.next++
+				return *m, true
+			}
+		}
+		l.order, l.next = l.order[:0], 0
+		for address, m := range l.members {
+			if m.State <= Suspect {
+				l.order = append(l.order, address)
+			}
+		}
+		rand.Shuffle(len(l.order), func(i, j int) { l.order[i], l.order[j] = l.order[j], l.order[i] })
+	}
+	return Member{}, false
+}
+
+//Random returns up to k random alive members except the given addresses
+func (l *List) Random(k int, except ...string) []Member {
+	l.Lock()
+	defer l.Unlock()
+	candidates := []Member{}
+	for address, m := range l.members {
+		if m.State != Alive {
+			continue
+		}
+		excluded := false
+		for _, e := range except {
+			excluded = excluded || e == address
+		}
+		if !excluded {
+			candidates = append(candidates, *m)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+//Updates returns up to max updates to piggyback, the least transmitted first.
+//An update is dropped after Retransmit*log2(n+1) transmissions
+func (l *List) Updates(max int) []Member {
+	l.Lock()
+	defer l.Unlock()
+	limit := l.config.Retransmit * int(math.Ceil(math.Log2(float64(len(l.members)+2))))
+	sort.SliceStable(l.queue, func(i, j int) bool { return l.queue[i].transmits < l.queue[j].transmits })
+	updates := []Member{}
+	for _, b := range l.queue {
+		if len(updates) >= max {
+			break
+		}
+		updates = append(updates, b.member)
+		b.transmits++
+	}
+	queue := l.queue[:0]
+	for _, b := range l.queue {
+		if b.transmits < limit {
+			queue = append(queue, b)
+		}
+	}
+	l.queue = queue
+	return updates
+}
+
+//Pending number of updates waiting for dissemination
+func (l *List) Pending() int {
+	l.Lock()
+	defer l.Unlock()
+	return len(l.queue)
+}
+
+func (l *List) enqueue(m Member) {
+	for i, b := range l.queue {
+		if b.member.Address == m.Address {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			break
+		}
+	}
+	l.queue = append(l.queue, &broadcast{member: m})
+}
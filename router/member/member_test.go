@@ -0,0 +1,123 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package member
+
+import (
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	now := time.Now()
+	l := NewList(Member{Address: "r0", ID: "00", Incarnation: 10}, Config{Suspicion: time.Second, Retransmit: 1, Reap: time.Minute})
+	if _, ok := l.Join("r1", "01", now); !ok {
+		t.Fatal("member is not joined")
+	}
+	if _, ok := l.Join("r1", "01", now); ok {
+		t.Fatal("member is joined twice")
+	}
+	l.Apply(Member{Address: "r2", ID: "02", State: Alive, Incarnation: 5}, now)
+
+	//suspicion of the same incarnation overrides alive, alive needs a higher one to refute it
+	if m, ok := l.Apply(Member{Address: "r2", State: Suspect, Incarnation: 5}, now); !ok || m.State != Suspect || m.ID != "02" {
+		t.Fatalf("unexpected member %+v", m)
+	}
+	if _, ok := l.Apply(Member{Address: "r2", State: Alive, Incarnation: 5}, now); ok {
+		t.Fatal("stale alive overrides suspicion")
+	}
+	if m, ok := l.Apply(Member{Address: "r2", State: Alive, Incarnation: 6}, now); !ok || m.State != Alive {
+		t.Fatalf("suspicion is not refuted, %+v", m)
+	}
+	//death is final for the incarnation
+	l.Apply(Member{Address: "r2", State: Dead, Incarnation: 6}, now)
+	if _, ok := l.Apply(Member{Address: "r2", State: Suspect, Incarnation: 6}, now); ok {
+		t.Fatal("suspicion overrides death")
+	}
+	if m, ok := l.Apply(Member{Address: "r2", State: Alive, Incarnation: 7}, now); !ok || m.State != Alive {
+		t.Fatalf("restarted member does not rejoin, %+v", m)
+	}
+
+	//local member refutes suspicion
+	l.Apply(Member{Address: "r0", State: Suspect, Incarnation: 10}, now)
+	if self := l.Self(); self.State != Alive || self.Incarnation != 11 {
+		t.Fatalf("suspicion of local member is not refuted, %+v", self)
+	}
+
+	//suspect member is declared dead after the timeout, dead members are reaped later
+	if _, ok := l.Suspect("r1", now); !ok {
+		t.Fatal("member is not suspected")
+	}
+	if dead := l.Tick(now.Add(500 * time.Millisecond)); len(dead) != 0 {
+		t.Fatalf("member declared dead too early, %v", dead)
+	}
+	if dead := l.Tick(now.Add(time.Second)); len(dead) != 1 || dead[0].Address != "r1" || dead[0].State != Dead {
+		t.Fatalf("unexpected dead members %v", dead)
+	}
+	if stats := l.Stats(); stats["alive"] != 2 || stats["dead"] != 1 {
+		t.Fatalf("unexpected stats %v", stats)
+	}
+	l.Tick(now.Add(2 * time.Minute))
+	if _, ok := l.Get("r1"); ok {
+		t.Fatal("dead member is not reaped")
+	}
+}
+
+func TestListDissemination(t *testing.T) {
+	now := time.Now()
+	l := NewList(Member{Address: "r0", Incarnation: 1}, Config{Retransmit: 2})
+	for _, address := range []string{"r1", "r2", "r3"} {
+		l.Join(address, "", now)
+	}
+	//limit is 2*log2(3+2) = 6 transmissions of each of the 4 updates
+	sent := map[string]int{}
+	for i := 0; i < 100 && l.Pending() > 0; i++ {
+		updates := l.Updates(2)
+		if len(updates) > 2 {
+			t.Fatalf("too many updates %d", len(updates))
+		}
+		for _, u := range updates {
+			sent[u.Address]++
+		}
+	}
+	if l.Pending() != 0 || len(sent) != 4 {
+		t.Fatalf("updates are not disseminated %v", sent)
+	}
+	for address, n := range sent {
+		if n != 6 {
+			t.Fatalf("update of %s transmitted %d times", address, n)
+		}
+	}
+
+	//each member is probed once in a round, dead ones are skipped
+	l.Apply(Member{Address: "r3", State: Dead}, now)
+	probed := map[string]int{}
+	for i := 0; i < 4; i++ {
+		m, ok := l.Next()
+		if !ok {
+			t.Fatal("no member to probe")
+		}
+		probed[m.Address]++
+	}
+	if probed["r1"] != 2 || probed["r2"] != 2 || probed["r3"] != 0 {
+		t.Fatalf("unexpected probes %v", probed)
+	}
+	if helpers := l.Random(3, "r1"); len(helpers) != 1 || helpers[0].Address != "r2" {
+		t.Fatalf("unexpected helpers %v", helpers)
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package router
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bocheninc/msg-net/config"
+	"github.com/bocheninc/msg-net/logger"
+	pb "github.com/bocheninc/msg-net/protos"
+	"github.com/bocheninc/msg-net/router/member"
+	"github.com/bocheninc/msg-net/router/route"
+)
+
+const (
+	memberTTL     = 16 //hops a membership message is forwarded to reach a router that is not a neighbor
+	memberUpdates = 8  //updates piggybacked on each membership message
+)
+
+//relay indirect probe of a target on behalf of origin, the ack is sent back with the seq of origin
+type relay struct {
+	origin  string
+	seq     uint64
+	expires time.Time
+}
+
+//membership SWIM failure detector of local router, each period a member is pinged directly, then
+//through indirect members, and suspected if none answers
+type membership struct {
+	list     *member.List
+	seq      uint64
+	probes   map[uint64]chan struct{}
+	relays   map[uint64]*relay
+	probe    time.Duration
+	timeout  time.Duration
+	indirect int
+	sync.Mutex
+}
+
+func loadDuration(key string, d time.Duration) time.Duration {
+	if v, err := time.ParseDuration(config.GetString(key)); err == nil && v > 0 {
+		return v
+	}
+	return d
+}
+
+//startMembership starts probing members if router.membership.enabled
+func (r *Router) startMembership(ctx context.Context) {
+	r.members = nil
+	if !config.GetBool("router.membership.enabled") {
+		return
+	}
+	m := &membership{
+		probes:   make(map[uint64]chan struct{}),
+		relays:   make(map[uint64]*relay),
+		probe:    loadDuration("router.membership.probe", time.Second),
+		timeout:  loadDuration("router.membership.timeout", 300*time.Millisecond),
+		indirect: config.GetInt("router.membership.indirect"),
+	}
+	if m.timeout >= m.probe {
+		m.timeout = m.probe / 2
+	}
+	//incarnation starts from the clock, so a restarted router overrides the death of its former life
+	self := member.Member{Address: r.address, ID: r.id, Incarnation: uint64(time.Now().UnixNano())}
+	m.list = member.NewList(self, member.Config{
+		Suspicion:  loadDuration("router.membership.suspicion", 5*time.Second),
+		Retransmit: config.GetInt("router.membership.retransmit"),
+		Reap:       storeExpire(),
+	})
+	r.members = m
+	go r.probeMembers(ctx, m)
+}
+
+//stopMembership announces local router left to all neighbors at once and waits their acks up to the timeout,
+//so the announcement is not lost with the connections; they disseminate it to the others
+func (r *Router) stopMembership() {
+	m := r.members
+	if m == nil {
+		return
+	}
+	m.list.Leave()
+	neighbors := []string{}
+	r.routerIterFunc(func(address string, router *pb.Router) {
+		neighbors = append(neighbors, address)
+	})
+	pending := []chan struct{}{}
+	for _, address := range neighbors {
+		seq, acked := m.newProbe()
+		defer m.doneProbe(seq)
+		if r.sendMember(pb.Message_MEMBER_PING, &pb.Membership{Seq: seq, Src: r.address, Dst: address, Target: address}) {
+			pending = append(pending, acked)
+		}
+	}
+	timeout := time.After(m.timeout)
+	for _, acked := range pending {
+		select {
+		case <-acked:
+		case <-timeout:
+			return
+		}
+	}
+}
+
+//OnMember registers function called when state of a member changes
+func (r *Router) OnMember(function func(*member.Member)) {
+	r.onMember = function
+}
+
+//Members returns members known by local router, nil if membership is disabled
+func (r *Router) Members() []member.Member {
+	if r.members == nil {
+		return nil
+	}
+	return r.members.list.Members()
+}
+
+func (r *Router) probeMembers(ctx context.Context, m *membership) {
+	ticker := time.NewTicker(m.probe)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.probeMember(ctx, m)
+			for _, dead := range m.list.Tick(time.Now()) {
+				r.memberChanged(dead)
+			}
+		}
+	}
+}
+
+//probeMember pings the next member, asks indirect members to ping it if no ack within the timeout,
+//and suspects it if still no ack at the end of the period
+func (r *Router) probeMember(ctx context.Context, m *membership) {
+	target, ok := m.list.Next()
+	if !ok {
+		return
+	}
+	seq, acked := m.newProbe()
+	defer m.doneProbe(seq)
+	r.sendMember(pb.Message_MEMBER_PING, &pb.Membership{Seq: seq, Src: r.address, Dst: target.Address, Target: target.Address})
+	select {
+	case <-ctx.Done():
+		return
+	case <-acked:
+		return
+	case <-time.After(m.timeout):
+	}
+	for _, helper := range m.list.Random(m.indirect, target.Address) {
+		r.sendMember(pb.Message_MEMBER_PING_REQ, &pb.Membership{Seq: seq, Src: r.address, Dst: helper.Address, Target: target.Address})
+	}
+	select {
+	case <-ctx.Done():
+	case <-acked:
+	case <-time.After(m.probe - m.timeout):
+		if suspect, ok := m.list.Suspect(target.Address, time.Now()); ok {
+			r.memberChanged(suspect)
+		}
+	}
+}
+
+func (m *membership) newProbe() (uint64, chan struct{}) {
+	m.Lock()
+	defer m.Unlock()
+	m.seq++
+	acked := make(chan struct{})
+	m.probes[m.seq] = acked
+	return m.seq, acked
+}
+
+func (m *membership) doneProbe(seq uint64) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.probes, seq)
+}
+
+//newRelay records indirect probe of origin, expired relays are dropped
+func (m *membership) newRelay(origin string, seq uint64) uint64 {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now()
+	for s, rl := range m.relays {
+		if now.After(rl.expires) {
+			delete(m.relays, s)
+		}
+	}
+	m.seq++
+	m.relays[m.seq] = &relay{origin: origin, seq: seq, expires: now.Add(m.probe)}
+	return m.seq
+}
+
+//ack completes the probe of seq, or returns the relay waiting for it
+func (m *membership) ack(seq uint64) *relay {
+	m.Lock()
+	defer m.Unlock()
+	if acked, ok := m.probes[seq]; ok {
+		delete(m.probes, seq)
+		close(acked)
+		return nil
+	}
+	rl, ok := m.relays[seq]
+	if !ok {
+		return nil
+	}
+	delete(m.relays, seq)
+	return rl
+}
+
+//sendMember sends membership message with local member and pending updates piggybacked
+func (r *Router) sendMember(typ pb.Message_Type, ms *pb.Membership) bool {
+	list := r.members.list
+	self := list.Self()
+	ms.Members = append(ms.Members, memberToProto(self))
+	for _, u := range list.Updates(memberUpdates) {
+		if u.Address != self.Address {
+			ms.Members = append(ms.Members, memberToProto(u))
+		}
+	}
+	ms.Ttl = memberTTL
+	return r.forwardMember(typ, ms)
+}
+
+//forwardMember sends membership message to its destination directly, or through next hops of the route
+func (r *Router) forwardMember(typ pb.Message_Type, ms *pb.Membership) bool {
+	bytes, err := ms.Serialize()
+	if err != nil {
+		logger.Errorf("failed to serialize membership --- %v", err)
+		return false
+	}
+	nextKeys := []string{ms.Dst}
+	if !r.routerExist(ms.Dst) {
+		if nextKeys, err = r.allRouters.GetNextHops(ms.Dst); err != nil {
+			logger.Debugf("router %s has no route to member %s --- %v", r.address, ms.Dst, err)
+			return false
+		}
+	}
+	return r.sendToNextHops(nextKeys, &pb.Message{Type: typ, Payload: bytes}) != ""
+}
+
+//handleMember merges piggybacked updates, then forwards the message or answers it
+func (r *Router) handleMember(msg *pb.Message) error {
+	if r.members == nil {
+		return nil
+	}
+	ms := &pb.Membership{}
+	if err := ms.Deserialize(msg.Payload); err != nil {
+		return fmt.Errorf("failed to handle message (%s) --- %s", msg.Type.String(), err)
+	}
+	now := time.Now()
+	for _, u := range ms.Members {
+		if m, ok := r.members.list.Apply(memberFromProto(u), now); ok {
+			r.memberChanged(m)
+		}
+	}
+
+	if ms.Dst != r.address {
+		if ms.Ttl <= 1 {
+			logger.Debugf("router %s drops membership message from %s to %s, ttl expired", r.address, ms.Src, ms.Dst)
+			return nil
+		}
+		ms.Ttl--
+		r.forwardMember(msg.Type, ms)
+		return nil
+	}
+	switch msg.Type {
+	case pb.Message_MEMBER_PING:
+		r.sendMember(pb.Message_MEMBER_ACK, &pb.Membership{Seq: ms.Seq, Src: r.address, Dst: ms.Src, Target: r.address})
+	case pb.Message_MEMBER_PING_REQ:
+		seq := r.members.newRelay(ms.Src, ms.Seq)
+		r.sendMember(pb.Message_MEMBER_PING, &pb.Membership{Seq: seq, Src: r.address, Dst: ms.Target, Target: ms.Target})
+	case pb.Message_MEMBER_ACK:
+		if rl := r.members.ack(ms.Seq); rl != nil {
+			r.sendMember(pb.Message_MEMBER_ACK, &pb.Membership{Seq: rl.seq, Src: r.address, Dst: rl.origin, Target: ms.Target})
+		}
+	}
+	return nil
+}
+
+//joinMember router met directly is a member
+func (r *Router) joinMember(address, id string) {
+	if r.members == nil {
+		return
+	}
+	if m, ok := r.members.list.Join(address, id, time.Now()); ok {
+		r.memberChanged(m)
+	}
+}
+
+//memberChanged links of dead members which are not neighbors are pruned, so routes avoid them before the periodic sync
+func (r *Router) memberChanged(m member.Member) {
+	switch m.State {
+	case member.Alive:
+		logger.Infof("router %s member %s is alive, incarnation %d", r.address, m.Address, m.Incarnation)
+	case member.Suspect:
+		logger.Warnf("router %s suspects member %s, incarnation %d", r.address, m.Address, m.Incarnation)
+	case member.Dead:
+		logger.Warnf("router %s member %s is dead, incarnation %d", r.address, m.Address, m.Incarnation)
+		if !r.routerExist(m.Address) {
+			r.allRouters.UpdateNetworkTopology(route.NewNodeLink(m.Address, nil))
+		}
+	case member.Left:
+		logger.Infof("router %s member %s left", r.address, m.Address)
+		r.routerLeft(m.Address)
+		if !r.routerExist(m.Address) {
+			r.allRouters.UpdateNetworkTopology(route.NewNodeLink(m.Address, nil))
+		}
+	}
+	if r.onMember != nil {
+		r.onMember(&m)
+	}
+}
+
+//liveMembers addresses of alive and suspect members
+func (r *Router) liveMembers() []string {
+	if r.members == nil {
+		return nil
+	}
+	addresses := []string{}
+	for _, m := range r.members.list.Members() {
+		if m.State <= member.Suspect {
+			addresses = append(addresses, m.Address)
+		}
+	}
+	return addresses
+}
+
+func memberToProto(m member.Member) *pb.Member {
+	return &pb.Member{Id: m.ID, Address: m.Address, State: pb.Member_State(m.State), Incarnation: m.Incarnation}
+}
+
+func memberFromProto(m *pb.Member) member.Member {
+	return member.Member{ID: m.Id, Address: m.Address, State: member.State(m.State), Incarnation: m.Incarnation}
+}
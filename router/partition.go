@@ -0,0 +1,202 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package router
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bocheninc/msg-net/config"
+	"github.com/bocheninc/msg-net/logger"
+	"github.com/bocheninc/msg-net/router/route"
+)
+
+//Partition change of known routers unreachable from local router
+type Partition struct {
+	Unreachable []string //all known routers without route now, empty if the partition healed
+	Lost        []string //routers became unreachable since the last event
+	Healed      []string //routers became reachable again since the last event
+	Time        time.Time
+}
+
+//Partitioned returns true if some known routers are unreachable
+func (p *Partition) Partitioned() bool {
+	return len(p.Unreachable) > 0
+}
+
+//PartitionStats counters of partitions
+type PartitionStats struct {
+	Unreachable int   `json:"unreachable"`
+	Detected    int64 `json:"detected"`
+	Healed      int64 `json:"healed"`
+}
+
+//unreachableRouter known router without route, it is retried with backoff
+type unreachableRouter struct {
+	since   time.Time
+	next    time.Time
+	backoff time.Duration
+}
+
+//partitionState routers unreachable from local router, routers closed gracefully are not expected back
+type partitionState struct {
+	unreachable map[string]*unreachableRouter
+	left        map[string]bool
+	stats       PartitionStats
+}
+
+func newPartitionState() *partitionState {
+	return &partitionState{unreachable: make(map[string]*unreachableRouter), left: make(map[string]bool)}
+}
+
+//OnPartition registers function called when known routers become unreachable or reachable again
+func (r *Router) OnPartition(function func(*Partition)) {
+	r.onPartition = function
+}
+
+//PartitionStats returns counters of partitions
+func (r *Router) PartitionStats() PartitionStats {
+	r.rwPartition.Lock()
+	defer r.rwPartition.Unlock()
+	stats := r.partition.stats
+	stats.Unreachable = len(r.partition.unreachable)
+	return stats
+}
+
+//knownRouters routers the local router expects to reach besides those of the links, seeds, stored, live members and unreachable ones
+func (r *Router) knownRouters() []string {
+	addresses := r.discoveries()
+	if r.store != nil {
+		for _, record := range r.store.Routers(storeExpire()) {
+			addresses = append(addresses, record.Address)
+		}
+	}
+	addresses = append(addresses, r.liveMembers()...)
+	r.rwPartition.Lock()
+	defer r.rwPartition.Unlock()
+	for address := range r.partition.unreachable {
+		addresses = append(addresses, address)
+	}
+	known := []string{}
+	for _, address := range addresses {
+		if address != "" && address != r.address && !r.partition.left[address] {
+			known = append(known, address)
+		}
+	}
+	return known
+}
+
+//routerLeft router closed gracefully, it is not reported as unreachable until it is reachable again
+func (r *Router) routerLeft(address string) {
+	r.rwPartition.Lock()
+	defer r.rwPartition.Unlock()
+	r.partition.left[address] = true
+	delete(r.partition.unreachable, address)
+}
+
+//isUnreachable returns true if router is known but unreachable
+func (r *Router) isUnreachable(address string) bool {
+	r.rwPartition.Lock()
+	defer r.rwPartition.Unlock()
+	_, ok := r.partition.unreachable[address]
+	return ok
+}
+
+//checkPartition compares reachable routers with known routers. Links of routers just lost are pruned so the route
+//holds the local partition only, unreachable routers are retried with backoff up to router.partition.retryMax,
+//and the full state is flooded when some come back so both sides merge without waiting for the periodic sync
+func (r *Router) checkPartition() {
+	now := time.Now()
+	t := r.Topology()
+	retryMax := time.Minute
+	if d, err := time.ParseDuration(config.GetString("router.partition.retryMax")); err == nil && d > 0 {
+		retryMax = d
+	}
+
+	lost, healed, retries := []string{}, []string{}, []string{}
+	r.rwPartition.Lock()
+	p := r.partition
+	partitioned := len(p.unreachable) > 0
+	for address := range p.left {
+		if _, ok := t.NextHops[address]; ok {
+			delete(p.left, address)
+		}
+	}
+	current := make(map[string]bool)
+	for _, address := range t.Unreachable {
+		current[address] = true
+		if _, ok := p.unreachable[address]; !ok {
+			p.unreachable[address] = &unreachableRouter{since: now, next: now, backoff: r.timeout(&r.durationRouters)}
+			lost = append(lost, address)
+		}
+	}
+	for address, u := range p.unreachable {
+		if _, ok := t.NextHops[address]; ok {
+			healed = append(healed, address)
+			delete(p.unreachable, address)
+		} else if !current[address] || now.Sub(u.since) > storeExpire() {
+			delete(p.unreachable, address)
+		} else if !now.Before(u.next) {
+			retries = append(retries, address)
+			u.next = now.Add(u.backoff)
+			if u.backoff *= 2; u.backoff > retryMax {
+				u.backoff = retryMax
+			}
+		}
+	}
+	unreachable := []string{}
+	for address := range p.unreachable {
+		unreachable = append(unreachable, address)
+	}
+	if !partitioned && len(unreachable) > 0 {
+		p.stats.Detected++
+	} else if partitioned && len(unreachable) == 0 {
+		p.stats.Healed++
+	}
+	r.rwPartition.Unlock()
+
+	for _, address := range lost {
+		r.allRouters.UpdateNetworkTopology(route.NewNodeLink(address, nil))
+	}
+	for _, address := range retries {
+		if !r.routerExist(address) {
+			logger.Debugf("router %s retries unreachable router %s", r.address, address)
+			go r.connectRouter(address)
+		}
+	}
+	if len(lost) == 0 && len(healed) == 0 {
+		return
+	}
+	sort.Strings(unreachable)
+	sort.Strings(lost)
+	sort.Strings(healed)
+	if len(unreachable) > 0 {
+		logger.Warnf("router %s partitioned, known routers %v unreachable, lost %v, healed %v", r.address, unreachable, lost, healed)
+	} else {
+		logger.Infof("router %s partition healed, routers %v reachable again", r.address, healed)
+	}
+	if len(healed) > 0 {
+		r.broadcastNetworkRouters()
+		r.broadcastPeerDigest()
+		r.broadcastSummaries(true)
+	}
+	if r.onPartition != nil {
+		r.onPartition(&Partition{Unreachable: unreachable, Lost: lost, Healed: healed, Time: now})
+	}
+}
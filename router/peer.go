@@ -20,7 +20,7 @@ package router
 
 import (
 	"encoding/json"
-	"strings"
+	"sort"
 	"sync"
 
 	pb "github.com/bocheninc/msg-net/protos"
@@ -30,15 +30,25 @@ import (
 func NewPeers() *Peers {
 	peers := &Peers{}
 	peers.m = make(map[string][]*pb.Peer)
+	peers.versions = make(map[string]tableVersion)
+	peers.areas = make(map[string]string)
 	return peers
 }
 
 //Peers peers struct
 type Peers struct {
-	m map[string][]*pb.Peer
+	m        map[string][]*pb.Peer
+	versions map[string]tableVersion
+	areas    map[string]string //router key -> area its peer table is flooded in
 	sync.RWMutex
 }
 
+//tableVersion version of peer table of a router, epoch changes when the router restarts
+type tableVersion struct {
+	epoch   int64
+	version uint64
+}
+
 //Update update peers
 func (p *Peers) Update(key string, peers []*pb.Peer) {
 	p.Lock()
@@ -46,6 +56,73 @@ func (p *Peers) Update(key string, peers []*pb.Peer) {
 	p.m[key] = peers
 }
 
+//Apply applies full snapshot or delta of router peer table,
+//it returns false if the delta does not follow the local copy and a full resync is needed
+func (p *Peers) Apply(update *pb.Peers) bool {
+	p.Lock()
+	defer p.Unlock()
+	p.areas[update.Id] = update.Area
+	known, ok := p.versions[update.Id]
+	if !ok && update.Delta && update.Base == 0 {
+		//the first delta of the table
+		known, ok = tableVersion{epoch: update.Epoch}, true
+	}
+	sameEpoch := ok && known.epoch == update.Epoch
+	if !update.Delta {
+		if sameEpoch && update.Version < known.version {
+			return true
+		}
+		p.set(update.Id, update.Peers)
+		p.versions[update.Id] = tableVersion{epoch: update.Epoch, version: update.Version}
+		return true
+	}
+	if !sameEpoch || update.Base > known.version {
+		return false
+	}
+	if update.Base < known.version {
+		//stale delta arrived by a slower path
+		return true
+	}
+	removed := make(map[string]bool)
+	for _, id := range update.Removed {
+		removed[id] = true
+	}
+	for _, peer := range update.Peers {
+		removed[peer.Id] = true
+	}
+	peers := []*pb.Peer{}
+	for _, peer := range p.m[update.Id] {
+		if !removed[peer.Id] {
+			peers = append(peers, peer)
+		}
+	}
+	p.set(update.Id, append(peers, update.Peers...))
+	p.versions[update.Id] = tableVersion{epoch: update.Epoch, version: update.Version}
+	return true
+}
+
+func (p *Peers) set(key string, peers []*pb.Peer) {
+	if len(peers) == 0 {
+		delete(p.m, key)
+	} else {
+		p.m[key] = peers
+	}
+}
+
+//Check compares digest of router peer table with the local copy, it returns false if the local copy is behind or differs
+func (p *Peers) Check(digest *pb.PeerDigest) bool {
+	p.RLock()
+	defer p.RUnlock()
+	known, ok := p.versions[digest.Id]
+	if !ok {
+		return digest.Count == 0
+	}
+	if known.epoch != digest.Epoch || known.version < digest.Version {
+		return false
+	}
+	return known.version > digest.Version || uint32(len(p.m[digest.Id])) == digest.Count
+}
+
 //String returns summary
 func (p *Peers) String() string {
 	p.RLock()
@@ -56,30 +133,71 @@ func (p *Peers) String() string {
 
 //GetKeys gets keys by id
 func (p *Peers) GetKeys(id string) (res []string) {
+	return p.GetKeysBySelector(id, nil)
+}
+
+//GetKeysBySelector gets keys of routers attached by peers matching id and selector
+func (p *Peers) GetKeysBySelector(id string, selector pb.Selector) (res []string) {
 	p.RLock()
 	defer p.RUnlock()
-	m := make(map[string]string)
-	if strings.HasSuffix(id, ":") {
-		for k, v := range p.m {
-			for _, p := range v {
-				if strings.HasPrefix(p.Id, id) {
-					m[k] = k
-				}
+	for k, v := range p.m {
+		for _, peer := range v {
+			if peer.MatchID(id) && selector.Matches(peer) {
+				res = append(res, k)
+				break
 			}
 		}
-	} else {
-		for k, v := range p.m {
-			for _, p := range v {
-				if p.Id == id {
-					m[k] = k
-					break
-				}
+	}
+	return res
+}
+
+//Find gets peers of id by key of router attached to
+func (p *Peers) Find(id string) map[string]*pb.Peer {
+	p.RLock()
+	defer p.RUnlock()
+	res := make(map[string]*pb.Peer)
+	for k, v := range p.m {
+		for _, peer := range v {
+			if peer.Id == id {
+				res[k] = peer
 			}
 		}
 	}
+	return res
+}
 
-	for k := range m {
-		res = append(res, k)
+//Chains gets chains of peers attached to routers of area
+func (p *Peers) Chains(area string) []string {
+	p.RLock()
+	defer p.RUnlock()
+	res := []string{}
+	for k, v := range p.m {
+		if p.areas[k] != area {
+			continue
+		}
+		for _, peer := range v {
+			if chain := peer.Chain(); chain != "" {
+				res = append(res, chain)
+			}
+		}
+	}
+	return res
+}
+
+//Lookup gets routers of peers by id, id ends with ":" matches all peers of the chain, empty id matches all peers
+func (p *Peers) Lookup(id string) map[string][]string {
+	p.RLock()
+	defer p.RUnlock()
+	res := make(map[string][]string)
+	for k, v := range p.m {
+		for _, peer := range v {
+			if id == "" || peer.MatchID(id) {
+				res[peer.Id] = append(res[peer.Id], k)
+			}
+		}
+	}
+	for _, keys := range res {
+		sort.Strings(keys)
 	}
 	return res
 }
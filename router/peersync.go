@@ -0,0 +1,152 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package router
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/bocheninc/msg-net/logger"
+	pb "github.com/bocheninc/msg-net/protos"
+)
+
+//resyncInterval full resync of a router peer table is requested at most once within the interval
+var resyncInterval = time.Second
+
+//resyncDelay full snapshot is sent after the delay, resync requests within it are served together
+var resyncDelay = 200 * time.Millisecond
+
+//peerUpdate changes local peer table by function and floods the change as a delta of the next version
+func (r *Router) peerUpdate(function func(map[string]*localPeer) (added []*pb.Peer, removed []string)) {
+	r.rwSync.Lock()
+	defer r.rwSync.Unlock()
+
+	r.rwPeers.Lock()
+	added, removed := function(r.peers)
+	if len(added) == 0 && len(removed) == 0 {
+		r.rwPeers.Unlock()
+		return
+	}
+	r.peerVersion++
+	peers := &pb.Peers{Id: r.address, Epoch: r.peerEpoch, Version: r.peerVersion, Delta: true, Base: r.peerVersion - 1, Peers: added, Removed: removed, Area: r.area}
+	r.rwPeers.Unlock()
+
+	r.broadcastPeers(peers)
+}
+
+//broadcastNetworkPeers floods full snapshot of local peer table, it is empty while draining
+func (r *Router) broadcastNetworkPeers() {
+	r.rwSync.Lock()
+	defer r.rwSync.Unlock()
+
+	r.rwPeers.Lock()
+	r.peerVersion++
+	peers := &pb.Peers{Id: r.address, Epoch: r.peerEpoch, Version: r.peerVersion, Area: r.area}
+	if !r.isDraining() {
+		for _, lp := range r.peers {
+			peers.Peers = append(peers.Peers, lp.peer)
+		}
+	}
+	r.rwPeers.Unlock()
+
+	r.broadcastPeers(peers)
+}
+
+//broadcastPeers floods update of local peer table within the area of local router
+func (r *Router) broadcastPeers(peers *pb.Peers) {
+	bytes, _ := peers.Serialize()
+	msg := &pb.Message{Type: pb.Message_PEER_SYNC, Payload: bytes}
+	msg.Metadata = append(msg.Metadata, []byte(time.Now().String()+":"+r.address)...)
+
+	r.allPeers.Apply(peers)
+	r.msgUniqueAdd(msg)
+	r.broadcastArea(msg, r.area)
+	r.summarizeLater()
+}
+
+//broadcastPeerDigest floods version of local peer table for anti-entropy, routers behind request a resync
+func (r *Router) broadcastPeerDigest() {
+	r.timerNetworkPeers.Stop()
+	r.rwPeers.RLock()
+	digest := &pb.PeerDigest{Id: r.address, Epoch: r.peerEpoch, Version: r.peerVersion, Area: r.area}
+	if !r.isDraining() {
+		digest.Count = uint32(len(r.peers))
+	}
+	r.rwPeers.RUnlock()
+
+	bytes, _ := digest.Serialize()
+	msg := &pb.Message{Type: pb.Message_PEER_DIGEST, Payload: bytes}
+	msg.Metadata = append(msg.Metadata, []byte(time.Now().String()+":"+r.address)...)
+	r.msgUniqueAdd(msg)
+	r.broadcastArea(msg, r.area)
+	r.timerNetworkPeers.Reset(r.timeout(&r.durationNetworkPeers))
+}
+
+//applyPeers applies peer table update of router, resync is requested from the origin on a version gap
+func (r *Router) applyPeers(peers *pb.Peers) {
+	if peers.Id == r.address {
+		return
+	}
+	if !r.allPeers.Apply(peers) {
+		logger.Infof("router %s missed peer table versions of %s before %d", r.address, peers.Id, peers.Base)
+		r.requestResync(peers.Id, peers.Area)
+	}
+	r.summarizeLater()
+}
+
+//checkPeers compares digest of router peer table, resync is requested from the origin if the local copy is behind
+func (r *Router) checkPeers(digest *pb.PeerDigest) {
+	if digest.Id == r.address {
+		return
+	}
+	if !r.allPeers.Check(digest) {
+		logger.Infof("router %s peer table of %s is behind version %d", r.address, digest.Id, digest.Version)
+		r.requestResync(digest.Id, digest.Area)
+	}
+}
+
+//requestResync floods request of full snapshot towards the origin router within its area
+func (r *Router) requestResync(origin, area string) {
+	r.rwResync.Lock()
+	if t, ok := r.resyncs[origin]; ok && time.Since(t) < resyncInterval {
+		r.rwResync.Unlock()
+		return
+	}
+	r.resyncs[origin] = time.Now()
+	r.rwResync.Unlock()
+
+	bytes, _ := (&pb.PeerDigest{Id: origin, Area: area}).Serialize()
+	msg := &pb.Message{Type: pb.Message_PEER_RESYNC, Payload: bytes}
+	msg.Metadata = append(msg.Metadata, []byte(time.Now().String()+":"+r.address)...)
+	r.msgUniqueAdd(msg)
+	r.broadcastArea(msg, area)
+}
+
+//resync schedules full snapshot of local peer table
+func (r *Router) resync() {
+	if !atomic.CompareAndSwapInt32(&r.resyncing, 0, 1) {
+		return
+	}
+	time.AfterFunc(resyncDelay, func() {
+		atomic.StoreInt32(&r.resyncing, 0)
+		if r.IsRunning() && r.ctx.Err() == nil {
+			r.broadcastNetworkPeers()
+		}
+	})
+}
@@ -0,0 +1,297 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//Package policy 提供路由策略，按源、目的、消息大小和类型匹配规则，允许、拒绝或限速
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+//actions of rule
+const (
+	ActionAllow     = "allow"
+	ActionDeny      = "deny"
+	ActionRateLimit = "ratelimit"
+)
+
+//kinds of message
+const (
+	KindUnicast   = "unicast"   //to a peer id
+	KindBroadcast = "broadcast" //to all peers of a chain
+	KindMulticast = "multicast" //to peers of a chain matching selector
+)
+
+//maxBuckets rate limit buckets kept for each rule, idle ones are dropped beyond it
+var maxBuckets = 4096
+
+//Rule matches messages and decides on them, empty fields match all.
+//Patterns of src and dst are peer ids, or chain ids ending with ":" for all peers of the chain, "*" matches all
+type Rule struct {
+	Name    string   `yaml:"name"`
+	Src     []string `yaml:"src"`
+	Dst     []string `yaml:"dst"`
+	Kinds   []string `yaml:"kinds"`
+	MinSize int      `yaml:"minSize"` //payload size in bytes
+	MaxSize int      `yaml:"maxSize"` //0 is unlimited
+	Action  string   `yaml:"action"`
+	Rate    float64  `yaml:"rate"`  //messages per second of each source peer, ratelimit only
+	Burst   int      `yaml:"burst"` //defaults to rate
+}
+
+//Policy ordered rules, the first matching rule decides, default action applies if none matches
+type Policy struct {
+	DryRun  bool    `yaml:"dryRun"` //decisions are only logged, all messages are allowed
+	Default string  `yaml:"default"`
+	Rules   []*Rule `yaml:"rules"`
+}
+
+//Message attributes of message evaluated
+type Message struct {
+	Src  string
+	Dst  string
+	Kind string
+	Size int
+}
+
+//Decision result of evaluation
+type Decision struct {
+	Allowed bool
+	Action  string
+	Rule    string //name of rule matched, empty for the default action
+	DryRun  bool
+}
+
+//Stats counters of engine
+type Stats struct {
+	Allowed uint64 `json:"allowed"`
+	Denied  uint64 `json:"denied"`
+	Limited uint64 `json:"limited"`
+	DryRun  bool   `json:"dryRun"`
+	Rules   int    `json:"rules"`
+}
+
+//Load reads policy from yaml file
+func Load(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+//Parse parses and validates policy in yaml
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	if p.Default == "" {
+		p.Default = ActionAllow
+	}
+	if p.Default != ActionAllow && p.Default != ActionDeny {
+		return nil, fmt.Errorf("invalid default action %q", p.Default)
+	}
+	for i, rule := range p.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i)
+		}
+		switch rule.Action {
+		case ActionAllow, ActionDeny:
+		case ActionRateLimit:
+			if rule.Rate <= 0 {
+				return nil, fmt.Errorf("rule %s: rate must be positive", rule.Name)
+			}
+			if rule.Burst <= 0 {
+				rule.Burst = int(rule.Rate)
+				if rule.Burst < 1 {
+					rule.Burst = 1
+				}
+			}
+		default:
+			return nil, fmt.Errorf("rule %s: invalid action %q", rule.Name, rule.Action)
+		}
+		for _, kind := range rule.Kinds {
+			if kind != KindUnicast && kind != KindBroadcast && kind != KindMulticast {
+				return nil, fmt.Errorf("rule %s: invalid kind %q", rule.Name, kind)
+			}
+		}
+		if rule.MaxSize > 0 && rule.MaxSize < rule.MinSize {
+			return nil, fmt.Errorf("rule %s: maxSize is less than minSize", rule.Name)
+		}
+	}
+	return p, nil
+}
+
+//DenyAll policy denying all messages
+func DenyAll() *Policy {
+	return &Policy{Default: ActionDeny}
+}
+
+//KindOf kind of message to dst with selector
+func KindOf(dst, selector string) string {
+	if selector != "" {
+		return KindMulticast
+	}
+	if strings.HasSuffix(dst, ":") {
+		return KindBroadcast
+	}
+	return KindUnicast
+}
+
+func matchPattern(patterns []string, id string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == id || (strings.HasSuffix(pattern, ":") && strings.HasPrefix(id, pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+//Matches rule matches message or not
+func (rule *Rule) Matches(m *Message) bool {
+	if !matchPattern(rule.Src, m.Src) || !matchPattern(rule.Dst, m.Dst) {
+		return false
+	}
+	if len(rule.Kinds) > 0 {
+		found := false
+		for _, kind := range rule.Kinds {
+			found = found || kind == m.Kind
+		}
+		if !found {
+			return false
+		}
+	}
+	return m.Size >= rule.MinSize && (rule.MaxSize == 0 || m.Size <= rule.MaxSize)
+}
+
+//bucket token bucket of a source peer
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+//NewEngine make new engine evaluating policy, nil policy allows all messages
+func NewEngine(p *Policy) *Engine {
+	e := &Engine{}
+	e.Set(p)
+	return e
+}
+
+//Engine evaluates messages against policy
+type Engine struct {
+	policy  *Policy
+	buckets map[*Rule]map[string]*bucket //rule -> source peer -> bucket
+	stats   Stats
+	sync.Mutex
+}
+
+//Set replaces policy, rate limits start over
+func (e *Engine) Set(p *Policy) {
+	e.Lock()
+	defer e.Unlock()
+	if p == nil {
+		p = &Policy{Default: ActionAllow}
+	}
+	e.policy = p
+	e.buckets = make(map[*Rule]map[string]*bucket)
+}
+
+//Evaluate decides on message, in dry run mode the decision is reported but the message is allowed
+func (e *Engine) Evaluate(m *Message) Decision {
+	e.Lock()
+	defer e.Unlock()
+	d := Decision{Action: e.policy.Default, DryRun: e.policy.DryRun}
+	var matched *Rule
+	for _, rule := range e.policy.Rules {
+		if rule.Matches(m) {
+			matched = rule
+			d.Action, d.Rule = rule.Action, rule.Name
+			break
+		}
+	}
+	switch d.Action {
+	case ActionAllow:
+		d.Allowed = true
+		e.stats.Allowed++
+	case ActionDeny:
+		e.stats.Denied++
+	case ActionRateLimit:
+		if d.Allowed = e.take(matched, m.Src); d.Allowed {
+			e.stats.Allowed++
+		} else {
+			e.stats.Limited++
+		}
+	}
+	return d
+}
+
+func (e *Engine) take(rule *Rule, src string) bool {
+	now := time.Now()
+	buckets, ok := e.buckets[rule]
+	if !ok {
+		buckets = make(map[string]*bucket)
+		e.buckets[rule] = buckets
+	}
+	b, ok := buckets[src]
+	if !ok {
+		if len(buckets) >= maxBuckets {
+			prune(rule, buckets, now)
+		}
+		b = &bucket{tokens: float64(rule.Burst), last: now}
+		buckets[src] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * rule.Rate
+	if b.tokens > float64(rule.Burst) {
+		b.tokens = float64(rule.Burst)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+//prune drops buckets idle long enough to be full again
+func prune(rule *Rule, buckets map[string]*bucket, now time.Time) {
+	for src, b := range buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rule.Rate >= float64(rule.Burst) {
+			delete(buckets, src)
+		}
+	}
+}
+
+//Stats returns counters
+func (e *Engine) Stats() Stats {
+	e.Lock()
+	defer e.Unlock()
+	stats := e.stats
+	stats.DryRun = e.policy.DryRun
+	stats.Rules = len(e.policy.Rules)
+	return stats
+}
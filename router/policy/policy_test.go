@@ -0,0 +1,115 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+var testPolicy = `
+default: deny
+rules:
+  - name: no-large
+    minSize: 100
+    action: deny
+  - name: a-to-b
+    src: ["A:"]
+    dst: ["B:", "C:p0"]
+    kinds: [unicast, broadcast]
+    action: allow
+  - name: limit
+    src: ["*"]
+    dst: ["C:"]
+    action: ratelimit
+    rate: 10
+    burst: 2
+`
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(p)
+	for _, c := range []struct {
+		m       Message
+		allowed bool
+		rule    string
+	}{
+		{Message{Src: "A:p0", Dst: "B:p1", Kind: KindUnicast, Size: 10}, true, "a-to-b"},
+		{Message{Src: "A:p0", Dst: "B:", Kind: KindBroadcast, Size: 10}, true, "a-to-b"},
+		{Message{Src: "A:p0", Dst: "B:", Kind: KindMulticast, Size: 10}, false, ""},
+		{Message{Src: "A:p0", Dst: "B:p1", Kind: KindUnicast, Size: 100}, false, "no-large"},
+		{Message{Src: "AB:p0", Dst: "B:p1", Kind: KindUnicast, Size: 10}, false, ""},
+		{Message{Src: "A:p0", Dst: "C:p0", Kind: KindUnicast, Size: 10}, true, "a-to-b"},
+		{Message{Src: "B:p0", Dst: "A:p0", Kind: KindUnicast, Size: 10}, false, ""},
+	} {
+		if d := e.Evaluate(&c.m); d.Allowed != c.allowed || d.Rule != c.rule {
+			t.Fatalf("message %+v expect allowed %v by %q, got %+v", c.m, c.allowed, c.rule, d)
+		}
+	}
+
+	//rate limit of each source peer
+	m0, m1 := &Message{Src: "B:p0", Dst: "C:p1"}, &Message{Src: "B:p1", Dst: "C:p1"}
+	if !e.Evaluate(m0).Allowed || !e.Evaluate(m0).Allowed || e.Evaluate(m0).Allowed {
+		t.Fatal("burst is not limited")
+	}
+	if !e.Evaluate(m1).Allowed {
+		t.Fatal("other source peer is limited")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if !e.Evaluate(m0).Allowed {
+		t.Fatal("tokens are not refilled")
+	}
+	if stats := e.Stats(); stats.Limited != 1 || stats.Rules != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	//dry run
+	p.DryRun = true
+	e.Set(p)
+	if d := e.Evaluate(&Message{Src: "B:p0", Dst: "A:p0"}); d.Allowed || !d.DryRun {
+		t.Fatalf("unexpected dry run decision %+v", d)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, data := range []string{
+		"default: drop",
+		"rules:\n  - action: block",
+		"rules:\n  - action: ratelimit",
+		"rules:\n  - action: deny\n    kinds: [anycast]",
+		"rules:\n  - action: deny\n    minSize: 10\n    maxSize: 5",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Fatalf("invalid policy %q is parsed", data)
+		}
+	}
+	p, err := Parse([]byte("rules:\n  - action: ratelimit\n    rate: 0.5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Default != ActionAllow || p.Rules[0].Burst != 1 || p.Rules[0].Name != "rule-0" {
+		t.Fatalf("unexpected defaults %+v %+v", p, p.Rules[0])
+	}
+	if NewEngine(nil).Evaluate(&Message{Src: "A:p0", Dst: "B:p0"}).Allowed != true {
+		t.Fatal("nil policy denies message")
+	}
+}
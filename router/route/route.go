@@ -20,6 +20,8 @@ package route
 
 import (
 	"errors"
+	"hash/fnv"
+	"sort"
 	"strings"
 
 	"math"
@@ -31,10 +33,17 @@ type Route struct {
 	sync.RWMutex
 	netTopologyChange bool
 	netTopology       *NetworkTopology
-	nextHop           map[string]string
+	nextHops          map[string][]string
+	costs             map[string]int
 	localNode         string
 }
 
+//Entry next hops and cost of reachable node, cost is the number of hops
+type Entry struct {
+	Cost     int      `json:"cost"`
+	NextHops []string `json:"nextHops"`
+}
+
 //NewRoute initialization
 func NewRoute(localNode string) *Route {
 	return &Route{
@@ -72,15 +81,54 @@ func (r *Route) UpdateNetworkTopology(link *Link) bool {
 
 //GetNextHop get next hop
 func (r *Route) GetNextHop(dstNode string) (string, error) {
+	hops, err := r.GetNextHops(dstNode)
+	if err != nil {
+		return "", err
+	}
+	return hops[0], nil
+}
+
+//GetNextHops get all equal-cost next hops
+func (r *Route) GetNextHops(dstNode string) ([]string, error) {
 	r.RLock()
 	defer r.RUnlock()
 	if r.netTopologyChange {
 		r.UpdateNextHop()
 	}
-	if r.nextHop[dstNode] == "" {
-		return "", errors.New("not find next-hop ")
+	if len(r.nextHops[dstNode]) == 0 {
+		return nil, errors.New("not find next-hop ")
 	}
-	return r.nextHop[dstNode], nil
+	return append([]string{}, r.nextHops[dstNode]...), nil
+}
+
+//GetFlowNextHops get equal-cost next hops ordered for the flow, the first one is the primary and the others are alternates for failover
+func (r *Route) GetFlowNextHops(dstNode, srcID, dstID string) ([]string, error) {
+	hops, err := r.GetNextHops(dstNode)
+	if err != nil {
+		return nil, err
+	}
+	h := fnv.New32a()
+	h.Write([]byte(srcID))
+	h.Write([]byte{0})
+	h.Write([]byte(dstID))
+	index := int(h.Sum32() % uint32(len(hops)))
+	return append(append([]string{}, hops[index:]...), hops[:index]...), nil
+}
+
+//GetRouteTable get next hops and costs of all reachable nodes
+func (r *Route) GetRouteTable() map[string]Entry {
+	r.RLock()
+	defer r.RUnlock()
+	if r.netTopologyChange {
+		r.UpdateNextHop()
+	}
+	table := make(map[string]Entry)
+	for node, hops := range r.nextHops {
+		if len(hops) > 0 {
+			table[node] = Entry{Cost: r.costs[node], NextHops: append([]string{}, hops...)}
+		}
+	}
+	return table
 }
 
 //GetNetworkTopology get Network Topology
@@ -104,12 +152,14 @@ const INFINITE = math.MaxInt64
 
 //dijkstra shortest path simplification algorithm, the same weight of adjacent nodes, the default is 1
 func (r *Route) dijkstra() {
+	r.nextHops = make(map[string][]string)
+	cost := make(map[string]int)
+	cost[r.localNode] = 0
+	r.costs = cost
+	//isolated node reaches nothing, routes of the lost links must not be kept
 	if r.netTopology.getLink(r.localNode) == nil {
 		return
 	}
-	r.nextHop = make(map[string]string)
-	cost := make(map[string]int)
-	cost[r.localNode] = 0
 
 	netTopology := r.netTopology.verifyNetWorkTopology(r.localNode)
 	tmpNetTopology := &NetworkTopology{}
@@ -148,25 +198,37 @@ func (r *Route) dijkstra() {
 		for _, tmpLink := range netTopology.list {
 			if strings.EqualFold(tmpLink.srcNode, tempNode) {
 				for _, dstNode := range tmpLink.dstNodes {
+					hops := []string{dstNode}
+					if tempNode != r.localNode {
+						hops = r.nextHops[tempNode]
+					}
 					if cost[tempNode]+1 < cost[dstNode] {
 						cost[dstNode] = cost[tempNode] + 1
-						if tempNode == r.localNode {
-							r.nextHop[dstNode] = dstNode
-						} else {
-							r.nextHop[dstNode] = r.getNextPath(tempNode)
-						}
+						r.nextHops[dstNode] = append([]string{}, hops...)
+					} else if cost[tempNode]+1 == cost[dstNode] {
+						r.nextHops[dstNode] = mergeHops(r.nextHops[dstNode], hops)
 					}
 				}
 			}
 		}
 
 	}
-	//logger.Infoln(" nextHop: ", r.nextHop)
+	//logger.Infoln(" nextHops: ", r.nextHops)
 }
 
-func (r *Route) getNextPath(node string) string {
-	if strings.EqualFold(node, r.nextHop[node]) {
-		return node
+func mergeHops(hops, others []string) []string {
+	for _, hop := range others {
+		exist := false
+		for _, h := range hops {
+			if h == hop {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			hops = append(hops, hop)
+		}
 	}
-	return r.getNextPath(r.nextHop[node])
+	sort.Strings(hops)
+	return hops
 }
@@ -52,7 +52,7 @@ func TestRoute(t *testing.T) {
 	if route.UpdateNetworkTopology(&Link{srcNode: "7", dstNodes: []string{"4"}}) {
 		route.UpdateNextHop()
 		printNetworkTopologyList(route.netTopology.list, t)
-		t.Log(route.nextHop)
+		t.Log(route.nextHops)
 		t.Log(route.GetNextHop("7"))
 
 	} else {
@@ -63,7 +63,7 @@ func TestRoute(t *testing.T) {
 	if route.UpdateNetworkTopology(&Link{srcNode: "7", dstNodes: []string{"4", "2"}}) {
 		route.UpdateNextHop()
 		printNetworkTopologyList(route.netTopology.list, t)
-		t.Log(route.nextHop)
+		t.Log(route.nextHops)
 		t.Log(route.GetNextHop("7"))
 	} else {
 		t.Log("not update network topology")
@@ -73,7 +73,7 @@ func TestRoute(t *testing.T) {
 	if route.UpdateNetworkTopology(&Link{srcNode: "7", dstNodes: []string{"6"}}) {
 		route.UpdateNextHop()
 		printNetworkTopologyList(route.netTopology.list, t)
-		t.Log(route.nextHop)
+		t.Log(route.nextHops)
 		t.Log(route.GetNextHop("7"))
 
 	} else {
@@ -84,7 +84,7 @@ func TestRoute(t *testing.T) {
 	if route.UpdateNetworkTopology(&Link{srcNode: "7", dstNodes: []string{"6"}}) {
 		route.UpdateNextHop()
 		printNetworkTopologyList(route.netTopology.list, t)
-		t.Log(route.nextHop)
+		t.Log(route.nextHops)
 		t.Log(route.GetNextHop("7"))
 
 	} else {
@@ -97,7 +97,7 @@ func TestRoute(t *testing.T) {
 	if route.UpdateNetworkTopology(&Link{srcNode: "7", dstNodes: []string{}}) {
 		route.UpdateNextHop()
 		printNetworkTopologyList(route.netTopology.list, t)
-		t.Log(route.nextHop)
+		t.Log(route.nextHops)
 		t.Log(route.GetNextHop("4"))
 
 	} else {
@@ -108,7 +108,7 @@ func TestRoute(t *testing.T) {
 	if route.UpdateNetworkTopology(&Link{srcNode: "7", dstNodes: []string{}}) {
 		route.UpdateNextHop()
 		printNetworkTopologyList(route.netTopology.list, t)
-		t.Log(route.nextHop)
+		t.Log(route.nextHops)
 	} else {
 		printNetworkTopologyList(route.netTopology.list, t)
 		t.Log("not update network topology")
@@ -116,3 +116,62 @@ func TestRoute(t *testing.T) {
 	}
 
 }
+
+func TestRouteEqualCostNextHops(t *testing.T) {
+	route := &Route{
+		netTopology: &NetworkTopology{
+			list: []*Link{
+				&Link{srcNode: "1", dstNodes: []string{"2", "3"}},
+				&Link{srcNode: "2", dstNodes: []string{"1", "4"}},
+				&Link{srcNode: "3", dstNodes: []string{"1", "4"}},
+				&Link{srcNode: "4", dstNodes: []string{"2", "3", "5"}},
+				&Link{srcNode: "5", dstNodes: []string{"4"}},
+			},
+		},
+		localNode: "1",
+	}
+	route.UpdateNextHop()
+
+	for _, dst := range []string{"4", "5"} {
+		hops, err := route.GetNextHops(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hops) != 2 || hops[0] != "2" || hops[1] != "3" {
+			t.Fatalf("next hops of %s, expect [2 3], got %v", dst, hops)
+		}
+	}
+	if hops, _ := route.GetNextHops("2"); len(hops) != 1 || hops[0] != "2" {
+		t.Fatalf("next hops of 2, expect [2], got %v", hops)
+	}
+	table := route.GetRouteTable()
+	if len(table) != 4 || table["2"].Cost != 1 || table["4"].Cost != 2 || table["5"].Cost != 3 || len(table["5"].NextHops) != 2 {
+		t.Fatalf("unexpected route table %v", table)
+	}
+
+	used := make(map[string]bool)
+	for i := 0; i < 32; i++ {
+		src := "chain:" + string(rune('a'+i))
+		hops, err := route.GetFlowNextHops("5", src, "chain:dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hops) != 2 || hops[0] == hops[1] {
+			t.Fatalf("flow next hops, expect 2 different hops, got %v", hops)
+		}
+		again, _ := route.GetFlowNextHops("5", src, "chain:dst")
+		if again[0] != hops[0] {
+			t.Fatalf("flow %s is not sticky, %v != %v", src, again, hops)
+		}
+		used[hops[0]] = true
+	}
+	if len(used) != 2 {
+		t.Fatalf("flows are not spread across next hops, %v", used)
+	}
+
+	//local node loses all links
+	route.UpdateNetworkTopology(NewNodeLink("1", nil))
+	if hops, err := route.GetNextHops("2"); err == nil || len(route.GetRouteTable()) != 0 {
+		t.Fatalf("isolated node keeps next hops %v", hops)
+	}
+}
@@ -21,11 +21,16 @@ package router
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"net"
+	"net/http"
+	"sort"
 	"time"
 
 	"sync"
+	"sync/atomic"
 
 	"strings"
 
@@ -36,7 +41,15 @@ import (
 	"github.com/bocheninc/msg-net/net/common"
 	"github.com/bocheninc/msg-net/net/p2p"
 	pb "github.com/bocheninc/msg-net/protos"
+	"github.com/bocheninc/msg-net/router/audit"
+	"github.com/bocheninc/msg-net/router/dedup"
+	"github.com/bocheninc/msg-net/router/member"
+	"github.com/bocheninc/msg-net/router/policy"
 	"github.com/bocheninc/msg-net/router/route"
+	"github.com/bocheninc/msg-net/router/store"
+	"github.com/bocheninc/msg-net/router/trace"
+	"github.com/bocheninc/msg-net/util"
+	"github.com/golang/protobuf/proto"
 )
 
 //NewRouter make new router struct
@@ -52,19 +65,58 @@ type Router struct {
 
 	handler    *Handler
 	server     *p2p.P2P
+	ctx        context.Context
 	cancelFunc context.CancelFunc
 	//ws         *sync.WaitGroup
 
+	area        string
+	areas       []string
 	connRouters map[string]net.Conn
 	routers     map[string]*pb.Router
 	rwRouters   sync.RWMutex
+	links       map[string]map[string][]string //router key -> area -> linked routers
+	rwLinks     sync.Mutex
 	allRouters  *route.Route
-	peers       map[string]net.Conn
+	peers       map[string]*localPeer //peer id -> peer attached to local router
+	peerEpoch   int64
+	peerVersion uint64
 	rwPeers     sync.RWMutex
+	rwSync      sync.Mutex //keeps deltas of local peer table in version order
+	resyncs     map[string]time.Time
+	rwResync    sync.Mutex
+	resyncing   int32
 	allPeers    *Peers
+	conflicts   int64
+	onConflict  func(*Conflict)
 
-	msgUnique map[string]time.Time
-	rwMsg     sync.RWMutex
+	partition   *partitionState
+	rwPartition sync.Mutex
+	onPartition func(*Partition)
+
+	members  *membership
+	onMember func(*member.Member)
+
+	summaries      *Summaries
+	summarized     map[string][]string //area -> chains summarized into it by local router
+	summaryVersion uint64
+	rwSummary      sync.Mutex
+	summarizing    int32
+
+	dedup *dedup.Filter
+
+	acl       *policy.Engine
+	aclLoaded bool
+
+	deadLetters *deadLetters
+	admin       *http.Server
+	tracer      *trace.Tracer
+	traceSample float64
+	audit       *audit.Log
+
+	store     *store.Store
+	discovery []string
+	draining  int32
+	reloads   chan chan struct{}
 
 	connKeepAlive map[net.Conn]time.Time
 	rwKeepAlive   sync.RWMutex
@@ -77,6 +129,8 @@ type Router struct {
 	durationNetworkRouters time.Duration
 	timerNetworkPeers      *time.Timer
 	durationNetworkPeers   time.Duration
+	durationDrain          time.Duration
+	rwTimeouts             sync.RWMutex //timeouts and discovery are reloaded while handlers read them
 }
 
 //IsRunning Running or not for supply services
@@ -95,6 +149,7 @@ func (r *Router) Start() {
 	r.server = p2p.NewP2P(r.address, func() common.IMsg {
 		return &pb.Message{}
 	}, r.handleMsg)
+	r.server.SetDisconnectHandle(r.handleDisconnect)
 
 	done := make(chan struct{})
 
@@ -118,57 +173,51 @@ func (r *Router) Start() {
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
+	r.ctx = ctx
+	r.reloads = make(chan chan struct{})
 	r.cancelFunc = cancel
 	//r.ws = &sync.WaitGroup{}
+	r.area, r.areas = loadAreas()
 	r.connRouters = make(map[string]net.Conn)
 	r.routers = make(map[string]*pb.Router)
+	r.links = make(map[string]map[string][]string)
 	r.allRouters = route.NewRoute(r.address)
-	r.peers = make(map[string]net.Conn)
+	r.peers = make(map[string]*localPeer)
+	r.peerEpoch = time.Now().UnixNano()
+	r.peerVersion = 0
+	r.resyncs = make(map[string]time.Time)
 	r.allPeers = NewPeers()
-	r.msgUnique = make(map[string]time.Time)
+	r.summaries = NewSummaries()
+	r.summarized = make(map[string][]string)
+	r.partition = newPartitionState()
+	r.dedup = dedup.NewFilter(r.loadDedup())
+	r.acl = policy.NewEngine(nil)
+	r.aclLoaded = false
+	r.loadPolicy()
+	r.loadDeadLetters()
+	r.loadTracer()
+	r.loadAudit()
+	r.startMembership(ctx)
+	r.startAdmin()
 	r.connKeepAlive = make(map[net.Conn]time.Time)
 	r.handler.fsm.Event("HELLO")
 
-	//keepalive timeout
-	r.durationKeepAlive = time.Second * 5
-	if d, err := time.ParseDuration(config.GetString("router.timeout.keepalive")); err == nil {
-		r.durationKeepAlive = d
-	} else {
-		logger.Warnf("failed to parse router.timeout.keepalive, set default timeout 5s --- %v", err)
-	}
-	r.timerKeepAlive = time.NewTimer(r.durationKeepAlive)
-	//routers timeout
-	r.durationRouters = time.Second * 5
-	if d, err := time.ParseDuration(config.GetString("router.timeout.routers")); err == nil {
-		r.durationRouters = d
-	} else {
-		logger.Warnf("failed to parse router.timeout.routers, set default timeout 5s --- %v", err)
-	}
-	r.timerRouters = time.NewTimer(r.durationRouters)
-	//network routers timeout
-	r.durationNetworkRouters = time.Second * 5
-	if d, err := time.ParseDuration(config.GetString("router.timeout.network.routers")); err == nil {
-		r.durationNetworkRouters = d
-	} else {
-		logger.Warnf("failed to parse router.timeout.network.routers, set default timeout 5s --- %v", err)
-	}
-	r.timerNetworkRouters = time.NewTimer(r.durationNetworkRouters)
-	//network peers timeout
-	r.durationNetworkPeers = time.Second * 5
-	if d, err := time.ParseDuration(config.GetString("router.timeout.network.peers")); err == nil {
-		r.durationNetworkPeers = d
-	} else {
-		logger.Warnf("failed to parse router.timeout.peers, set default timeout 5s --- %v", err)
-	}
-	r.timerNetworkPeers = time.NewTimer(r.durationNetworkPeers)
+	r.loadTimeouts()
+	r.timerKeepAlive = time.NewTimer(r.timeout(&r.durationKeepAlive))
+	r.timerRouters = time.NewTimer(r.timeout(&r.durationRouters))
+	r.timerNetworkRouters = time.NewTimer(r.timeout(&r.durationNetworkRouters))
+	r.timerNetworkPeers = time.NewTimer(r.timeout(&r.durationNetworkPeers))
 
 	//connect to discovery routers
-	addresses := config.GetStringSlice("router.discovery")
+	r.rwTimeouts.Lock()
+	r.discovery = config.GetStringSlice("router.discovery")
+	r.rwTimeouts.Unlock()
+	addresses := r.discoveries()
+	addresses = append(addresses, r.loadStore()...)
 	r.Discovery(addresses)
 
 	// r.ws.Add(1)
 	// defer r.ws.Done()
-	ticker := time.NewTicker(5 * time.Second)
 	for {
 		select {
 		case <-ctx.Done():
@@ -176,22 +225,25 @@ func (r *Router) Start() {
 			r.timerRouters.Stop()
 			r.timerNetworkPeers.Stop()
 			r.timerNetworkRouters.Stop()
-			ticker.Stop()
 			return
+		case done := <-r.reloads:
+			r.reload()
+			close(done)
 		case <-r.timerKeepAlive.C:
-			r.connKeepAliveUpdate(ctx, 2*r.durationKeepAlive)
+			r.connKeepAliveUpdate(ctx, 2*r.timeout(&r.durationKeepAlive))
 			r.broadcastMsg(&pb.Message{Type: pb.Message_KEEPALIVE})
-			r.timerKeepAlive.Reset(r.durationKeepAlive)
+			r.timerKeepAlive.Reset(r.timeout(&r.durationKeepAlive))
 		case <-r.timerRouters.C:
 			logger.Debugf("p2p information : %s", r.server.String())
 			logger.Infof("router information : %s", r.String())
 			r.broadcastRouters()
+			r.saveStore()
+			r.checkPartition()
 		case <-r.timerNetworkPeers.C:
-			r.broadcastNetworkPeers()
+			r.broadcastPeerDigest()
+			r.broadcastSummaries(true)
 		case <-r.timerNetworkRouters.C:
-			r.broadcastNetworkPeers()
-		case <-ticker.C:
-			r.msgUniqueUpdate(5 * time.Second)
+			r.broadcastPeerDigest()
 		}
 	}
 }
@@ -206,6 +258,7 @@ func (r *Router) Stop() {
 	router := &pb.Router{Id: r.id, Address: r.address}
 	bytes, _ := router.Serialize()
 	msg := &pb.Message{Type: pb.Message_ROUTER_CLOSE, Payload: bytes}
+	r.stopMembership()
 	r.broadcastMsg(msg)
 
 	r.server.Stop()
@@ -213,6 +266,195 @@ func (r *Router) Stop() {
 
 	r.cancelFunc()
 	//r.ws.Wait()
+	r.stopAdmin()
+	r.closeDeadLetters()
+	r.closeTracer()
+	r.closeAudit()
+
+	if r.store != nil {
+		r.saveStore()
+		r.store.Close()
+	}
+}
+
+//Reload applies reloaded timeouts and dials newly added discovery routers, established connections are kept.
+//It is called from the config watcher, the reload is applied by the loop of Start which owns the timers
+func (r *Router) Reload() {
+	if !r.IsRunning() {
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case r.reloads <- done:
+	case <-r.ctx.Done():
+		return
+	}
+	select {
+	case <-done:
+	case <-r.ctx.Done():
+	}
+}
+
+func (r *Router) reload() {
+	r.loadTimeouts()
+	r.dedup.Resize(r.loadDedup())
+	r.loadPolicy()
+	r.rwTimeouts.RLock()
+	for timer, duration := range map[*time.Timer]time.Duration{
+		r.timerKeepAlive:      r.durationKeepAlive,
+		r.timerRouters:        r.durationRouters,
+		r.timerNetworkRouters: r.durationNetworkRouters,
+		r.timerNetworkPeers:   r.durationNetworkPeers,
+	} {
+		timer.Stop()
+		timer.Reset(duration)
+	}
+	r.rwTimeouts.RUnlock()
+
+	discovery := config.GetStringSlice("router.discovery")
+	addresses := []string{}
+	r.rwTimeouts.Lock()
+	for _, address := range discovery {
+		if !util.IsStrExist(address, r.discovery) {
+			addresses = append(addresses, address)
+		}
+	}
+	r.discovery = discovery
+	logger.Infof("router %s reloaded, timeout keepalive %s routers %s network routers %s network peers %s, new discovery %v",
+		r.address, r.durationKeepAlive, r.durationRouters, r.durationNetworkRouters, r.durationNetworkPeers, addresses)
+	r.rwTimeouts.Unlock()
+	if len(addresses) > 0 {
+		go r.Discovery(addresses)
+	}
+}
+
+//timeout returns duration d of the router, timeouts are reloaded by the loop of Start
+func (r *Router) timeout(d *time.Duration) time.Duration {
+	r.rwTimeouts.RLock()
+	defer r.rwTimeouts.RUnlock()
+	return *d
+}
+
+//discoveries returns a copy of discovery routers
+func (r *Router) discoveries() []string {
+	r.rwTimeouts.RLock()
+	defer r.rwTimeouts.RUnlock()
+	return append([]string{}, r.discovery...)
+}
+
+func (r *Router) loadTimeouts() {
+	r.rwTimeouts.Lock()
+	defer r.rwTimeouts.Unlock()
+	//keepalive timeout
+	r.durationKeepAlive = time.Second * 5
+	if d, err := time.ParseDuration(config.GetString("router.timeout.keepalive")); err == nil {
+		r.durationKeepAlive = d
+	} else {
+		logger.Warnf("failed to parse router.timeout.keepalive, set default timeout 5s --- %v", err)
+	}
+	//routers timeout
+	r.durationRouters = time.Second * 5
+	if d, err := time.ParseDuration(config.GetString("router.timeout.routers")); err == nil {
+		r.durationRouters = d
+	} else {
+		logger.Warnf("failed to parse router.timeout.routers, set default timeout 5s --- %v", err)
+	}
+	//network routers timeout
+	r.durationNetworkRouters = time.Second * 5
+	if d, err := time.ParseDuration(config.GetString("router.timeout.network.routers")); err == nil {
+		r.durationNetworkRouters = d
+	} else {
+		logger.Warnf("failed to parse router.timeout.network.routers, set default timeout 5s --- %v", err)
+	}
+	//network peers timeout
+	r.durationNetworkPeers = time.Second * 5
+	if d, err := time.ParseDuration(config.GetString("router.timeout.network.peers")); err == nil {
+		r.durationNetworkPeers = d
+	} else {
+		logger.Warnf("failed to parse router.timeout.peers, set default timeout 5s --- %v", err)
+	}
+	//drain timeout
+	r.durationDrain = time.Second * 30
+	if d, err := time.ParseDuration(config.GetString("router.timeout.drain")); err == nil {
+		r.durationDrain = d
+	} else {
+		logger.Warnf("failed to parse router.timeout.drain, set default timeout 30s --- %v", err)
+	}
+}
+
+//loadDedup loads size and window of flooded msg deduplication
+func (r *Router) loadDedup() (int, time.Duration) {
+	size := config.GetInt("router.dedup.size")
+	if size <= 0 {
+		size = 65536
+	}
+	window := time.Second * 5
+	if d, err := time.ParseDuration(config.GetString("router.dedup.window")); err == nil && d > 0 {
+		window = d
+	} else {
+		logger.Warnf("failed to parse router.dedup.window, set default window 5s --- %v", err)
+	}
+	return size, window
+}
+
+//Drain stops accepting peers, asks attached peers to migrate to other routers, withdraws routes,
+//flushes outbound queues and stops the router, the router is stopped within the drain timeout.
+//Draining again stops the router immediately.
+func (r *Router) Drain() {
+	if !r.IsRunning() {
+		logger.Warnf("router %s is already stopped.", r.address)
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&r.draining, 0, 1) {
+		logger.Warnf("router %s is already draining, stop immediately.", r.address)
+		r.Stop()
+		return
+	}
+
+	deadline := time.Now().Add(r.timeout(&r.durationDrain))
+	logger.Infof("router %s start draining, deadline %s", r.address, deadline.Format("2006-01-02 15:04:05"))
+	//withdraw routes through this router
+	r.broadcastNetworkRouters()
+	r.broadcastNetworkPeers()
+
+	msg := r.migrateMsg()
+	r.peerIterFunc(func(peer *pb.Peer, conn net.Conn) {
+		(&common.Handler{}).Send(conn, msg)
+	})
+	r.waitDrain(deadline, func() bool {
+		r.rwPeers.RLock()
+		defer r.rwPeers.RUnlock()
+		return len(r.peers) == 0
+	})
+	r.waitDrain(deadline, func() bool {
+		return r.server.Pending() == 0
+	})
+
+	if r.ctx.Err() == nil {
+		r.Stop()
+	}
+	logger.Infof("router %s drained", r.address)
+}
+
+func (r *Router) isDraining() bool {
+	return atomic.LoadInt32(&r.draining) == 1
+}
+
+//waitDrain waits until function returns true, deadline is reached or router is stopped
+func (r *Router) waitDrain(deadline time.Time, function func() bool) {
+	for !function() && time.Now().Before(deadline) && r.ctx.Err() == nil {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+//migrateMsg makes message that tells peers the routers to migrate
+func (r *Router) migrateMsg() *pb.Message {
+	routers := &pb.Routers{Id: r.address}
+	r.routerIterFunc(func(address string, router *pb.Router) {
+		routers.Routers = append(routers.Routers, &pb.Router{Id: router.Id, Address: router.Address})
+	})
+	bytes, _ := routers.Serialize()
+	return &pb.Message{Type: pb.Message_PEER_MIGRATE, Payload: bytes}
 }
 
 //Discovery discoveries other router and connects them
@@ -225,69 +467,192 @@ func (r *Router) Discovery(addresses []string) {
 		if r.routerExist(address) {
 			continue
 		}
-		if conn := r.server.Connect(address); conn != nil {
-			//send hello messge
-			router := &pb.Router{Id: r.id, Address: r.address}
-			payload, _ := router.Serialize()
-			msg := &pb.Message{Type: pb.Message_ROUTER_HELLO, Payload: payload}
-			(&common.Handler{}).Send(conn, msg)
-		} else {
+		if !r.connectRouter(address) {
 			unDiscovery = append(unDiscovery, address)
 		}
 	}
 	if len(unDiscovery) > 0 {
-		time.AfterFunc(r.durationKeepAlive, func() {
+		time.AfterFunc(r.timeout(&r.durationKeepAlive), func() {
 			r.Discovery(unDiscovery)
 		})
 	}
 }
 
-//RouteMessage router message
-func (r *Router) RouteMessage(msg *pb.Message) error {
+//connectRouter connects to router of address and says hello, it returns false if the router is not reachable
+func (r *Router) connectRouter(address string) bool {
+	conn := r.server.Connect(address)
+	if conn == nil {
+		return false
+	}
+	//send hello messge
+	payload, _ := r.routerSelf().Serialize()
+	msg := &pb.Message{Type: pb.Message_ROUTER_HELLO, Payload: payload}
+	(&common.Handler{}).Send(conn, msg)
+	return true
+}
+
+//RouteMessage router message, undeliverable message is reported to its source peer as dead letter
+func (r *Router) RouteMessage(msg *pb.Message, conn net.Conn) error {
+	//msg enters the mesh from a peer attached to local router, metadata set by the peer is dropped
+	//so it can not pass as forwarded by routers
+	peer := r.isPeer(conn)
+	ingress := peer != nil
+	if ingress {
+		msg.Metadata = nil
+	} else if !r.isRouterConn(conn) {
+		return fmt.Errorf("router %s refuses chain message from %s, neither peer nor router", r.address, conn.RemoteAddr())
+	}
 	if bytes.Contains(msg.Metadata, []byte(r.address)) {
 		return nil
 	}
+	received := time.Now()
 	msg.Metadata = append(msg.Metadata, []byte(r.address)...)
 
 	chainMsg := &pb.ChainMessage{}
 	if err := chainMsg.Deserialize(msg.Payload); err != nil {
 		return err
 	}
+	if peer != nil && chainMsg.SrcId != peer.Id {
+		logger.Warnf("router %s refuses message %s of source %s from peer %s", r.address, chainMsg.Id, chainMsg.SrcId, peer.Id)
+		r.auditMsg(chainMsg, audit.DecisionDrop, "source is not peer "+peer.Id, "")
+		return fmt.Errorf("peer %s sent message %s of source %s", peer.Id, chainMsg.Id, chainMsg.SrcId)
+	}
+	span := r.traceMsg(chainMsg, ingress, received)
+	defer span.Finish()
+	drop := func(s *trace.Span, reason pb.DeadLetter_Reason, detail string) {
+		s.SetError(reason.String() + ": " + detail)
+		r.auditMsg(chainMsg, audit.DecisionDrop, reason.String(), "")
+		r.deadLetter(msg.Payload, chainMsg, reason, detail, true)
+	}
+	//failures of some route keys are reported to the source only if no key is delivered
+	type failure struct {
+		reason pb.DeadLetter_Reason
+		detail string
+	}
+	failures, delivered := []failure{}, false
+	fail := func(s *trace.Span, reason pb.DeadLetter_Reason, detail string) {
+		s.SetError(reason.String() + ": " + detail)
+		r.auditMsg(chainMsg, audit.DecisionDrop, reason.String(), "")
+		failures = append(failures, failure{reason: reason, detail: detail})
+	}
+
+	decision := span.Child("route", trace.KindInternal)
+	if ingress {
+		if ok, detail := r.admitMsg(chainMsg); !ok {
+			drop(decision, pb.DeadLetter_ACL_DENIED, detail)
+			decision.Finish()
+			return nil
+		}
+	}
+	if chainMsg.Expires != 0 && time.Now().UnixNano() > chainMsg.Expires {
+		drop(decision, pb.DeadLetter_TTL_EXPIRED, "expired at "+time.Unix(0, chainMsg.Expires).Format(time.RFC3339Nano))
+		decision.Finish()
+		return nil
+	}
+	//metadata grows on each hop, the next one would refuse the message
+	if size := proto.Size(msg); uint64(size) > common.MaxMsgSize() {
+		drop(decision, pb.DeadLetter_TOO_LARGE, fmt.Sprintf("%d bytes exceeds %d", size, common.MaxMsgSize()))
+		decision.Finish()
+		return nil
+	}
 
 	dstID := chainMsg.DstId
-	logger.Debugf("router %s route message %s to dstID %s", r.address, chainMsg.SrcId, dstID)
-	keys := r.allPeers.GetKeys(dstID)
+	selector, err := pb.ParseSelector(chainMsg.Selector)
+	if err != nil {
+		logger.Errorf("router %s route message %s to dstID %s failed --- %v", r.address, chainMsg.SrcId, dstID, err)
+		decision.SetError(err.Error())
+		decision.Finish()
+		return nil
+	}
+	logger.Debugf("router %s route message %s to dstID %s selector %s trace %s", r.address, chainMsg.SrcId, dstID, selector, chainMsg.TraceId)
+	keys := r.routeKeys(dstID, selector)
+	decision.SetAttr("msgnet.route.keys", strings.Join(keys, ","))
 	if len(keys) == 0 {
-		logger.Errorf("router %s route message  %s to dstID %s failed ", r.address, chainMsg.SrcId, dstID)
+		drop(decision, pb.DeadLetter_NO_ROUTE, "no peer matches destination")
 	}
+	decision.Finish()
 	for _, key := range keys {
+		forward := span.Child("forward", trace.KindClient)
+		out := r.tracedMsg(msg, chainMsg, forward)
 		if key == r.address {
+			peers, failed := []string{}, []string{}
 			r.peerIterFunc(func(peer *pb.Peer, conn net.Conn) {
-				if (strings.HasSuffix(dstID, ":") && strings.HasPrefix(peer.Id, dstID)) || peer.Id == dstID {
+				if peer.MatchID(dstID) && selector.Matches(peer) {
+					if _, err := (&common.Handler{}).Send(conn, out); err != nil {
+						failed = append(failed, peer.Id+" --- "+err.Error())
+						return
+					}
+					peers = append(peers, peer.Id)
+					r.auditMsg(chainMsg, audit.DecisionDeliver, "", peer.Id)
 					logger.Debugf("router %s route message %s to dstID %s (%s) successfully", r.address, chainMsg.SrcId, dstID, peer.Id)
-					(&common.Handler{}).Send(conn, msg)
 				}
 			})
+			//failures are not reported under the lock of peers, the dead letter may be routed to a source attached here
+			for _, detail := range failed {
+				fail(forward, pb.DeadLetter_DELIVERY_FAILED, "router "+key+" peer "+detail)
+			}
+			delivered = delivered || len(peers) > 0
+			forward.SetAttr("msgnet.peers", strings.Join(peers, ","))
 		} else {
-			nextKey, err := r.allRouters.GetNextHop(key)
-			if err != nil {
-				logger.Warnf("get next hop err: %s ", err)
+			forward.SetAttr("msgnet.route.key", key)
+			nextKeys, err := r.allRouters.GetFlowNextHops(key, chainMsg.SrcId, dstID)
+			if err != nil && r.isUnreachable(key) {
+				fail(forward, pb.DeadLetter_NO_ROUTE, "router "+key+" is unreachable, the mesh is partitioned")
+			} else if err != nil {
+				fail(forward, pb.DeadLetter_NO_ROUTE, "no next hop to router "+key)
+			} else if next := r.sendToNextHops(nextKeys, out); next == "" {
+				fail(forward, pb.DeadLetter_NO_ROUTE, fmt.Sprintf("next hops %v to router %s unavailable", nextKeys, key))
 			} else {
-				logger.Debugf("router %s route message %s to dstID %s in next %s", r.address, chainMsg.SrcId, dstID, nextKey)
-
-				r.rwRouters.RLock()
-				if conn, ok := r.connRouters[nextKey]; ok {
-					(&common.Handler{}).Send(conn, msg)
-				}
-				r.rwRouters.RUnlock()
+				delivered = true
+				forward.SetAttr("msgnet.next_hop", next)
+				r.auditMsg(chainMsg, audit.DecisionForward, "", next)
 			}
 
 		}
+		forward.Finish()
 
 	}
+	for _, f := range failures {
+		r.deadLetter(msg.Payload, chainMsg, f.reason, f.detail, !delivered)
+	}
 	return nil
 }
 
+//routeKeys gets keys of routers attached by peers matching id and selector, chains of other areas are reached
+//through the border routers summarizing them
+func (r *Router) routeKeys(id string, selector pb.Selector) []string {
+	keys := r.allPeers.GetKeysBySelector(id, selector)
+	for _, key := range r.summaries.Keys(id, r.summaryExpire()) {
+		if key != r.address && !util.IsStrExist(key, keys) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+//sendToNextHops sends msg to the first reachable next hop, the others are tried in order when sending fails.
+//It returns the next hop sent to, empty if all are unavailable
+func (r *Router) sendToNextHops(nextKeys []string, msg *pb.Message) string {
+	for _, nextKey := range nextKeys {
+		r.rwRouters.RLock()
+		conn, ok := r.connRouters[nextKey]
+		r.rwRouters.RUnlock()
+		if !ok {
+			logger.Warnf("router %s next hop %s not connected, try alternate", r.address, nextKey)
+			continue
+		}
+		if _, err := (&common.Handler{}).Send(conn, msg); err != nil {
+			logger.Warnf("router %s failed to send to next hop %s, try alternate --- %v", r.address, nextKey, err)
+			r.handleDisconnect(conn, err)
+			r.server.Disconnect(conn)
+			continue
+		}
+		logger.Debugf("router %s route message in next %s", r.address, nextKey)
+		return nextKey
+	}
+	return ""
+}
+
 func (r *Router) handleMsg(conn net.Conn, channel chan<- common.IMsg, msg common.IMsg) error {
 	r.connKeepAliveAdd(conn, false)
 	return r.handler.HandleMsg(conn, channel, msg)
@@ -298,6 +663,7 @@ func (r *Router) String() string {
 	m := make(map[string]interface{})
 	m["id"] = r.id
 	m["address"] = r.address
+	m["areas"] = r.areas
 
 	f := make([]interface{}, 0)
 	r.routerIterFunc(func(address string, router *pb.Router) {
@@ -312,6 +678,21 @@ func (r *Router) String() string {
 	})
 	m["peers"] = v
 	m["peers_cnt"] = len(v)
+	m["conflicts"] = atomic.LoadInt64(&r.conflicts)
+	m["dedup"] = r.dedup.Stats()
+	m["summaries"] = r.summaries.Len()
+	m["policy"] = r.acl.Stats()
+	m["deadletters"] = r.deadLetterStats()
+	m["partition"] = r.PartitionStats()
+	if r.members != nil {
+		m["members"] = r.members.list.Stats()
+	}
+	if r.tracer != nil {
+		m["trace"] = r.tracer.Stats()
+	}
+	if r.audit != nil {
+		m["audit"], _ = r.audit.Head()
+	}
 
 	bytes, err := json.Marshal(m)
 	if err != nil {
@@ -322,6 +703,7 @@ func (r *Router) String() string {
 
 func (r *Router) routerAdd(key string, router *pb.Router, conn net.Conn) {
 	logger.Infoln("add new router :", key)
+	r.seeRouter(router.Id, key)
 	r.rwRouters.Lock()
 
 	r.routers[key] = router
@@ -329,6 +711,7 @@ func (r *Router) routerAdd(key string, router *pb.Router, conn net.Conn) {
 
 	r.rwRouters.Unlock()
 
+	r.joinMember(key, router.Id)
 	r.broadcastNetworkRouters()
 }
 
@@ -360,6 +743,18 @@ func (r *Router) routerConnIterFunc(function func(string, net.Conn)) {
 	}
 }
 
+//isRouterConn returns true if conn links local router to another router
+func (r *Router) isRouterConn(conn net.Conn) bool {
+	r.rwRouters.RLock()
+	defer r.rwRouters.RUnlock()
+	for _, c := range r.connRouters {
+		if c == conn {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Router) routerExist(key string) bool {
 	if key == "" {
 		return false
@@ -371,73 +766,65 @@ func (r *Router) routerExist(key string) bool {
 }
 
 func (r *Router) peerAdd(peer *pb.Peer, conn net.Conn) {
-	r.rwPeers.Lock()
-
-	bytes, _ := json.Marshal(peer)
-	r.peers[string(bytes)] = conn
-
-	r.rwPeers.Unlock()
-
-	r.broadcastNetworkPeers()
+	r.peerUpdate(func(peers map[string]*localPeer) ([]*pb.Peer, []string) {
+		peers[peer.Id] = &localPeer{peer: peer, conn: conn}
+		return []*pb.Peer{peer}, nil
+	})
 }
 
-func (r *Router) peerRemove(peer *pb.Peer) {
-	r.rwPeers.Lock()
-
-	bytes, _ := json.Marshal(peer)
-	delete(r.peers, string(bytes))
-
-	r.rwPeers.Unlock()
+//peerRemove removes peer attached by conn
+func (r *Router) peerRemove(conn net.Conn) {
+	r.peerUpdate(func(peers map[string]*localPeer) ([]*pb.Peer, []string) {
+		removed := []string{}
+		for id, lp := range peers {
+			if lp.conn == conn {
+				delete(peers, id)
+				removed = append(removed, id)
+			}
+		}
+		return nil, removed
+	})
+}
 
-	r.broadcastNetworkPeers()
+//peerGet gets peer attached to local router by id
+func (r *Router) peerGet(id string) *localPeer {
+	r.rwPeers.RLock()
+	defer r.rwPeers.RUnlock()
+	return r.peers[id]
 }
 
 func (r *Router) peerIterFunc(function func(*pb.Peer, net.Conn)) {
 	r.rwPeers.RLock()
 	defer r.rwPeers.RUnlock()
-	for key, conn := range r.peers {
-		peer := &pb.Peer{}
-		json.Unmarshal([]byte(key), peer)
-		function(peer, conn)
+	for _, lp := range r.peers {
+		function(lp.peer, lp.conn)
 	}
 }
 
 func (r *Router) isPeer(conn net.Conn) *pb.Peer {
+	if conn == nil {
+		return nil
+	}
 	r.rwPeers.RLock()
 	defer r.rwPeers.RUnlock()
-	for key, tconn := range r.peers {
-		if tconn == conn {
-			peer := &pb.Peer{}
-			json.Unmarshal([]byte(key), peer)
-			return peer
+	for _, lp := range r.peers {
+		if lp.conn == conn {
+			return lp.peer
 		}
 	}
 	return nil
 }
 
+//msgUniqueAdd records digest of flooded msg, returns false if it is seen within the dedup window
 func (r *Router) msgUniqueAdd(msg *pb.Message) bool {
-	r.rwMsg.Lock()
-	defer r.rwMsg.Unlock()
-	bytes, _ := json.Marshal(msg)
-	if _, ok := r.msgUnique[string(bytes)]; ok {
-		return false
-	}
-	r.msgUnique[string(bytes)] = time.Now()
-	return true
+	var t [4]byte
+	binary.BigEndian.PutUint32(t[:], uint32(msg.Type))
+	return r.dedup.Add(dedup.Sum(t[:], msg.Metadata, msg.Payload))
 }
 
-func (r *Router) msgUniqueUpdate(duration time.Duration) {
-	r.rwMsg.Lock()
-	defer r.rwMsg.Unlock()
-	keys := []string{}
-	for key, t := range r.msgUnique {
-		if time.Now().Sub(t) > duration {
-			keys = append(keys, key)
-		}
-	}
-	for _, key := range keys {
-		delete(r.msgUnique, key)
-	}
+//DedupStats returns counters of flooded msg deduplication
+func (r *Router) DedupStats() dedup.Stats {
+	return r.dedup.Stats()
 }
 
 func (r *Router) connKeepAliveAdd(conn net.Conn, first bool) {
@@ -467,94 +854,114 @@ func (r *Router) connKeepAliveUpdate(ctx context.Context, duration time.Duration
 	}
 	for _, conn := range conns {
 		if peer := r.isPeer(conn); peer != nil {
-			r.peerRemove(peer)
+			r.peerRemove(conn)
 		} else {
-			var key string
-			r.routerConnIterFunc(func(tkey string, tconn net.Conn) {
-				if conn == tconn {
-					key = tkey
-				}
-			})
-
+			key := r.routerKey(conn)
 			if key != "" {
 				r.routerRemove(key)
 			}
-			localAddr := conn.LocalAddr().String()
-			remoteAddr := conn.RemoteAddr().String()
-			if strings.Split(localAddr, ":")[1] != strings.Split(r.address, ":")[1] {
-				go func(localAddr, remoteAddr string) {
-					ctx0, cancel0 := context.WithCancel(ctx)
-					_ = cancel0
-					duration := time.Second * 5
-					if d, err := time.ParseDuration(config.GetString("router.reconnect.interval")); err == nil {
-						duration = d
-					}
-					for {
-						select {
-						case <-ctx0.Done():
-							return
-						default:
-						}
-						logger.Warnf("connection %s -> %s timeout， reconnecting key %s..", localAddr, remoteAddr, key)
-						if r.routerExist(r.address) {
-							break
-						}
-						if conn := r.server.Connect(remoteAddr); conn != nil {
-							//发送HELLO消息
-							router := &pb.Router{Id: r.id, Address: r.address}
-							payload, _ := router.Serialize()
-							(&common.Handler{}).Send(conn, &pb.Message{Type: pb.Message_ROUTER_HELLO, Payload: payload})
-							break
-						}
-						time.Sleep(duration)
-					}
-				}(localAddr, remoteAddr)
-			}
+			r.reconnect(ctx, conn, key)
 		}
 		delete(r.connKeepAlive, conn)
 		r.server.Disconnect(conn)
 	}
 }
 
+//handleDisconnect handles link failure reported by tcp layer, routes are recomputed and flooded immediately
+func (r *Router) handleDisconnect(conn net.Conn, err error) {
+	if !r.IsRunning() || r.ctx.Err() != nil {
+		return
+	}
+	logger.Warnf("router %s link %s -> %s failed --- %v", r.address, conn.LocalAddr().String(), conn.RemoteAddr().String(), err)
+	r.connKeepAliveRemove(conn)
+	if peer := r.isPeer(conn); peer != nil {
+		r.peerRemove(conn)
+		return
+	}
+	key := r.routerKey(conn)
+	if key == "" {
+		return
+	}
+	//routerRemove updates local topology and floods ROUTER_SYNC
+	r.routerRemove(key)
+	r.reconnect(r.ctx, conn, key)
+}
+
+func (r *Router) routerKey(conn net.Conn) string {
+	var key string
+	r.routerConnIterFunc(func(tkey string, tconn net.Conn) {
+		if conn == tconn {
+			key = tkey
+		}
+	})
+	return key
+}
+
+//reconnect reconnects to router if the connection is dialed by local
+func (r *Router) reconnect(ctx context.Context, conn net.Conn, key string) {
+	localAddr := conn.LocalAddr().String()
+	remoteAddr := conn.RemoteAddr().String()
+	if strings.Split(localAddr, ":")[1] == strings.Split(r.address, ":")[1] {
+		return
+	}
+	go func(localAddr, remoteAddr string) {
+		ctx0, cancel0 := context.WithCancel(ctx)
+		_ = cancel0
+		duration := time.Second * 5
+		if d, err := time.ParseDuration(config.GetString("router.reconnect.interval")); err == nil {
+			duration = d
+		}
+		for {
+			select {
+			case <-ctx0.Done():
+				return
+			default:
+			}
+			logger.Warnf("connection %s -> %s timeout， reconnecting key %s..", localAddr, remoteAddr, key)
+			if r.routerExist(r.address) {
+				break
+			}
+			if conn := r.server.Connect(remoteAddr); conn != nil {
+				//发送HELLO消息
+				payload, _ := r.routerSelf().Serialize()
+				(&common.Handler{}).Send(conn, &pb.Message{Type: pb.Message_ROUTER_HELLO, Payload: payload})
+				break
+			}
+			time.Sleep(duration)
+		}
+	}(localAddr, remoteAddr)
+}
+
 func (r *Router) broadcastRouters() {
 	r.timerRouters.Stop()
 	msg := &pb.Message{Type: pb.Message_ROUTER_GET, Payload: nil}
 	r.broadcastMsg(msg)
-	r.timerRouters.Reset(r.durationRouters)
+	r.timerRouters.Reset(r.timeout(&r.durationRouters))
 }
 
+//broadcastNetworkRouters floods links of local router into each of its areas, only links within the area are flooded
 func (r *Router) broadcastNetworkRouters() {
 	r.timerNetworkRouters.Stop()
-	routers := &pb.Routers{}
-	routers.Id = r.address
-	r.routerIterFunc(func(address string, router *pb.Router) {
-		routers.Routers = append(routers.Routers, router)
-	})
-	bytes, _ := routers.Serialize()
-	msg := &pb.Message{Type: pb.Message_ROUTER_SYNC, Payload: bytes}
-	msg.Metadata = append(msg.Metadata, []byte(time.Now().String()+":"+r.address)...)
-
-	r.updateRouters(routers.Id, routers.Routers)
-	r.msgUniqueAdd(msg)
-	r.broadcastMsg(msg)
-	r.timerNetworkRouters.Reset(r.durationNetworkRouters)
-}
-
-func (r *Router) broadcastNetworkPeers() {
-	r.timerNetworkPeers.Stop()
-	peers := &pb.Peers{}
-	peers.Id = r.address
-	r.peerIterFunc(func(peer *pb.Peer, conn net.Conn) {
-		peers.Peers = append(peers.Peers, &pb.Peer{Id: peer.Id})
-	})
-	bytes, _ := peers.Serialize()
-	msg := &pb.Message{Type: pb.Message_PEER_SYNC, Payload: bytes}
-	msg.Metadata = append(msg.Metadata, []byte(time.Now().String()+":"+r.address)...)
+	for _, area := range r.areas {
+		routers := &pb.Routers{}
+		routers.Id = r.address
+		routers.Area = area
+		if !r.isDraining() {
+			r.routerIterFunc(func(address string, router *pb.Router) {
+				if util.IsStrExist(area, routerAreas(router)) {
+					routers.Routers = append(routers.Routers, router)
+				}
+			})
+		}
+		bytes, _ := routers.Serialize()
+		msg := &pb.Message{Type: pb.Message_ROUTER_SYNC, Payload: bytes}
+		msg.Metadata = append(msg.Metadata, []byte(time.Now().String()+":"+r.address)...)
 
-	r.updatePeers(peers.Id, peers.Peers)
-	r.msgUniqueAdd(msg)
-	r.broadcastMsg(msg)
-	r.timerNetworkPeers.Reset(r.durationNetworkPeers)
+		r.updateRouters(routers.Id, routers.Area, routers.Routers)
+		r.msgUniqueAdd(msg)
+		r.broadcastArea(msg, area)
+	}
+	r.timerNetworkRouters.Reset(r.timeout(&r.durationNetworkRouters))
 }
 
 func (r *Router) broadcastMsg(msg *pb.Message) {
@@ -568,16 +975,88 @@ func (r *Router) broadcastMsg(msg *pb.Message) {
 	})
 }
 
-func (r *Router) updatePeers(key string, peers []*pb.Peer) {
-	r.allPeers.Update(key, peers)
+//updateRouters updates links of router in area, the route is computed over links of all areas of local router
+func (r *Router) updateRouters(key, area string, routers []*pb.Router) {
+	r.rwLinks.Lock()
+	if _, ok := r.links[key]; !ok {
+		r.links[key] = make(map[string][]string)
+	}
+	r.links[key][area] = nil
+	for _, router := range routers {
+		r.links[key][area] = append(r.links[key][area], router.Address)
+		r.seeRouter(router.Id, router.Address)
+	}
+	addresses := []string{}
+	for _, dsts := range r.links[key] {
+		for _, address := range dsts {
+			if !util.IsStrExist(address, addresses) {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	r.rwLinks.Unlock()
+	sort.Strings(addresses)
+	r.seeRouter("", key)
+	if r.allRouters.UpdateNetworkTopology(route.NewNodeLink(key, addresses)) {
+		r.allRouters.UpdateNextHop()
+	}
 }
 
-func (r *Router) updateRouters(key string, routers []*pb.Router) {
+//loadStore opens local state store and restores topology, returns addresses of routers known before restart
+func (r *Router) loadStore() []string {
+	path := config.GetString("router.store.path")
+	if path == "" {
+		return nil
+	}
+	s, err := store.NewStore(path)
+	if err != nil {
+		logger.Errorf("failed to open router store %s --- %v", path, err)
+		return nil
+	}
+	r.store = s
+
+	//local links are rebuilt from live connections
+	for src, dsts := range s.Topology() {
+		if src == r.address {
+			continue
+		}
+		r.allRouters.UpdateNetworkTopology(route.NewNodeLink(src, dsts))
+	}
+
 	addresses := []string{}
-	for _, router := range routers {
+	for _, router := range s.Routers(storeExpire()) {
 		addresses = append(addresses, router.Address)
 	}
-	if r.allRouters.UpdateNetworkTopology(route.NewNodeLink(key, addresses)) {
-		r.allRouters.UpdateNextHop()
+	logger.Infof("router %s restored %d routers from store %s", r.address, len(addresses), path)
+	return addresses
+}
+
+//storeExpire routers not seen longer are forgotten
+func storeExpire() time.Duration {
+	if d, err := time.ParseDuration(config.GetString("router.store.expire")); err == nil {
+		return d
+	}
+	return time.Hour * 24
+}
+
+func (r *Router) saveStore() {
+	if r.store == nil {
+		return
+	}
+	topology := make(map[string][]string)
+	for _, link := range r.allRouters.GetNetworkTopology() {
+		topology[link.GetSrcNode()] = link.GetDstNodes()
+	}
+	if err := r.store.SaveTopology(topology); err != nil {
+		logger.Warnf("failed to save topology to store --- %v", err)
+	}
+}
+
+func (r *Router) seeRouter(id, address string) {
+	if r.store == nil || address == r.address {
+		return
+	}
+	if err := r.store.SeeRouter(id, address, time.Now()); err != nil {
+		logger.Warnf("failed to save router %s to store --- %v", address, err)
 	}
 }
@@ -19,11 +19,20 @@
 package router
 
 import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/bocheninc/msg-net/config"
+	pb "github.com/bocheninc/msg-net/protos"
+	"github.com/bocheninc/msg-net/router/member"
+	"github.com/bocheninc/msg-net/router/policy"
+	"github.com/bocheninc/msg-net/router/trace"
 )
 
 var num = 6
@@ -121,3 +130,518 @@ func TestRounterStartAndStop3(t *testing.T) {
 
 	r.Stop()
 }
+
+func TestRouterStore(t *testing.T) {
+	initTestConfig()
+	dir, err := ioutil.TempDir("", "msg-net-router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config.Set("router.store.path", filepath.Join(dir, "8010.db"))
+	r := NewRouter("00", "0.0.0.0:8010")
+	go r.Start()
+	time.Sleep(time.Second)
+
+	config.Set("router.store.path", "")
+	config.Set("router.discovery", "0.0.0.0:8010")
+	r1 := NewRouter("01", "0.0.0.0:8011")
+	go r1.Start()
+	time.Sleep(2 * time.Second)
+	r1.Stop()
+	r.Stop()
+	time.Sleep(time.Second)
+
+	//restart without discovery seeds
+	config.Set("router.discovery", "")
+	r1 = NewRouter("01", "0.0.0.0:8011")
+	go r1.Start()
+	time.Sleep(time.Second)
+	config.Set("router.store.path", filepath.Join(dir, "8010.db"))
+	r = NewRouter("00", "0.0.0.0:8010")
+	go r.Start()
+	time.Sleep(2 * time.Second)
+	if !r.routerExist("0.0.0.0:8011") {
+		t.Fatal("router is not reconnected from store")
+	}
+	r.Stop()
+	r1.Stop()
+	config.Set("router.store.path", "")
+}
+
+func TestPeersSelector(t *testing.T) {
+	peers := NewPeers()
+	peers.Update("r0", []*pb.Peer{{Id: "A:v0", Role: pb.Peer_VALIDATOR, Labels: map[string]string{"region": "eu"}}, {Id: "B:v1", Role: pb.Peer_VALIDATOR}})
+	peers.Update("r1", []*pb.Peer{{Id: "A:o0", Role: pb.Peer_OBSERVER, Capabilities: []string{"archive"}}})
+	peers.Update("r2", []*pb.Peer{{Id: "v2", ChainId: "A", NodeId: "v2", Role: pb.Peer_VALIDATOR}})
+
+	cases := map[string][]string{
+		"":                         {"r0", "r1", "r2"},
+		"role=validator":           {"r0", "r2"},
+		"role=validator,region=eu": {"r0"},
+		"region!=eu":               {"r1", "r2"},
+		"capability=archive":       {"r1"},
+		"region":                   {"r0"},
+		"chain=B":                  {},
+	}
+	for s, want := range cases {
+		selector, err := pb.ParseSelector(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]bool{}
+		for _, key := range peers.GetKeysBySelector("A:", selector) {
+			got[key] = true
+		}
+		if len(got) != len(want) {
+			t.Fatalf("selector %q expect %v, got %v", s, want, got)
+		}
+		for _, key := range want {
+			if !got[key] {
+				t.Fatalf("selector %q expect %v, got %v", s, want, got)
+			}
+		}
+	}
+	for _, s := range []string{"role=leader", "=eu", "a=b=c"} {
+		if _, err := pb.ParseSelector(s); err == nil {
+			t.Fatalf("expect error of selector %q", s)
+		}
+	}
+}
+
+func TestPeersApply(t *testing.T) {
+	peers := NewPeers()
+	count := func() int { return len(peers.Lookup("")) }
+
+	if !peers.Apply(&pb.Peers{Id: "r0", Epoch: 1, Version: 1, Delta: true, Base: 0, Peers: []*pb.Peer{{Id: "A:p0"}}}) || count() != 1 {
+		t.Fatal("failed to apply the first delta")
+	}
+	if !peers.Apply(&pb.Peers{Id: "r0", Epoch: 1, Version: 2, Delta: true, Base: 1, Peers: []*pb.Peer{{Id: "A:p1"}}}) || count() != 2 {
+		t.Fatal("failed to apply delta")
+	}
+	//stale delta is ignored
+	if !peers.Apply(&pb.Peers{Id: "r0", Epoch: 1, Version: 1, Delta: true, Base: 0, Peers: []*pb.Peer{{Id: "A:p2"}}}) || count() != 2 {
+		t.Fatal("stale delta is applied")
+	}
+	//gap
+	if peers.Apply(&pb.Peers{Id: "r0", Epoch: 1, Version: 4, Delta: true, Base: 3, Removed: []string{"A:p0"}}) || count() != 2 {
+		t.Fatal("delta after gap is applied")
+	}
+	if peers.Check(&pb.PeerDigest{Id: "r0", Epoch: 1, Version: 4, Count: 1}) {
+		t.Fatal("digest ahead is accepted")
+	}
+	if !peers.Check(&pb.PeerDigest{Id: "r0", Epoch: 1, Version: 2, Count: 2}) || peers.Check(&pb.PeerDigest{Id: "r0", Epoch: 1, Version: 2, Count: 3}) {
+		t.Fatal("unexpected digest check")
+	}
+	//full resync
+	if !peers.Apply(&pb.Peers{Id: "r0", Epoch: 1, Version: 4, Peers: []*pb.Peer{{Id: "A:p1"}}}) || count() != 1 {
+		t.Fatal("failed to apply snapshot")
+	}
+	if !peers.Apply(&pb.Peers{Id: "r0", Epoch: 1, Version: 5, Delta: true, Base: 4, Removed: []string{"A:p1"}}) || count() != 0 {
+		t.Fatal("failed to apply delta after snapshot")
+	}
+	//router restarted
+	if peers.Apply(&pb.Peers{Id: "r0", Epoch: 2, Version: 2, Delta: true, Base: 1, Peers: []*pb.Peer{{Id: "A:p3"}}}) {
+		t.Fatal("delta of new epoch is applied")
+	}
+	if !peers.Apply(&pb.Peers{Id: "r0", Epoch: 2, Version: 2, Peers: []*pb.Peer{{Id: "A:p3"}}}) || count() != 1 {
+		t.Fatal("failed to apply snapshot of new epoch")
+	}
+	if peers.Check(&pb.PeerDigest{Id: "r1", Epoch: 1, Version: 1, Count: 1}) || !peers.Check(&pb.PeerDigest{Id: "r2", Epoch: 1, Version: 1}) {
+		t.Fatal("unexpected digest check of unknown router")
+	}
+}
+
+func TestSummaries(t *testing.T) {
+	s := NewSummaries()
+	if !s.Update(&pb.AreaSummary{Id: "b0", Area: "x", Epoch: 1, Version: 1, Chains: []string{"A", "B"}}) {
+		t.Fatal("new summary is not applied")
+	}
+	if s.Update(&pb.AreaSummary{Id: "b0", Area: "x", Epoch: 1, Version: 1, Chains: []string{"C"}}) {
+		t.Fatal("stale summary is applied")
+	}
+	if s.Update(&pb.AreaSummary{Id: "b0", Area: "x", Epoch: 1, Version: 2, Chains: []string{"A", "B"}}) {
+		t.Fatal("refresh of the same chains is reported as change")
+	}
+	s.Update(&pb.AreaSummary{Id: "b1", Area: BackboneArea, Epoch: 1, Version: 1, Chains: []string{"B", "C"}})
+
+	keys := s.Keys("B:p0", time.Minute)
+	if len(keys) != 2 {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if keys := s.Keys("A:", time.Minute); len(keys) != 1 || keys[0] != "b0" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if keys := s.Keys("AB:p0", time.Minute); len(keys) != 0 {
+		t.Fatalf("chain prefix matches other chain %v", keys)
+	}
+	if chains := s.Chains(BackboneArea, map[string]bool{"b1": true}, time.Minute); len(chains) != 0 {
+		t.Fatalf("skipped border router is summarized %v", chains)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if keys := s.Keys("B:p0", time.Millisecond); len(keys) != 0 {
+		t.Fatalf("expired summaries are used %v", keys)
+	}
+
+	peers := NewPeers()
+	peers.Apply(&pb.Peers{Id: "r0", Epoch: 1, Version: 1, Area: "x", Peers: []*pb.Peer{{Id: "A:p0"}, {Id: "p1"}}})
+	peers.Apply(&pb.Peers{Id: "r1", Epoch: 1, Version: 1, Peers: []*pb.Peer{{Id: "B:p0"}}})
+	if chains := peers.Chains("x"); len(chains) != 1 || chains[0] != "A" {
+		t.Fatalf("unexpected chains of area %v", chains)
+	}
+}
+
+func TestTopology(t *testing.T) {
+	initTestConfig()
+	config.Set("router.timeout.routers", "1s")
+	dir, err := ioutil.TempDir("", "msg-net-router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config.Set("router.store.path", filepath.Join(dir, "8038.db"))
+	defer config.Set("router.store.path", "")
+	r0 := NewRouter("00", "0.0.0.0:8038")
+	go r0.Start()
+	time.Sleep(time.Second)
+	config.Set("router.store.path", "")
+	config.Set("router.discovery", "0.0.0.0:8038")
+	r1 := NewRouter("01", "0.0.0.0:8039")
+	go r1.Start()
+	time.Sleep(time.Second)
+	r2 := NewRouter("02", "0.0.0.0:8040")
+	go r2.Start()
+	time.Sleep(3 * time.Second)
+	r0.allPeers.Update("0.0.0.0:8040", []*pb.Peer{{Id: "B:p0"}})
+
+	topology := r0.Topology()
+	if len(topology.Routers) != 3 || len(topology.Links) != 3 || topology.Partitioned() || len(topology.Unreachable) != 0 {
+		t.Fatalf("unexpected topology %+v", topology)
+	}
+	if entry := topology.NextHops["0.0.0.0:8040"]; entry.Cost != 1 || entry.NextHops[0] != "0.0.0.0:8040" {
+		t.Fatalf("unexpected next hops %+v", topology.NextHops)
+	}
+	if rt := topology.Routers[2]; rt.ID != "02" || !rt.Neighbor || len(rt.Peers) != 1 || rt.Peers[0] != "B:p0" {
+		t.Fatalf("unexpected router %+v", rt)
+	}
+	dot := &strings.Builder{}
+	topology.WriteDOT(dot)
+	if !strings.Contains(dot.String(), `"0.0.0.0:8038" -- "0.0.0.0:8039" [label="1"];`) || !strings.Contains(dot.String(), `0.0.0.0:8040\n02\nB:p0`) {
+		t.Fatalf("unexpected dot\n%s", dot)
+	}
+
+	//crashed router is still known from the store
+	r1.server.Stop()
+	r1.cancelFunc()
+	time.Sleep(2 * time.Second)
+	topology = r0.Topology()
+	if !topology.Partitioned() || len(topology.Unreachable) != 1 || topology.Unreachable[0] != "0.0.0.0:8039" {
+		t.Fatalf("unexpected topology %+v", topology)
+	}
+	table := &strings.Builder{}
+	topology.WriteTable(table)
+	if !strings.Contains(table.String(), "UNREACHABLE") || !strings.Contains(table.String(), "PARTITIONED into 2 parts") {
+		t.Fatalf("unexpected table\n%s", table)
+	}
+	r2.Stop()
+	r0.Stop()
+}
+
+func TestPartition(t *testing.T) {
+	initTestConfig()
+	config.Set("router.timeout.routers", "1s")
+	dir, err := ioutil.TempDir("", "msg-net-router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config.Set("router.store.path", filepath.Join(dir, "8041.db"))
+	defer config.Set("router.store.path", "")
+	r0 := NewRouter("00", "0.0.0.0:8041")
+	events := make(chan *Partition, 8)
+	r0.OnPartition(func(p *Partition) { events <- p })
+	go r0.Start()
+	time.Sleep(time.Second)
+	config.Set("router.store.path", "")
+	config.Set("router.discovery", "0.0.0.0:8041")
+	r1 := NewRouter("01", "0.0.0.0:8042")
+	go r1.Start()
+	time.Sleep(3 * time.Second)
+	select {
+	case p := <-events:
+		t.Fatalf("unexpected partition %+v", p)
+	default:
+	}
+
+	//crash without closing gracefully, the router is known from the store
+	r1.server.Stop()
+	r1.cancelFunc()
+	select {
+	case p := <-events:
+		if !p.Partitioned() || len(p.Lost) != 1 || p.Lost[0] != "0.0.0.0:8042" {
+			t.Fatalf("unexpected partition %+v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("partition is not detected")
+	}
+	if topology := r0.Topology(); !topology.Partitioned() || len(topology.Unreachable) != 1 {
+		t.Fatalf("unexpected topology %+v", topology)
+	}
+
+	//restarted router without seeds is reached by retries of the partitioned side
+	config.Set("router.discovery", "")
+	r1 = NewRouter("01", "0.0.0.0:8042")
+	go r1.Start()
+	select {
+	case p := <-events:
+		if p.Partitioned() || len(p.Healed) != 1 || p.Healed[0] != "0.0.0.0:8042" {
+			t.Fatalf("unexpected partition %+v", p)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("partition is not healed")
+	}
+	if stats := r0.PartitionStats(); stats.Detected != 1 || stats.Healed != 1 || stats.Unreachable != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if _, err := r0.allRouters.GetNextHops("0.0.0.0:8042"); err != nil {
+		t.Fatal(err)
+	}
+
+	//graceful close is not a partition
+	r1.Stop()
+	time.Sleep(3 * time.Second)
+	select {
+	case p := <-events:
+		t.Fatalf("unexpected partition %+v", p)
+	default:
+	}
+	r0.Stop()
+}
+
+func TestMembership(t *testing.T) {
+	initTestConfig()
+	config.Set("router.timeout.routers", "1s")
+	config.Set("router.membership.enabled", true)
+	config.Set("router.membership.probe", "200ms")
+	config.Set("router.membership.timeout", "100ms")
+	config.Set("router.membership.suspicion", "1s")
+	defer config.Set("router.membership.enabled", false)
+
+	r0 := NewRouter("00", "0.0.0.0:8043")
+	events := make(chan *member.Member, 32)
+	r0.OnMember(func(m *member.Member) { events <- m })
+	go r0.Start()
+	time.Sleep(time.Second)
+	config.Set("router.discovery", "0.0.0.0:8043")
+	r1 := NewRouter("01", "0.0.0.0:8044")
+	go r1.Start()
+	time.Sleep(time.Second)
+	config.Set("router.discovery", "0.0.0.0:8044")
+	r2 := NewRouter("02", "0.0.0.0:8045")
+	go r2.Start()
+
+	wait := func(address string, state member.State, timeout time.Duration) {
+		deadline := time.After(timeout)
+		for {
+			select {
+			case m := <-events:
+				if m.Address == address && m.State == state {
+					return
+				}
+			case <-deadline:
+				t.Fatalf("member %s is not %s, members %v", address, state, r0.Members())
+			}
+		}
+	}
+	wait("0.0.0.0:8045", member.Alive, 5*time.Second)
+	time.Sleep(time.Second)
+	for _, r := range []*Router{r0, r1, r2} {
+		if members := r.Members(); len(members) != 2 || members[0].State != member.Alive || members[1].State != member.Alive {
+			t.Fatalf("router %s has unexpected members %v", r.address, members)
+		}
+	}
+	if rt := r0.Topology().Routers; len(rt) != 3 || rt[2].Member != "alive" {
+		t.Fatalf("unexpected topology routers %v", rt)
+	}
+
+	//crash without closing gracefully, it is suspected then declared dead
+	r2.server.Stop()
+	r2.cancelFunc()
+	wait("0.0.0.0:8045", member.Dead, 5*time.Second)
+
+	//graceful close is disseminated as left
+	r1.Stop()
+	wait("0.0.0.0:8044", member.Left, 3*time.Second)
+	r0.Stop()
+}
+
+func TestReload(t *testing.T) {
+	initTestConfig()
+	r0 := NewRouter("00", "0.0.0.0:8046")
+	go r0.Start()
+	r1 := NewRouter("01", "0.0.0.0:8047")
+	go r1.Start()
+	time.Sleep(time.Second)
+
+	//reload while the admin api reads discovery
+	config.Set("router.timeout.routers", "2s")
+	config.Set("router.discovery", "0.0.0.0:8047")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			r0.knownRouters()
+		}
+	}()
+	r0.Reload()
+	<-done
+	if d := r0.timeout(&r0.durationRouters); d != 2*time.Second {
+		t.Fatalf("timeout is not reloaded, %s", d)
+	}
+	time.Sleep(time.Second)
+	if !r0.routerExist("0.0.0.0:8047") {
+		t.Fatal("new discovery router is not connected")
+	}
+	r1.Stop()
+	r0.Stop()
+}
+
+func TestRouteIngress(t *testing.T) {
+	initTestConfig()
+	r := NewRouter("00", "0.0.0.0:8049")
+	go r.Start()
+	time.Sleep(500 * time.Millisecond)
+	defer r.Stop()
+
+	//peers attached by pipes, received bytes are counted
+	received := map[string]chan int{}
+	attach := func(id string) net.Conn {
+		conn, remote := net.Pipe()
+		c := make(chan int, 16)
+		received[id] = c
+		go func() {
+			buf := make([]byte, 4096)
+			for {
+				n, err := remote.Read(buf)
+				if err != nil {
+					return
+				}
+				c <- n
+			}
+		}()
+		r.peerAdd(&pb.Peer{Id: id}, conn)
+		return conn
+	}
+	p0, _ := attach("00:00:00:00:00:00:00:00"), attach("00:00:00:00:00:00:00:01")
+	send := func(src string, metadata []byte, conn net.Conn) error {
+		bytes, _ := (&pb.ChainMessage{Id: "m", SrcId: src, DstId: "00:00:00:00:00:00:00:01", Payload: []byte("data")}).Serialize()
+		return r.RouteMessage(&pb.Message{Type: pb.Message_CHAIN_MESSAGE, Metadata: metadata, Payload: bytes}, conn)
+	}
+	delivered := func() bool {
+		select {
+		case <-received["00:00:00:00:00:00:00:01"]:
+			return true
+		case <-time.After(200 * time.Millisecond):
+			return false
+		}
+	}
+
+	if err := send("00:00:00:00:00:00:00:01", nil, p0); err == nil || delivered() {
+		t.Fatal("message of spoofed source is routed")
+	}
+	unknown, _ := net.Pipe()
+	if err := send("00:00:00:00:00:00:00:00", nil, unknown); err == nil || delivered() {
+		t.Fatal("message from unknown connection is routed")
+	}
+	//metadata set by the peer neither passes the message as routed nor skips the policy
+	if err := send("00:00:00:00:00:00:00:00", []byte(r.address), p0); err != nil || !delivered() {
+		t.Fatalf("message with metadata of local router is not routed, %v", err)
+	}
+	//failed delivery is reported to the source attached here while peers are updated
+	//the write blocks until the connection breaks, meanwhile the peer is being removed
+	broken, remote := net.Pipe()
+	r.peerAdd(&pb.Peer{Id: "00:00:00:00:00:00:00:02"}, broken)
+	done := make(chan error, 1)
+	go func() {
+		bytes, _ := (&pb.ChainMessage{Id: "b", SrcId: "00:00:00:00:00:00:00:00", DstId: "00:00:00:00:00:00:00:02"}).Serialize()
+		done <- r.RouteMessage(&pb.Message{Type: pb.Message_CHAIN_MESSAGE, Payload: bytes}, p0)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	go r.peerRemove(broken)
+	time.Sleep(100 * time.Millisecond)
+	remote.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("failed delivery blocks routing")
+	}
+	select {
+	case <-received["00:00:00:00:00:00:00:00"]:
+	case <-time.After(time.Second):
+		t.Fatal("failed delivery is not reported to the source")
+	}
+	//failure of some destinations is not reported if the others are delivered
+	broken, remote = net.Pipe()
+	remote.Close()
+	r.peerAdd(&pb.Peer{Id: "01:00:00:00:00:00:00:00"}, broken)
+	attach("01:00:00:00:00:00:00:01")
+	bytes, _ := (&pb.ChainMessage{Id: "c", SrcId: "00:00:00:00:00:00:00:00", DstId: "01:00:00:00:00:00:00:"}).Serialize()
+	if err := r.RouteMessage(&pb.Message{Type: pb.Message_CHAIN_MESSAGE, Payload: bytes}, p0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received["01:00:00:00:00:00:00:01"]:
+	case <-time.After(time.Second):
+		t.Fatal("message is not delivered")
+	}
+	select {
+	case <-received["00:00:00:00:00:00:00:00"]:
+		t.Fatal("partial delivery is reported to the source")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	r.acl.Set(policy.DenyAll())
+	if err := send("00:00:00:00:00:00:00:00", []byte("0.0.0.0:9000"), p0); err != nil || delivered() {
+		t.Fatalf("message with metadata bypasses the policy, %v", err)
+	}
+}
+
+func TestAdminLoopback(t *testing.T) {
+	for address, loopback := range map[string]bool{"localhost:10680": true, "127.0.0.1:10680": true, "[::1]:10680": true, ":10680": false, "0.0.0.0:10680": false, "10.0.0.1:10680": false, "localhost": false} {
+		if isLoopback(address) != loopback {
+			t.Fatalf("loopback of %s is not %v", address, loopback)
+		}
+	}
+}
+
+func TestTraceContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	exporter, err := trace.NewFileExporter(filepath.Join(dir, "spans.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRouter("00", "0.0.0.0:8050")
+	r.tracer = trace.NewTracer(nil, exporter, 10, time.Hour, nil)
+	defer r.tracer.Close()
+
+	//malformed trace context from the wire starts a new trace
+	chainMsg := &pb.ChainMessage{Id: "m", TraceId: "\n<script>", SpanId: "00f067aa0ba902b7", Sampled: true}
+	span := r.traceMsg(chainMsg, false, time.Now())
+	if !trace.ValidTraceID(chainMsg.TraceId) || chainMsg.SpanId != "" || span.TraceID != chainMsg.TraceId || span.ParentID != "" {
+		t.Fatalf("malformed trace context is kept, %+v", span)
+	}
+	traceID := trace.NewTraceID()
+	chainMsg = &pb.ChainMessage{Id: "m", TraceId: traceID, SpanId: "00F067AA0BA902B7", Sampled: true}
+	if span = r.traceMsg(chainMsg, false, time.Now()); span.TraceID != traceID || span.ParentID != "" {
+		t.Fatalf("malformed span id is kept, %+v", span)
+	}
+	chainMsg = &pb.ChainMessage{Id: "m", TraceId: traceID, SpanId: "00f067aa0ba902b7", Sampled: true}
+	if span = r.traceMsg(chainMsg, false, time.Now()); span.TraceID != traceID || span.ParentID != "00f067aa0ba902b7" {
+		t.Fatalf("trace context is not kept, %+v", span)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//Package store 提供router状态的本地持久化，重启后加快网络收敛
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bocheninc/msg-net/util"
+)
+
+const (
+	kindRouter   = "router"
+	kindTopology = "topology"
+)
+
+var errClosed = errors.New("store is closed")
+
+//compactThreshold number of appended records before the file is rewritten as a snapshot
+var compactThreshold = 1024
+
+//seenInterval router seen again within the interval is not written
+var seenInterval = time.Minute
+
+//RouterRecord router known by local router
+type RouterRecord struct {
+	ID       string    `json:"id"`
+	Address  string    `json:"address"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+type record struct {
+	Kind     string              `json:"kind"`
+	Router   *RouterRecord       `json:"router,omitempty"`
+	Topology map[string][]string `json:"topology,omitempty"`
+}
+
+//Store append-only file store of router state
+type Store struct {
+	path     string
+	file     *os.File
+	routers  map[string]*RouterRecord
+	topology map[string][]string
+	appended int
+	sync.Mutex
+}
+
+//NewStore opens the store file, creates it if not exist, and loads the state
+func NewStore(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	s := &Store{path: path, routers: make(map[string]*RouterRecord), topology: make(map[string][]string)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+//Routers returns routers seen within duration, all routers if duration is 0
+func (s *Store) Routers(duration time.Duration) []*RouterRecord {
+	s.Lock()
+	defer s.Unlock()
+	routers := []*RouterRecord{}
+	for _, router := range s.routers {
+		if duration == 0 || time.Since(router.LastSeen) <= duration {
+			r := *router
+			routers = append(routers, &r)
+		}
+	}
+	return routers
+}
+
+//Topology returns the last topology snapshot, source router to its linked routers
+func (s *Store) Topology() map[string][]string {
+	s.Lock()
+	defer s.Unlock()
+	topology := make(map[string][]string)
+	for src, dsts := range s.topology {
+		topology[src] = append([]string{}, dsts...)
+	}
+	return topology
+}
+
+//SeeRouter records router is seen at time t
+func (s *Store) SeeRouter(id, address string, t time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+	router := &RouterRecord{ID: id, Address: address, LastSeen: t}
+	if old, ok := s.routers[address]; ok {
+		if id == "" {
+			router.ID = old.ID
+		}
+		if router.ID == old.ID && t.Sub(old.LastSeen) < seenInterval {
+			return nil
+		}
+	}
+	s.routers[address] = router
+	return s.append(&record{Kind: kindRouter, Router: router})
+}
+
+//SaveTopology records topology snapshot
+func (s *Store) SaveTopology(topology map[string][]string) error {
+	s.Lock()
+	defer s.Unlock()
+	s.topology = topology
+	return s.append(&record{Kind: kindTopology, Topology: topology})
+}
+
+//Close closes the store file
+func (s *Store) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *Store) load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		r := &record{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			//torn write at the tail, the rest is discarded
+			break
+		}
+		s.apply(r)
+	}
+	return nil
+}
+
+func (s *Store) apply(r *record) {
+	switch r.Kind {
+	case kindRouter:
+		if r.Router != nil {
+			s.routers[r.Router.Address] = r.Router
+		}
+	case kindTopology:
+		s.topology = r.Topology
+		if s.topology == nil {
+			s.topology = make(map[string][]string)
+		}
+	}
+}
+
+func (s *Store) append(r *record) error {
+	if s.file == nil {
+		return errClosed
+	}
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(bytes, '\n')); err != nil {
+		return err
+	}
+	s.appended++
+	if s.appended >= compactThreshold {
+		return s.compact()
+	}
+	return nil
+}
+
+//compact rewrites the file with current state only
+func (s *Store) compact() error {
+	records := []interface{}{}
+	for _, router := range s.routers {
+		records = append(records, &record{Kind: kindRouter, Router: router})
+	}
+	records = append(records, &record{Kind: kindTopology, Topology: s.topology})
+	var err error
+	s.file, err = util.RewriteJSONLines(s.path, s.file, records)
+	s.appended = 0
+	return err
+}
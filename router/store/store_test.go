@@ -0,0 +1,114 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msg-net-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state", "router.db")
+
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	s.SeeRouter("1", "127.0.0.1:8001", old)
+	s.SeeRouter("2", "127.0.0.1:8002", time.Now())
+	s.SeeRouter("", "127.0.0.1:8001", time.Now())
+	s.SaveTopology(map[string][]string{"127.0.0.1:8000": {"127.0.0.1:8001"}})
+	s.SaveTopology(map[string][]string{"127.0.0.1:8000": {"127.0.0.1:8001", "127.0.0.1:8002"}})
+	s.Close()
+
+	//torn tail write
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte(`{"kind":"router","rout`))
+	f.Close()
+
+	s, err = NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	routers := s.Routers(0)
+	if len(routers) != 2 {
+		t.Fatalf("expect 2 routers, got %v", routers)
+	}
+	for _, router := range routers {
+		if router.Address == "127.0.0.1:8001" && (router.ID != "1" || router.LastSeen.Before(old.Add(time.Minute))) {
+			t.Fatalf("router not updated %v", router)
+		}
+	}
+	if len(s.Routers(time.Minute)) != 2 {
+		t.Fatalf("expect 2 routers seen recently")
+	}
+	if dsts := s.Topology()["127.0.0.1:8000"]; len(dsts) != 2 {
+		t.Fatalf("expect last topology snapshot, got %v", s.Topology())
+	}
+}
+
+func TestStoreCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msg-net-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "router.db")
+
+	compactThreshold = 10
+	seenInterval = 0
+	defer func() {
+		compactThreshold = 1024
+		seenInterval = time.Minute
+	}()
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 25; i++ {
+		if err := s.SeeRouter("1", "127.0.0.1:8001", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	bytes, _ := ioutil.ReadFile(path)
+	lines := 0
+	for _, b := range bytes {
+		if b == '\n' {
+			lines++
+		}
+	}
+	if lines >= 10 {
+		t.Fatalf("store is not compacted, %d records", lines)
+	}
+	if err := s.SeeRouter("1", "127.0.0.1:8001", time.Now()); err == nil {
+		t.Fatal("write to closed store")
+	}
+}
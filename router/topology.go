@@ -0,0 +1,271 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package router
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	pb "github.com/bocheninc/msg-net/protos"
+	"github.com/bocheninc/msg-net/router/member"
+	"github.com/bocheninc/msg-net/router/route"
+)
+
+//linkCost cost of each link in route computation
+const linkCost = 1
+
+//Topology mesh as seen by a router
+type Topology struct {
+	Router      string                 `json:"router"`
+	ID          string                 `json:"id"`
+	Area        string                 `json:"area,omitempty"`
+	Routers     []*TopologyRouter      `json:"routers"`
+	Links       []*TopologyLink        `json:"links"`
+	NextHops    map[string]route.Entry `json:"nextHops"`
+	Unreachable []string               `json:"unreachable"`
+	Partitions  [][]string             `json:"partitions"` //connected routers, the first one has the local router
+}
+
+//TopologyRouter router of the mesh and peers attached to it
+type TopologyRouter struct {
+	Address   string   `json:"address"`
+	ID        string   `json:"id,omitempty"`
+	Neighbor  bool     `json:"neighbor"` //connected to the local router directly
+	Reachable bool     `json:"reachable"`
+	Member    string   `json:"member,omitempty"` //state of membership, empty if it is disabled
+	Peers     []string `json:"peers"`
+}
+
+//TopologyLink link between two routers
+type TopologyLink struct {
+	Src  string `json:"src"`
+	Dst  string `json:"dst"`
+	Cost int    `json:"cost"`
+}
+
+//Topology returns routers known from links, seeds and the store, links, peers, next hops of the local router and partitions
+func (r *Router) Topology() *Topology {
+	t := &Topology{Router: r.address, ID: r.id, Area: r.area, Links: []*TopologyLink{}, NextHops: r.allRouters.GetRouteTable(), Unreachable: []string{}}
+	routers := map[string]*TopologyRouter{r.address: {Address: r.address, ID: r.id, Reachable: true, Peers: []string{}}}
+	known := func(address string) *TopologyRouter {
+		if _, ok := routers[address]; !ok {
+			_, reachable := t.NextHops[address]
+			routers[address] = &TopologyRouter{Address: address, Reachable: reachable, Peers: []string{}}
+		}
+		return routers[address]
+	}
+
+	adjacent := map[string][]string{}
+	for _, link := range r.allRouters.GetNetworkTopology() {
+		src := link.GetSrcNode()
+		known(src)
+		for _, dst := range link.GetDstNodes() {
+			known(dst)
+			adjacent[src] = append(adjacent[src], dst)
+			adjacent[dst] = append(adjacent[dst], src)
+			if src < dst {
+				t.Links = append(t.Links, &TopologyLink{Src: src, Dst: dst, Cost: linkCost})
+			}
+		}
+	}
+	for _, address := range r.knownRouters() {
+		known(address)
+	}
+	if r.store != nil {
+		for _, record := range r.store.Routers(storeExpire()) {
+			if rt, ok := routers[record.Address]; ok && rt.ID == "" {
+				rt.ID = record.ID
+			}
+		}
+	}
+	r.routerIterFunc(func(address string, router *pb.Router) {
+		rt := known(address)
+		rt.Neighbor = true
+		if router.Id != "" {
+			rt.ID = router.Id
+		}
+	})
+	for _, m := range r.Members() {
+		if m.State <= member.Suspect {
+			known(m.Address)
+		}
+		if rt, ok := routers[m.Address]; ok {
+			rt.Member = m.State.String()
+			if rt.ID == "" {
+				rt.ID = m.ID
+			}
+		}
+	}
+	if r.members != nil {
+		routers[r.address].Member = r.members.list.Self().State.String()
+	}
+	for id, keys := range r.allPeers.Lookup("") {
+		for _, key := range keys {
+			rt := known(key)
+			rt.Peers = append(rt.Peers, id)
+		}
+	}
+
+	for _, rt := range routers {
+		sort.Strings(rt.Peers)
+		t.Routers = append(t.Routers, rt)
+		if !rt.Reachable {
+			t.Unreachable = append(t.Unreachable, rt.Address)
+		}
+	}
+	sort.Slice(t.Routers, func(i, j int) bool { return t.Routers[i].Address < t.Routers[j].Address })
+	sort.Slice(t.Links, func(i, j int) bool {
+		if t.Links[i].Src != t.Links[j].Src {
+			return t.Links[i].Src < t.Links[j].Src
+		}
+		return t.Links[i].Dst < t.Links[j].Dst
+	})
+	sort.Strings(t.Unreachable)
+	t.Partitions = partitions(r.address, t.Routers, adjacent)
+	return t
+}
+
+//partitions splits routers into connected components, the one of local first and the others by their first router
+func partitions(local string, routers []*TopologyRouter, adjacent map[string][]string) [][]string {
+	visited := map[string]bool{}
+	component := func(start string) []string {
+		nodes := []string{}
+		queue := []string{start}
+		visited[start] = true
+		for len(queue) > 0 {
+			node := queue[0]
+			queue = queue[1:]
+			nodes = append(nodes, node)
+			for _, next := range adjacent[node] {
+				if !visited[next] {
+					visited[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+		sort.Strings(nodes)
+		return nodes
+	}
+	result := [][]string{component(local)}
+	for _, rt := range routers {
+		if !visited[rt.Address] {
+			result = append(result, component(rt.Address))
+		}
+	}
+	return result
+}
+
+//Partitioned returns true if some known routers are not connected to the local router
+func (t *Topology) Partitioned() bool {
+	return len(t.Partitions) > 1
+}
+
+//WriteTable prints routers, links and partitions as tables
+func (t *Topology) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ROUTER\tID\tSTATE\tMEMBER\tCOST\tNEXT HOPS\tPEERS\n")
+	for _, rt := range t.Routers {
+		state, cost, hops := "reachable", "-", "-"
+		if entry, ok := t.NextHops[rt.Address]; ok {
+			cost, hops = fmt.Sprint(entry.Cost), strings.Join(entry.NextHops, ",")
+		}
+		switch {
+		case rt.Address == t.Router:
+			state, cost = "local", "0"
+		case !rt.Reachable:
+			state = "UNREACHABLE"
+		case rt.Neighbor:
+			state = "neighbor"
+		}
+		peers := "-"
+		if len(rt.Peers) > 0 {
+			peers = strings.Join(rt.Peers, ",")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", rt.Address, orDash(rt.ID), state, orDash(rt.Member), cost, hops, peers)
+	}
+	fmt.Fprintf(tw, "\nLINK\t\tCOST\n")
+	for _, link := range t.Links {
+		fmt.Fprintf(tw, "%s -- %s\t\t%d\n", link.Src, link.Dst, link.Cost)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if t.Partitioned() {
+		fmt.Fprintf(w, "\nPARTITIONED into %d parts\n", len(t.Partitions))
+		for i, part := range t.Partitions {
+			fmt.Fprintf(w, "  %d: %s\n", i, strings.Join(part, " "))
+		}
+	}
+	return nil
+}
+
+//WriteDOT prints the mesh as Graphviz DOT, unreachable routers and other partitions are red
+func (t *Topology) WriteDOT(w io.Writer) error {
+	routers := map[string]*TopologyRouter{}
+	for _, rt := range t.Routers {
+		routers[rt.Address] = rt
+	}
+	node := func(address string) string {
+		rt := routers[address]
+		label := address
+		if rt.ID != "" {
+			label += "\n" + rt.ID
+		}
+		if len(rt.Peers) > 0 {
+			label += "\n" + strings.Join(rt.Peers, "\n")
+		}
+		attrs := []string{fmt.Sprintf("label=%q", label)}
+		if address == t.Router {
+			attrs = append(attrs, "shape=doublecircle", "style=bold")
+		} else if !rt.Reachable {
+			attrs = append(attrs, "color=red", "fontcolor=red", "style=dashed")
+		}
+		return fmt.Sprintf("%q [%s];", address, strings.Join(attrs, ", "))
+	}
+	fmt.Fprintf(w, "graph msgnet {\n")
+	fmt.Fprintf(w, "\tlabel=%q;\n", "topology seen by "+t.Router)
+	fmt.Fprintf(w, "\tnode [shape=box];\n")
+	for i, part := range t.Partitions {
+		fmt.Fprintf(w, "\tsubgraph cluster_%d {\n", i)
+		if i == 0 {
+			fmt.Fprintf(w, "\t\tlabel=%q;\n", "partition 0 (local)")
+		} else {
+			fmt.Fprintf(w, "\t\tlabel=%q;\n\t\tcolor=red;\n", fmt.Sprintf("partition %d", i))
+		}
+		for _, address := range part {
+			fmt.Fprintf(w, "\t\t%s\n", node(address))
+		}
+		fmt.Fprintf(w, "\t}\n")
+	}
+	for _, link := range t.Links {
+		fmt.Fprintf(w, "\t%q -- %q [label=\"%d\"];\n", link.Src, link.Dst, link.Cost)
+	}
+	_, err := fmt.Fprintf(w, "}\n")
+	return err
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
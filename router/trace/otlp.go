@@ -0,0 +1,198 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//ScopeName instrumentation scope of exported spans
+const ScopeName = "github.com/bocheninc/msg-net/router"
+
+//statusError status code of failed span
+const statusError = 2
+
+//Exporter sends batch of finished spans
+type Exporter interface {
+	Export(resource map[string]string, spans []*Span) error
+	Close() error
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func otlpAttributes(attrs map[string]string) []otlpKeyValue {
+	keys := []string{}
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := []otlpKeyValue{}
+	for _, k := range keys {
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: attrs[k]}})
+	}
+	return kvs
+}
+
+//Encode encodes spans as OTLP JSON trace export request
+func Encode(resource map[string]string, spans []*Span) ([]byte, error) {
+	ss := []otlpSpan{}
+	for _, s := range spans {
+		span := otlpSpan{TraceID: s.TraceID, SpanID: s.SpanID, ParentSpanID: s.ParentID, Name: s.Name, Kind: s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10), EndTimeUnixNano: strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes: otlpAttributes(s.Attributes)}
+		if s.Error != "" {
+			span.Status = otlpStatus{Code: statusError, Message: s.Error}
+		}
+		ss = append(ss, span)
+	}
+	return json.Marshal(&otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(resource)},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: ScopeName}, Spans: ss}},
+	}}})
+}
+
+//FileExporter appends each batch as a line of OTLP JSON, the format of the collector file exporter
+type FileExporter struct {
+	file *os.File
+	sync.Mutex
+}
+
+//NewFileExporter opens span file, creates it if not exist
+func NewFileExporter(path string) (*FileExporter, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: file}, nil
+}
+
+//Export appends spans to the file
+func (e *FileExporter) Export(resource map[string]string, spans []*Span) error {
+	bytes, err := Encode(resource, spans)
+	if err != nil {
+		return err
+	}
+	e.Lock()
+	defer e.Unlock()
+	_, err = e.file.Write(append(bytes, '\n'))
+	return err
+}
+
+//Close closes the file
+func (e *FileExporter) Close() error {
+	e.Lock()
+	defer e.Unlock()
+	return e.file.Close()
+}
+
+//HTTPExporter posts each batch to OTLP/HTTP collector endpoint in JSON, e.g. http://localhost:4318/v1/traces
+type HTTPExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+//NewHTTPExporter creates exporter to collector endpoint
+func NewHTTPExporter(endpoint string, timeout time.Duration) *HTTPExporter {
+	return &HTTPExporter{endpoint: endpoint, client: &http.Client{Timeout: timeout}}
+}
+
+//Export posts spans to the collector
+func (e *HTTPExporter) Export(resource map[string]string, spans []*Span) error {
+	body, err := Encode(resource, spans)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector %s responds %s", e.endpoint, resp.Status)
+	}
+	return nil
+}
+
+//Close does nothing
+func (e *HTTPExporter) Close() error {
+	return nil
+}
@@ -0,0 +1,258 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//Package trace 提供消息路径追踪，记录router上的span并按OpenTelemetry OTLP JSON格式导出
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//span kinds of OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+//NewTraceID generates 16 bytes trace id in hex
+func NewTraceID() string {
+	return newID(16)
+}
+
+//NewSpanID generates 8 bytes span id in hex
+func NewSpanID() string {
+	return newID(8)
+}
+
+func newID(n int) string {
+	bytes := make([]byte, n)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+//ValidTraceID trace id is 16 bytes in lowercase hex and not all zero
+func ValidTraceID(id string) bool {
+	return validID(id, 16)
+}
+
+//ValidSpanID span id is 8 bytes in lowercase hex and not all zero
+func ValidSpanID(id string) bool {
+	return validID(id, 8)
+}
+
+func validID(id string, n int) bool {
+	if len(id) != 2*n {
+		return false
+	}
+	zero := true
+	for _, c := range id {
+		switch {
+		case c == '0':
+		case c >= '1' && c <= '9', c >= 'a' && c <= 'f':
+			zero = false
+		default:
+			return false
+		}
+	}
+	return !zero
+}
+
+//Span operation of router on a traced message, methods of nil span do nothing so untraced messages need no checks
+type Span struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Kind       int
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Error      string
+
+	tracer *Tracer
+}
+
+//Child starts span whose parent is s
+func (s *Span) Child(name string, kind int) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.Start(s.TraceID, s.SpanID, name, kind)
+}
+
+//ID returns span id, empty for nil span
+func (s *Span) ID() string {
+	if s == nil {
+		return ""
+	}
+	return s.SpanID
+}
+
+//SetAttr sets attribute of span
+func (s *Span) SetAttr(key, value string) {
+	if s == nil {
+		return
+	}
+	s.Attributes[key] = value
+}
+
+//SetError marks span failed
+func (s *Span) SetError(msg string) {
+	if s == nil {
+		return
+	}
+	s.Error = msg
+}
+
+//Finish ends span and hands it to the exporter
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	s.tracer.record(s)
+}
+
+//Stats counters of tracer
+type Stats struct {
+	Exported uint64 `json:"exported"`
+	Dropped  uint64 `json:"dropped"` //queue is full or export fails
+	Failed   uint64 `json:"failed"`  //exports failed
+}
+
+//Tracer batches finished spans and exports them in background
+type Tracer struct {
+	resource map[string]string
+	exporter Exporter
+	batch    int
+	interval time.Duration
+	queue    chan *Span
+	done     chan struct{}
+	closed   bool
+	rwClosed sync.RWMutex
+	exported uint64
+	dropped  uint64
+	failed   uint64
+	onError  func(error)
+}
+
+//NewTracer creates tracer exporting spans with resource attributes, e.g. service.name,
+//every interval or once batch spans are finished, onError is called if export fails
+func NewTracer(resource map[string]string, exporter Exporter, batch int, interval time.Duration, onError func(error)) *Tracer {
+	if batch <= 0 {
+		batch = 512
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	t := &Tracer{resource: resource, exporter: exporter, batch: batch, interval: interval, queue: make(chan *Span, batch*4), done: make(chan struct{}), onError: onError}
+	go t.loop()
+	return t
+}
+
+//Start starts span of trace, it is a root span if parent is empty. Nil tracer returns nil span
+func (t *Tracer) Start(traceID, parentID, name string, kind int) *Span {
+	if t == nil {
+		return nil
+	}
+	return &Span{TraceID: traceID, SpanID: NewSpanID(), ParentID: parentID, Name: name, Kind: kind, Start: time.Now(),
+		Attributes: make(map[string]string), tracer: t}
+}
+
+func (t *Tracer) record(s *Span) {
+	t.rwClosed.RLock()
+	defer t.rwClosed.RUnlock()
+	if t.closed {
+		atomic.AddUint64(&t.dropped, 1)
+		return
+	}
+	select {
+	case t.queue <- s:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+func (t *Tracer) loop() {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	spans := []*Span{}
+	for {
+		select {
+		case s, ok := <-t.queue:
+			if !ok {
+				t.export(spans)
+				close(t.done)
+				return
+			}
+			spans = append(spans, s)
+			if len(spans) >= t.batch {
+				t.export(spans)
+				spans = []*Span{}
+			}
+		case <-ticker.C:
+			t.export(spans)
+			spans = []*Span{}
+		}
+	}
+}
+
+func (t *Tracer) export(spans []*Span) {
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.exporter.Export(t.resource, spans); err != nil {
+		atomic.AddUint64(&t.failed, 1)
+		atomic.AddUint64(&t.dropped, uint64(len(spans)))
+		if t.onError != nil {
+			t.onError(err)
+		}
+		return
+	}
+	atomic.AddUint64(&t.exported, uint64(len(spans)))
+}
+
+//Stats returns counters of tracer
+func (t *Tracer) Stats() Stats {
+	if t == nil {
+		return Stats{}
+	}
+	return Stats{Exported: atomic.LoadUint64(&t.exported), Dropped: atomic.LoadUint64(&t.dropped), Failed: atomic.LoadUint64(&t.failed)}
+}
+
+//Close exports pending spans and closes the exporter, spans finished after Close are dropped
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.rwClosed.Lock()
+	if t.closed {
+		t.rwClosed.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.queue)
+	t.rwClosed.Unlock()
+	<-t.done
+	return t.exporter.Close()
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package trace
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spans.json")
+	exporter, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := NewTracer(map[string]string{"service.name": "msg-net-router"}, exporter, 2, time.Hour, nil)
+
+	traceID := NewTraceID()
+	receive := tracer.Start(traceID, "00f067aa0ba902b7", "receive", KindServer)
+	forward := receive.Child("forward", KindClient)
+	forward.SetAttr("next_hop", "0.0.0.0:8000")
+	forward.SetError("NO_ROUTE")
+	forward.Finish()
+	receive.Finish()
+	root := tracer.Start(NewTraceID(), "", "receive", KindServer)
+	root.Finish()
+	tracer.Close()
+	if stats := tracer.Stats(); stats.Exported != 3 || stats.Dropped != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	//nil tracer and spans are no-ops
+	var none *Tracer
+	none.Start(traceID, "", "receive", KindServer).Child("forward", KindClient).Finish()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 batches, got %d", len(lines))
+	}
+	req := &otlpRequest{}
+	if err := json.Unmarshal([]byte(lines[0]), req); err != nil {
+		t.Fatal(err)
+	}
+	rs := req.ResourceSpans[0]
+	if rs.Resource.Attributes[0].Key != "service.name" || rs.ScopeSpans[0].Scope.Name != ScopeName {
+		t.Fatalf("unexpected resource spans %+v", rs)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 || spans[0].Name != "forward" || spans[0].ParentSpanID != spans[1].SpanID || spans[1].ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected spans %+v", spans)
+	}
+	if spans[0].TraceID != traceID || len(spans[0].SpanID) != 16 || spans[0].Status.Code != statusError || spans[0].Kind != KindClient {
+		t.Fatalf("unexpected span %+v", spans[0])
+	}
+	if spans[0].StartTimeUnixNano == "" || spans[0].EndTimeUnixNano < spans[0].StartTimeUnixNano {
+		t.Fatalf("unexpected span time %+v", spans[0])
+	}
+
+	if !ValidTraceID(traceID) || !ValidSpanID(spans[0].SpanID) {
+		t.Fatalf("generated ids %s %s are invalid", traceID, spans[0].SpanID)
+	}
+	for _, id := range []string{"", "00000000000000000000000000000000", "4BF92F3577B34DA6A3CE929D0E0E4736", "4bf92f3577b34da6a3ce929d0e0e473", "4bf92f3577b34da6a3ce929d0e0e473g", "<script>alert(1)</script>00000000"} {
+		if ValidTraceID(id) {
+			t.Fatalf("trace id %q is valid", id)
+		}
+	}
+	if ValidSpanID("0000000000000000") || ValidSpanID("00f067aa0ba902b") || ValidSpanID(traceID) {
+		t.Fatal("invalid span id is valid")
+	}
+}
+
+func TestHTTPExporter(t *testing.T) {
+	received := make(chan *otlpRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		req := &otlpRequest{}
+		json.NewDecoder(r.Body).Decode(req)
+		received <- req
+	}))
+	defer collector.Close()
+
+	failed := make(chan error, 1)
+	tracer := NewTracer(nil, NewHTTPExporter(collector.URL+"/v1/traces", time.Second), 10, 50*time.Millisecond, nil)
+	tracer.Start(NewTraceID(), "", "receive", KindServer).Finish()
+	select {
+	case req := <-received:
+		if len(req.ResourceSpans[0].ScopeSpans[0].Spans) != 1 {
+			t.Fatalf("unexpected request %+v", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("spans are not exported in interval")
+	}
+	tracer.Close()
+
+	tracer = NewTracer(nil, NewHTTPExporter(collector.URL+"/unknown", time.Second), 1, time.Hour, func(err error) { failed <- err })
+	tracer.Start(NewTraceID(), "", "receive", KindServer).Finish()
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("failed export is not reported")
+	}
+	tracer.Close()
+	if stats := tracer.Stats(); stats.Failed != 1 || stats.Dropped != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (C) 2017, Beijing Bochen Technology Co.,Ltd.  All rights reserved.
+//
+// This file is part of msg-net
+//
+// The msg-net is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The msg-net is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package router
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/bocheninc/msg-net/config"
+	"github.com/bocheninc/msg-net/logger"
+	pb "github.com/bocheninc/msg-net/protos"
+	"github.com/bocheninc/msg-net/router/trace"
+)
+
+//loadTracer creates tracer of router.trace.exporter, file or otlp, spans are not recorded if it is empty
+func (r *Router) loadTracer() {
+	r.tracer = nil
+	r.traceSample = config.GetFloat64("router.trace.sample")
+	var exporter trace.Exporter
+	switch kind := config.GetString("router.trace.exporter"); kind {
+	case "":
+		return
+	case "file":
+		path := config.GetString("router.trace.path")
+		e, err := trace.NewFileExporter(path)
+		if err != nil {
+			logger.Errorf("router %s failed to open span file %s --- %v", r.address, path, err)
+			return
+		}
+		exporter = e
+	case "otlp":
+		exporter = trace.NewHTTPExporter(config.GetString("router.trace.endpoint"), 10*time.Second)
+	default:
+		logger.Errorf("router %s unknown trace exporter %s, tracing is disabled", r.address, kind)
+		return
+	}
+	interval := 5 * time.Second
+	if d, err := time.ParseDuration(config.GetString("router.trace.interval")); err == nil && d > 0 {
+		interval = d
+	}
+	resource := map[string]string{"service.name": "msg-net-router", "service.instance.id": r.address, "msgnet.router.id": r.id}
+	if r.area != BackboneArea {
+		resource["msgnet.router.area"] = r.area
+	}
+	r.tracer = trace.NewTracer(resource, exporter, config.GetInt("router.trace.batch"), interval, func(err error) {
+		logger.Warnf("router %s failed to export spans --- %v", r.address, err)
+	})
+}
+
+//traceMsg starts receive span of sampled chain message, message from local peer without trace context
+//is sampled by router.trace.sample. Malformed trace id from the wire is replaced by a new one, and malformed
+//span id is dropped so the span has no parent. It returns nil if the message is not traced by this router
+func (r *Router) traceMsg(chainMsg *pb.ChainMessage, ingress bool, received time.Time) *trace.Span {
+	if r.tracer == nil {
+		return nil
+	}
+	if chainMsg.TraceId != "" && !trace.ValidTraceID(chainMsg.TraceId) {
+		logger.Debugf("router %s replaces malformed trace id %q of message %s", r.address, chainMsg.TraceId, chainMsg.Id)
+		chainMsg.TraceId, chainMsg.SpanId = trace.NewTraceID(), ""
+	}
+	if chainMsg.SpanId != "" && !trace.ValidSpanID(chainMsg.SpanId) {
+		logger.Debugf("router %s drops malformed span id %q of message %s", r.address, chainMsg.SpanId, chainMsg.Id)
+		chainMsg.SpanId = ""
+	}
+	if chainMsg.TraceId == "" {
+		if !ingress || r.traceSample <= 0 || rand.Float64() >= r.traceSample {
+			return nil
+		}
+		chainMsg.TraceId = traceID(chainMsg.Id)
+		chainMsg.Sampled = true
+	}
+	if !chainMsg.Sampled {
+		return nil
+	}
+	span := r.tracer.Start(chainMsg.TraceId, chainMsg.SpanId, "receive", trace.KindServer)
+	span.Start = received
+	span.SetAttr("msgnet.router", r.address)
+	span.SetAttr("msgnet.message.id", chainMsg.Id)
+	span.SetAttr("msgnet.message.src", chainMsg.SrcId)
+	span.SetAttr("msgnet.message.dst", chainMsg.DstId)
+	span.SetAttr("msgnet.message.kind", chainMsg.Kind.String())
+	if chainMsg.Selector != "" {
+		span.SetAttr("msgnet.message.selector", chainMsg.Selector)
+	}
+	return span
+}
+
+//traceID message id of peers is a 16 bytes hex, it is the trace id then so the trace is found by the id returned to sender
+func traceID(msgID string) string {
+	if trace.ValidTraceID(msgID) {
+		return msgID
+	}
+	return trace.NewTraceID()
+}
+
+//tracedMsg returns msg carrying forward span as the parent of spans of the next router, msg itself if it is not traced
+func (r *Router) tracedMsg(msg *pb.Message, chainMsg *pb.ChainMessage, forward *trace.Span) *pb.Message {
+	if forward == nil {
+		return msg
+	}
+	chainMsg.SpanId = forward.ID()
+	payload, err := chainMsg.Serialize()
+	if err != nil {
+		return msg
+	}
+	return &pb.Message{Type: msg.Type, Payload: payload, Metadata: msg.Metadata}
+}
+
+func (r *Router) closeTracer() {
+	if r.tracer != nil {
+		r.tracer.Close()
+	}
+}
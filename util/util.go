@@ -19,6 +19,8 @@
 package util
 
 import (
+	"bufio"
+	"encoding/json"
 	"net"
 	"os"
 	"os/signal"
@@ -86,7 +88,7 @@ func CallerInfo(skip int) string {
 
 //SysSignal checks exit signal
 func SysSignal(function func()) {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTSTP)
 	for {
 		select {
@@ -105,3 +107,38 @@ func IsStrExist(str string, strs []string) bool {
 	}
 	return false
 }
+
+//RewriteJSONLines rewrites file of path with records as json lines through a temporary file,
+//old file is closed before it is replaced, the new one is opened for appending
+func RewriteJSONLines(path string, old *os.File, records []interface{}) (*os.File, error) {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return old, err
+	}
+	w := bufio.NewWriter(file)
+	for _, r := range records {
+		bytes, err := json.Marshal(r)
+		if err != nil {
+			file.Close()
+			return old, err
+		}
+		w.Write(append(bytes, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return old, err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return old, err
+	}
+	file.Close()
+	if old != nil {
+		old.Close()
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+}